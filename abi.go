@@ -0,0 +1,464 @@
+package ethereum_parser
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidABI = errors.New("invalid abi")
+
+// ABIArgument a function input or output as it appears in a JSON ABI, tuples list their fields as components
+type ABIArgument struct {
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`
+	Components []ABIArgument `json:"components,omitempty"`
+}
+
+// DecodedCall the function a transaction called together with its arguments
+type DecodedCall struct {
+	Method    string         `json:"method"`
+	Signature string         `json:"signature"`
+	Params    []DecodedParam `json:"params"`
+}
+
+// DecodedParam a single decoded argument. Integers are decimal strings, addresses and bytes hex, arrays are lists and
+// tuples are lists of DecodedParam.
+type DecodedParam struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type abiKind int
+
+// abiType a parsed solidity type, size is the bit width of integers, the length of fixed bytes and of fixed arrays
+type abiType struct {
+	kind       abiKind
+	size       int
+	elem       *abiType
+	components []abiType
+	names      []string
+	canonical  string
+}
+
+// parseABIType turns the type of an argument into something the encoder and decoder can walk
+func parseABIType(argument ABIArgument) (abiType, error) {
+	typ := strings.TrimSpace(argument.Type)
+
+	// Array dimensions are read from the right, uint256[2][] is a dynamic array of uint256[2]
+	if strings.HasSuffix(typ, "]") {
+		open := strings.LastIndex(typ, "[")
+		if open < 0 {
+			return abiType{}, fmt.Errorf("%w: %v", ErrInvalidABI, typ)
+		}
+
+		elem, err := parseABIType(ABIArgument{Type: typ[:open], Components: argument.Components})
+		if err != nil {
+			return abiType{}, err
+		}
+
+		dimension := typ[open+1 : len(typ)-1]
+		if dimension == "" {
+			return abiType{kind: abiSlice, elem: &elem, canonical: elem.canonical + "[]"}, nil
+		}
+
+		length, err := strconv.Atoi(dimension)
+		if err != nil || length <= 0 {
+			return abiType{}, fmt.Errorf("%w: array length of %v", ErrInvalidABI, typ)
+		}
+
+		return abiType{kind: abiArray, size: length, elem: &elem, canonical: fmt.Sprintf("%v[%d]", elem.canonical, length)}, nil
+	}
+
+	switch {
+	case typ == "tuple":
+		tuple := abiType{kind: abiTuple}
+		var canonical []string
+		for _, component := range argument.Components {
+			parsed, err := parseABIType(component)
+			if err != nil {
+				return abiType{}, err
+			}
+			tuple.components = append(tuple.components, parsed)
+			tuple.names = append(tuple.names, component.Name)
+			canonical = append(canonical, parsed.canonical)
+		}
+		tuple.canonical = "(" + strings.Join(canonical, ",") + ")"
+		return tuple, nil
+	case typ == "address":
+		return abiType{kind: abiAddress, canonical: typ}, nil
+	case typ == "bool":
+		return abiType{kind: abiBool, canonical: typ}, nil
+	case typ == "string":
+		return abiType{kind: abiString, canonical: typ}, nil
+	case typ == "bytes":
+		return abiType{kind: abiBytes, canonical: typ}, nil
+	case typ == "function":
+		// An address followed by a selector
+		return abiType{kind: abiFixedBytes, size: 24, canonical: typ}, nil
+	case strings.HasPrefix(typ, "bytes"):
+		size, err := strconv.Atoi(strings.TrimPrefix(typ, "bytes"))
+		if err != nil || size < 1 || size > 32 {
+			return abiType{}, fmt.Errorf("%w: %v", ErrInvalidABI, typ)
+		}
+		return abiType{kind: abiFixedBytes, size: size, canonical: typ}, nil
+	case strings.HasPrefix(typ, "uint"), strings.HasPrefix(typ, "int"):
+		kind, prefix := abiUint, "uint"
+		if strings.HasPrefix(typ, "int") {
+			kind, prefix = abiInt, "int"
+		}
+
+		size := 256
+		if width := strings.TrimPrefix(typ, prefix); width != "" {
+			var err error
+			if size, err = strconv.Atoi(width); err != nil || size < 8 || size > 256 || size%8 != 0 {
+				return abiType{}, fmt.Errorf("%w: %v", ErrInvalidABI, typ)
+			}
+		}
+		return abiType{kind: kind, size: size, canonical: fmt.Sprintf("%v%d", prefix, size)}, nil
+	default:
+		return abiType{}, fmt.Errorf("%w: unsupported type %v", ErrInvalidABI, typ)
+	}
+}
+
+// dynamic whether the value is stored after the head with only its offset in place
+func (t abiType) dynamic() bool {
+	switch t.kind {
+	case abiString, abiBytes, abiSlice:
+		return true
+	case abiArray:
+		return t.elem.dynamic()
+	case abiTuple:
+		for _, component := range t.components {
+			if component.dynamic() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// headSize bytes the type takes in the head of its enclosing tuple
+func (t abiType) headSize() int {
+	if t.dynamic() {
+		return abiWord
+	}
+
+	switch t.kind {
+	case abiArray:
+		return t.size * t.elem.headSize()
+	case abiTuple:
+		var size int
+		for _, component := range t.components {
+			size += component.headSize()
+		}
+		return size
+	default:
+		return abiWord
+	}
+}
+
+// decodeABITuple decodes a sequence of values laid out head first, offsets of dynamic values count from the start of data
+func decodeABITuple(types []abiType, data []byte) ([]interface{}, error) {
+	values := make([]interface{}, len(types))
+
+	var head int
+	for i, typ := range types {
+		if typ.dynamic() {
+			offset, err := abiOffset(data, head)
+			if err != nil {
+				return nil, err
+			}
+
+			if values[i], err = decodeABIValue(typ, data[offset:]); err != nil {
+				return nil, err
+			}
+		} else {
+			if head+typ.headSize() > len(data) {
+				return nil, fmt.Errorf("%w: data too short for %v", ErrInvalidABI, typ.canonical)
+			}
+
+			var err error
+			if values[i], err = decodeABIValue(typ, data[head:]); err != nil {
+				return nil, err
+			}
+		}
+
+		head += typ.headSize()
+	}
+
+	return values, nil
+}
+
+// decodeABIValue decodes a single value whose encoding starts at the beginning of data
+func decodeABIValue(typ abiType, data []byte) (interface{}, error) {
+	switch typ.kind {
+	case abiSlice:
+		length, err := abiLength(data, typ.elem.headSize())
+		if err != nil {
+			return nil, err
+		}
+
+		return decodeABITuple(repeatABIType(*typ.elem, length), data[abiWord:])
+	case abiArray:
+		return decodeABITuple(repeatABIType(*typ.elem, typ.size), data)
+	case abiTuple:
+		values, err := decodeABITuple(typ.components, data)
+		if err != nil {
+			return nil, err
+		}
+
+		params := make([]DecodedParam, len(values))
+		for i, value := range values {
+			params[i] = DecodedParam{Name: typ.names[i], Type: typ.components[i].canonical, Value: value}
+		}
+		return params, nil
+	case abiString, abiBytes:
+		length, err := abiLength(data, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		content := data[abiWord : abiWord+length]
+		if typ.kind == abiString {
+			return string(content), nil
+		}
+		return "0x" + hex.EncodeToString(content), nil
+	}
+
+	if len(data) < abiWord {
+		return nil, fmt.Errorf("%w: data too short for %v", ErrInvalidABI, typ.canonical)
+	}
+	word := data[:abiWord]
+
+	switch typ.kind {
+	case abiUint:
+		return new(big.Int).SetBytes(word).String(), nil
+	case abiInt:
+		value := new(big.Int).SetBytes(word)
+		if word[0]&0x80 != 0 {
+			value.Sub(value, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		return value.String(), nil
+	case abiAddress:
+		return "0x" + hex.EncodeToString(word[12:]), nil
+	case abiBool:
+		return word[abiWord-1] != 0, nil
+	case abiFixedBytes:
+		return "0x" + hex.EncodeToString(word[:typ.size]), nil
+	default:
+		return nil, fmt.Errorf("%w: cannot decode %v", ErrInvalidABI, typ.canonical)
+	}
+}
+
+// encodeABICall encodes a call to a function with static, string or bytes arguments, such as balanceOf(address)
+func encodeABICall(signature string, args ...interface{}) ([]byte, error) {
+	open := strings.Index(signature, "(")
+	if open <= 0 || !strings.HasSuffix(signature, ")") || strings.Contains(signature[open+1:], "(") {
+		return nil, fmt.Errorf("%w: unsupported signature %v", ErrInvalidABI, signature)
+	}
+
+	var types []abiType
+	if inputs := signature[open+1 : len(signature)-1]; inputs != "" {
+		for _, input := range strings.Split(inputs, ",") {
+			typ, err := parseABIType(ABIArgument{Type: input})
+			if err != nil {
+				return nil, err
+			}
+			types = append(types, typ)
+		}
+	}
+
+	if len(types) != len(args) {
+		return nil, fmt.Errorf("%w: %v takes %d arguments, got %d", ErrInvalidABI, signature, len(types), len(args))
+	}
+
+	var canonical []string
+	for _, typ := range types {
+		canonical = append(canonical, typ.canonical)
+	}
+	name := signature[:open] + "(" + strings.Join(canonical, ",") + ")"
+
+	encoded, err := encodeABIArguments(types, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %v: %w", name, err)
+	}
+
+	return append(keccak256([]byte(name))[:4], encoded...), nil
+}
+
+// encodeABIArguments lays out the values head first, strings and bytes follow the head in order
+func encodeABIArguments(types []abiType, values []interface{}) ([]byte, error) {
+	var head, tail []byte
+	headSize := len(types) * abiWord
+
+	for i, typ := range types {
+		switch typ.kind {
+		case abiString, abiBytes:
+			content, ok := values[i].([]byte)
+			if text, isText := values[i].(string); isText {
+				content, ok = []byte(text), true
+			}
+			if !ok {
+				return nil, fmt.Errorf("%w: %T is not a valid %v", ErrInvalidABI, values[i], typ.canonical)
+			}
+
+			head = append(head, abiPad(new(big.Int).SetInt64(int64(headSize+len(tail))).Bytes(), true)...)
+			tail = append(tail, abiPad(new(big.Int).SetInt64(int64(len(content))).Bytes(), true)...)
+			tail = append(tail, content...)
+			if padding := len(content) % abiWord; padding != 0 {
+				tail = append(tail, make([]byte, abiWord-padding)...)
+			}
+		case abiSlice, abiArray, abiTuple:
+			return nil, fmt.Errorf("%w: encoding %v is not supported", ErrInvalidABI, typ.canonical)
+		default:
+			word, err := encodeABIWord(typ, values[i])
+			if err != nil {
+				return nil, err
+			}
+			head = append(head, word...)
+		}
+	}
+
+	return append(head, tail...), nil
+}
+
+func encodeABIWord(typ abiType, value interface{}) ([]byte, error) {
+	switch typ.kind {
+	case abiAddress:
+		address, ok := value.(string)
+		if !ok || !isAddress(address) {
+			return nil, fmt.Errorf("%w: %v is not an address", ErrInvalidABI, value)
+		}
+		raw, _ := hex.DecodeString(address[2:])
+		return abiPad(raw, true), nil
+	case abiBool:
+		flag, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T is not a bool", ErrInvalidABI, value)
+		}
+		word := make([]byte, abiWord)
+		if flag {
+			word[abiWord-1] = 1
+		}
+		return word, nil
+	case abiFixedBytes:
+		raw, ok := value.([]byte)
+		if !ok || len(raw) > typ.size {
+			return nil, fmt.Errorf("%w: %v is not a valid %v", ErrInvalidABI, value, typ.canonical)
+		}
+		return abiPad(raw, false), nil
+	case abiUint, abiInt:
+		var number *big.Int
+		switch v := value.(type) {
+		case *big.Int:
+			number = new(big.Int).Set(v)
+		case int64:
+			number = big.NewInt(v)
+		case int:
+			number = big.NewInt(int64(v))
+		case uint64:
+			number = new(big.Int).SetUint64(v)
+		default:
+			return nil, fmt.Errorf("%w: %T is not a valid %v", ErrInvalidABI, value, typ.canonical)
+		}
+
+		if number.Sign() < 0 {
+			if typ.kind == abiUint {
+				return nil, fmt.Errorf("%w: %v is negative", ErrInvalidABI, number)
+			}
+			// Two's complement over the whole word
+			number.Add(number, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+
+		if number.BitLen() > 256 {
+			return nil, fmt.Errorf("%w: %v overflows %v", ErrInvalidABI, number, typ.canonical)
+		}
+		return abiPad(number.Bytes(), true), nil
+	default:
+		return nil, fmt.Errorf("%w: encoding %v is not supported", ErrInvalidABI, typ.canonical)
+	}
+}
+
+// abiPad numbers and addresses are padded on the left, fixed bytes on the right
+func abiPad(raw []byte, left bool) []byte {
+	word := make([]byte, abiWord)
+	if left {
+		copy(word[abiWord-len(raw):], raw)
+	} else {
+		copy(word, raw)
+	}
+
+	return word
+}
+
+// abiOffset reads the offset stored at position, making sure it points inside data
+func abiOffset(data []byte, position int) (int, error) {
+	offset, err := abiUint64(data, position)
+	if err != nil {
+		return 0, err
+	}
+
+	if offset >= uint64(len(data)) {
+		return 0, fmt.Errorf("%w: offset %d out of bounds", ErrInvalidABI, offset)
+	}
+
+	return int(offset), nil
+}
+
+// abiLength reads the length prefix of a dynamic value, making sure that many items of size bytes follow it
+func abiLength(data []byte, size int) (int, error) {
+	length, err := abiUint64(data, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if length > uint64(len(data)-abiWord)/uint64(size) {
+		return 0, fmt.Errorf("%w: length %d out of bounds", ErrInvalidABI, length)
+	}
+
+	return int(length), nil
+}
+
+func abiUint64(data []byte, position int) (uint64, error) {
+	if position+abiWord > len(data) {
+		return 0, fmt.Errorf("%w: data too short", ErrInvalidABI)
+	}
+
+	value := new(big.Int).SetBytes(data[position : position+abiWord])
+	if !value.IsUint64() {
+		return 0, fmt.Errorf("%w: value %v out of bounds", ErrInvalidABI, value)
+	}
+
+	return value.Uint64(), nil
+}
+
+func repeatABIType(typ abiType, length int) []abiType {
+	types := make([]abiType, length)
+	for i := range types {
+		types[i] = typ
+	}
+
+	return types
+}
+
+// abiWord every value is padded to 32 bytes
+const abiWord = 32
+
+const (
+	abiUint abiKind = iota
+	abiInt
+	abiAddress
+	abiBool
+	abiFixedBytes
+	abiBytes
+	abiString
+	abiSlice
+	abiArray
+	abiTuple
+)
@@ -0,0 +1,145 @@
+package ethereum_parser
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ABIRegistry known functions by 4-byte selector, built from JSON ABIs
+type ABIRegistry struct {
+	methods map[string]abiMethod
+}
+
+type abiMethod struct {
+	name      string
+	signature string
+	inputs    []abiType
+	names     []string
+}
+
+// abiEntry a single item of a JSON ABI, only functions are of interest
+type abiEntry struct {
+	Type   string        `json:"type"`
+	Name   string        `json:"name"`
+	Inputs []ABIArgument `json:"inputs"`
+}
+
+// Add registers the functions of a JSON ABI, either the plain list or a compiler artifact with an abi field
+func (r *ABIRegistry) Add(data []byte) error {
+	var entries []abiEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		var artifact struct {
+			ABI []abiEntry `json:"abi"`
+		}
+		if err := json.Unmarshal(data, &artifact); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidABI, err)
+		}
+		entries = artifact.ABI
+	}
+
+	for _, entry := range entries {
+		// Entries without a type are functions in older ABIs
+		if entry.Type != "function" && entry.Type != "" {
+			continue
+		}
+
+		method := abiMethod{name: entry.Name}
+		var canonical []string
+		for _, input := range entry.Inputs {
+			typ, err := parseABIType(input)
+			if err != nil {
+				return fmt.Errorf("function %v: %w", entry.Name, err)
+			}
+			method.inputs = append(method.inputs, typ)
+			method.names = append(method.names, input.Name)
+			canonical = append(canonical, typ.canonical)
+		}
+		method.signature = entry.Name + "(" + strings.Join(canonical, ",") + ")"
+
+		// The same function shows up in plenty of ABIs, the first one keeps its argument names
+		selector := abiSelector(method.signature)
+		if _, ok := r.methods[selector]; !ok {
+			r.methods[selector] = method
+		}
+	}
+
+	return nil
+}
+
+// Decode resolves the function called by the input and decodes its arguments, nil when the selector is unknown
+func (r *ABIRegistry) Decode(input string) (*DecodedCall, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(input, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: input is not hex", ErrInvalidABI)
+	}
+
+	if len(data) < 4 {
+		return nil, nil
+	}
+
+	method, ok := r.methods[hex.EncodeToString(data[:4])]
+	if !ok {
+		return nil, nil
+	}
+
+	values, err := decodeABITuple(method.inputs, data[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %v: %w", method.signature, err)
+	}
+
+	call := &DecodedCall{Method: method.name, Signature: method.signature, Params: make([]DecodedParam, len(values))}
+	for i, value := range values {
+		call.Params[i] = DecodedParam{Name: method.names[i], Type: method.inputs[i].canonical, Value: value}
+	}
+
+	return call, nil
+}
+
+// Len number of known functions
+func (r *ABIRegistry) Len() int {
+	return len(r.methods)
+}
+
+// LoadABIRegistry reads every .json file under the directory, compiler artifacts included
+func LoadABIRegistry(dir string) (*ABIRegistry, error) {
+	registry := NewABIRegistry()
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if err := registry.Add(data); err != nil {
+			return fmt.Errorf("failed to load abi %v: %w", path, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+func NewABIRegistry() *ABIRegistry {
+	return &ABIRegistry{methods: make(map[string]abiMethod)}
+}
+
+// abiSelector first 4 bytes of the hash of the canonical signature, hex without prefix
+func abiSelector(signature string) string {
+	return hex.EncodeToString(keccak256([]byte(signature))[:4])
+}
@@ -0,0 +1,98 @@
+package ethereum_parser_test
+
+import (
+	eth "ethereum_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const erc20ABI = `[
+	{"type": "function", "name": "transfer", "inputs": [{"name": "to", "type": "address"}, {"name": "amount", "type": "uint256"}]},
+	{"type": "event", "name": "Transfer", "inputs": [{"name": "from", "type": "address", "indexed": true}]}
+]`
+
+// executeArtifact compiler artifact of a function mixing dynamic types, arrays and tuples
+const executeArtifact = `{"contractName": "Executor", "abi": [
+	{"type": "function", "name": "execute", "inputs": [
+		{"name": "note", "type": "string"},
+		{"name": "amounts", "type": "uint256[]"},
+		{"name": "call", "type": "tuple", "components": [{"name": "target", "type": "address"}, {"name": "data", "type": "bytes"}]},
+		{"name": "delta", "type": "int8"}
+	]}
+]}`
+
+func TestABIRegistry_Decode(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "erc20.json"), []byte(erc20ABI), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "artifacts"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "artifacts", "Executor.json"), []byte(executeArtifact), 0o600))
+
+	registry, err := eth.LoadABIRegistry(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, registry.Len())
+
+	t.Run("static arguments", func(t *testing.T) {
+		decoded, err := registry.Decode("0xa9059cbb" +
+			"000000000000000000000000dac17f958d2ee523a2206206994597c13d831ec7" +
+			"00000000000000000000000000000000000000000000000000000000000f4240")
+		require.NoError(t, err)
+		require.NotNil(t, decoded)
+
+		assert.Equal(t, "transfer(address,uint256)", decoded.Signature)
+		assert.Equal(t, []eth.DecodedParam{
+			{Name: "to", Type: "address", Value: token},
+			{Name: "amount", Type: "uint256", Value: "1000000"},
+		}, decoded.Params)
+	})
+
+	t.Run("dynamic arguments", func(t *testing.T) {
+		decoded, err := registry.Decode("0xdf961d85" + strings.Join([]string{
+			// head: offsets of note, amounts and call followed by delta
+			"0000000000000000000000000000000000000000000000000000000000000080",
+			"00000000000000000000000000000000000000000000000000000000000000c0",
+			"0000000000000000000000000000000000000000000000000000000000000120",
+			"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			// note
+			"0000000000000000000000000000000000000000000000000000000000000005",
+			"68656c6c6f000000000000000000000000000000000000000000000000000000",
+			// amounts
+			"0000000000000000000000000000000000000000000000000000000000000002",
+			"0000000000000000000000000000000000000000000000000000000000000001",
+			"0000000000000000000000000000000000000000000000000000000000000002",
+			// call: target and the offset of data within the tuple
+			"000000000000000000000000dac17f958d2ee523a2206206994597c13d831ec7",
+			"0000000000000000000000000000000000000000000000000000000000000040",
+			"0000000000000000000000000000000000000000000000000000000000000002",
+			"beef000000000000000000000000000000000000000000000000000000000000",
+		}, ""))
+		require.NoError(t, err)
+		require.NotNil(t, decoded)
+
+		assert.Equal(t, "execute", decoded.Method)
+		assert.Equal(t, "execute(string,uint256[],(address,bytes),int8)", decoded.Signature)
+		assert.Equal(t, []eth.DecodedParam{
+			{Name: "note", Type: "string", Value: "hello"},
+			{Name: "amounts", Type: "uint256[]", Value: []interface{}{"1", "2"}},
+			{Name: "call", Type: "(address,bytes)", Value: []eth.DecodedParam{
+				{Name: "target", Type: "address", Value: token},
+				{Name: "data", Type: "bytes", Value: "0xbeef"},
+			}},
+			{Name: "delta", Type: "int8", Value: "-1"},
+		}, decoded.Params)
+	})
+
+	t.Run("unknown selector", func(t *testing.T) {
+		decoded, err := registry.Decode("0x12345678")
+		require.NoError(t, err)
+		assert.Nil(t, decoded)
+	})
+
+	t.Run("offset out of bounds", func(t *testing.T) {
+		_, err := registry.Decode("0xdf961d85" + strings.Repeat("f", 64*4))
+		assert.ErrorIs(t, err, eth.ErrInvalidABI)
+	})
+}
@@ -2,8 +2,13 @@ package ethereum_parser
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type HttpHandlers struct {
@@ -11,9 +16,16 @@ type HttpHandlers struct {
 }
 
 func (h *HttpHandlers) GetCurrentBlock(w http.ResponseWriter, r *http.Request) {
-	block, err := h.service.GetCurrentBlock(r.Context())
+	chainID, err := chainIDParameter(r.URL.Query())
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	block, err := h.service.GetCurrentBlock(r.Context(), chainID)
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
 		_, _ = w.Write([]byte((err.Error())))
 		return
 	}
@@ -26,10 +38,21 @@ func (h *HttpHandlers) GetCurrentBlock(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *HttpHandlers) Subscribe(w http.ResponseWriter, r *http.Request) {
-	// Can add a check that responds accordingly if address missing
-	hasSubscribed, err := h.service.Subscribe(r.Context(), r.URL.Query().Get(addressParam))
+	options, err := subscriptionOptions(r.URL.Query())
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	if r.URL.Query().Has(xpubParam) {
+		h.subscribeWallet(w, r, options)
+		return
+	}
+
+	hasSubscribed, err := h.service.Subscribe(r.Context(), r.URL.Query().Get(addressParam), options)
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
 		_, _ = w.Write([]byte(err.Error()))
 		return
 	}
@@ -40,10 +63,77 @@ func (h *HttpHandlers) Subscribe(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// subscribeWallet subscribes the addresses derived from an xpub, responding with the wallet
+func (h *HttpHandlers) subscribeWallet(w http.ResponseWriter, r *http.Request, options SubscriptionOptions) {
+	var gapLimit int
+	if value := r.URL.Query().Get(gapLimitParam); value != "" {
+		var err error
+		if gapLimit, err = strconv.Atoi(value); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("gapLimit should be a number"))
+			return
+		}
+	}
+
+	wallet, err := h.service.SubscribeWallet(r.Context(), r.URL.Query().Get(xpubParam), r.URL.Query().Get(pathParam), gapLimit, options)
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(wallet); err != nil {
+		http.Error(w, fmt.Sprintf("error building the responsse, %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (h *HttpHandlers) GetWallet(w http.ResponseWriter, r *http.Request) {
+	wallet, err := h.service.GetWallet(r.Context(), r.URL.Query().Get(idParam))
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(wallet); err != nil {
+		http.Error(w, fmt.Sprintf("error building the responsse, %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (h *HttpHandlers) GetWalletTransactions(w http.ResponseWriter, r *http.Request) {
+	query, err := transactionQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	transactions, err := h.service.GetWalletTransactions(r.Context(), r.URL.Query().Get(idParam), query)
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(transactions); err != nil {
+		http.Error(w, fmt.Sprintf("error building the responsse, %v", err), http.StatusInternalServerError)
+	}
+}
+
 func (h *HttpHandlers) GetTransactions(w http.ResponseWriter, r *http.Request) {
-	transactions, err := h.service.GetTransactions(r.Context(), r.URL.Query().Get(addressParam))
+	query, err := transactionQuery(r.URL.Query())
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	transactions, err := h.service.GetTransactions(r.Context(), query)
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
 		_, _ = w.Write([]byte(err.Error()))
 		return
 	}
@@ -55,6 +145,322 @@ func (h *HttpHandlers) GetTransactions(w http.ResponseWriter, r *http.Request) {
 
 }
 
+func (h *HttpHandlers) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
+	query, err := transactionQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	withdrawals, err := h.service.GetWithdrawals(r.Context(), query)
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(withdrawals); err != nil {
+		http.Error(w, fmt.Sprintf("error building the responsse, %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (h *HttpHandlers) GetBalances(w http.ResponseWriter, r *http.Request) {
+	chainID, err := chainIDParameter(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	balances, err := h.service.GetBalances(r.Context(), r.URL.Query().Get(addressParam), chainID)
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(balances); err != nil {
+		http.Error(w, fmt.Sprintf("error building the responsse, %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (h *HttpHandlers) GetChains(w http.ResponseWriter, r *http.Request) {
+	chains, err := h.service.GetChains(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(chains); err != nil {
+		http.Error(w, fmt.Sprintf("error building the responsse, %v", err), http.StatusInternalServerError)
+	}
+}
+
+// GetHealth the chains like /chains, answering 503 while any of their parsers or pending watchers is not running so
+// the API can be up with parsing degraded
+func (h *HttpHandlers) GetHealth(w http.ResponseWriter, r *http.Request) {
+	chains, err := h.service.GetChains(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	status := http.StatusOK
+	for _, chain := range chains {
+		if chain.Parser != nil && chain.Parser.State != ParserStateRunning {
+			status = http.StatusServiceUnavailable
+		}
+		if chain.Pending != nil && chain.Pending.State != ParserStateRunning {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err = json.NewEncoder(w).Encode(chains); err != nil {
+		http.Error(w, fmt.Sprintf("error building the responsse, %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (h *HttpHandlers) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	deadLetters, err := h.service.GetDeadLetters(r.Context(), r.URL.Query().Get(sinkParam))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(deadLetters); err != nil {
+		http.Error(w, fmt.Sprintf("error building the responsse, %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (h *HttpHandlers) GetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	deadLetter, err := h.service.GetDeadLetter(r.Context(), r.URL.Query().Get(idParam))
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(deadLetter); err != nil {
+		http.Error(w, fmt.Sprintf("error building the responsse, %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (h *HttpHandlers) ReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if !allowPost(w, r) {
+		return
+	}
+
+	id := r.URL.Query().Get(idParam)
+	if err := h.service.ReplayDeadLetter(r.Context(), id); err != nil {
+		w.WriteHeader(errorStatus(err))
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(fmt.Sprintf("replayed %v", id)); err != nil {
+		http.Error(w, fmt.Sprintf("error building the responsse, %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (h *HttpHandlers) DiscardDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if !allowPost(w, r) {
+		return
+	}
+
+	id := r.URL.Query().Get(idParam)
+	if err := h.service.DiscardDeadLetter(r.Context(), id); err != nil {
+		w.WriteHeader(errorStatus(err))
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(fmt.Sprintf("discarded %v", id)); err != nil {
+		http.Error(w, fmt.Sprintf("error building the responsse, %v", err), http.StatusInternalServerError)
+	}
+}
+
+func (h *HttpHandlers) GetDeadLetterStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.service.GetDeadLetterStats(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(stats); err != nil {
+		http.Error(w, fmt.Sprintf("error building the responsse, %v", err), http.StatusInternalServerError)
+	}
+}
+
+// subscriptionOptions reads the options of a subscription, assets can be repeated or comma separated
+func subscriptionOptions(query url.Values) (SubscriptionOptions, error) {
+	options := SubscriptionOptions{
+		Direction: Direction(query.Get(directionParam)),
+		MinValue:  query.Get(minValueParam),
+	}
+
+	for _, assets := range query[assetParam] {
+		for _, asset := range strings.Split(assets, ",") {
+			if asset = strings.TrimSpace(asset); asset != "" {
+				options.Assets = append(options.Assets, asset)
+			}
+		}
+	}
+
+	if includeFailed := query.Get(includeFailedParam); includeFailed != "" {
+		value, err := strconv.ParseBool(includeFailed)
+		if err != nil {
+			return SubscriptionOptions{}, fmt.Errorf("%w: includeFailed should be true or false", ErrInvalidSubscription)
+		}
+		options.IncludeFailed = value
+	}
+
+	options.Delivery = Delivery(query.Get(deliveryParam))
+
+	if window := query.Get(digestWindowParam); window != "" {
+		value, err := time.ParseDuration(window)
+		if err != nil {
+			return SubscriptionOptions{}, fmt.Errorf("%w: digestWindow should be a duration such as 10m", ErrInvalidSubscription)
+		}
+		options.DigestWindow = value
+	}
+
+	if size := query.Get(digestSizeParam); size != "" {
+		value, err := strconv.Atoi(size)
+		if err != nil {
+			return SubscriptionOptions{}, fmt.Errorf("%w: digestSize should be a number", ErrInvalidSubscription)
+		}
+		options.DigestSize = value
+	}
+
+	return options, nil
+}
+
+// chainIDParameter reads the optional chain id, decimal or hex
+func chainIDParameter(query url.Values) (int64, error) {
+	value := query.Get(chainIDParam)
+	if value == "" {
+		return 0, nil
+	}
+
+	chainID, err := strconv.ParseInt(value, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("chainId should be a number")
+	}
+
+	return chainID, nil
+}
+
+// transactionQuery reads the address, chain and ranges shared by the transaction and withdrawal listings
+func transactionQuery(values url.Values) (TransactionQuery, error) {
+	chainID, err := chainIDParameter(values)
+	if err != nil {
+		return TransactionQuery{}, err
+	}
+
+	query := TransactionQuery{
+		Address: values.Get(addressParam),
+		ChainID: chainID,
+	}
+
+	for _, kinds := range values[kindParam] {
+		for _, kind := range strings.Split(kinds, ",") {
+			if kind = strings.TrimSpace(kind); kind != "" {
+				query.Kinds = append(query.Kinds, TransactionKind(kind))
+			}
+		}
+	}
+
+	if query.From, err = timeParameter(values, fromParam); err != nil {
+		return TransactionQuery{}, err
+	}
+
+	if query.To, err = timeParameter(values, toParam); err != nil {
+		return TransactionQuery{}, err
+	}
+
+	if query.FromBlock, err = blockParameter(values, fromBlockParam); err != nil {
+		return TransactionQuery{}, err
+	}
+
+	if query.ToBlock, err = blockParameter(values, toBlockParam); err != nil {
+		return TransactionQuery{}, err
+	}
+
+	return query, nil
+}
+
+// timeParameter accepts RFC 3339 or unix seconds
+func timeParameter(values url.Values, name string) (time.Time, error) {
+	value := values.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%v should be an RFC 3339 time or unix seconds", name)
+	}
+
+	return parsed.UTC(), nil
+}
+
+func blockParameter(values url.Values, name string) (int64, error) {
+	value := values.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	number, err := strconv.ParseInt(value, 0, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("%v should be a block number", name)
+	}
+
+	return number, nil
+}
+
+// allowPost refuses anything but a POST with a 405, endpoints changing state must not be triggered by a crawler or a
+// link prefetch
+func allowPost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodPost {
+		return true
+	}
+
+	w.Header().Set("Allow", http.MethodPost)
+	http.Error(w, fmt.Sprintf("%v is not allowed, use POST", r.Method), http.StatusMethodNotAllowed)
+	return false
+}
+
+// errorStatus errors caused by the request are the client's problem, anything else is ours
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidSubscription), errors.Is(err, ErrInvalidQuery):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrDeadLetterNotFound), errors.Is(err, ErrUnknownChain), errors.Is(err, ErrWalletNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func NewHTTPHandlers(service Service) HttpHandlers {
 	return HttpHandlers{
 		service: service,
@@ -66,8 +472,41 @@ func CreateAPIMux(h HttpHandlers) *http.ServeMux {
 	mux.HandleFunc("/subscribe", h.Subscribe)
 	mux.HandleFunc("/currentBlock", h.GetCurrentBlock)
 	mux.HandleFunc("/transactions", h.GetTransactions)
+	mux.HandleFunc("/withdrawals", h.GetWithdrawals)
+	mux.HandleFunc("/balance", h.GetBalances)
+	mux.HandleFunc("/chains", h.GetChains)
+	mux.HandleFunc("/health", h.GetHealth)
+	mux.HandleFunc("/wallet", h.GetWallet)
+	mux.HandleFunc("/wallet/transactions", h.GetWalletTransactions)
+
+	// Admin endpoints for events that could not be delivered
+	mux.HandleFunc("/admin/deadLetters", h.GetDeadLetters)
+	mux.HandleFunc("/admin/deadLetters/stats", h.GetDeadLetterStats)
+	mux.HandleFunc("/admin/deadLetter", h.GetDeadLetter)
+	mux.HandleFunc("/admin/deadLetter/replay", h.ReplayDeadLetter)
+	mux.HandleFunc("/admin/deadLetter/discard", h.DiscardDeadLetter)
 
 	return mux
 }
 
-const addressParam = "address"
+const (
+	addressParam       = "address"
+	directionParam     = "direction"
+	minValueParam      = "minValue"
+	assetParam         = "asset"
+	includeFailedParam = "includeFailed"
+	deliveryParam      = "delivery"
+	digestWindowParam  = "digestWindow"
+	digestSizeParam    = "digestSize"
+	sinkParam          = "sink"
+	idParam            = "id"
+	chainIDParam       = "chainId"
+	fromParam          = "from"
+	toParam            = "to"
+	fromBlockParam     = "fromBlock"
+	toBlockParam       = "toBlock"
+	kindParam          = "kind"
+	xpubParam          = "xpub"
+	pathParam          = "path"
+	gapLimitParam      = "gapLimit"
+)
@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"ethereum_parser"
+	"ethereum_parser/chaintest"
 	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 type APITestSuite struct {
@@ -23,7 +27,7 @@ func (suite *APITestSuite) SetupSuite() {
 }
 
 func (suite *APITestSuite) TestSubscriberSuccess() {
-	suite.service.SubscribeTD = func(ctx context.Context, receivedAddress string) (bool, error) {
+	suite.service.SubscribeTD = func(ctx context.Context, receivedAddress string, options ethereum_parser.SubscriptionOptions) (bool, error) {
 		suite.Equal(address, receivedAddress)
 		return true, nil
 	}
@@ -43,7 +47,7 @@ func (suite *APITestSuite) TestSubscriberSuccess() {
 }
 
 func (suite *APITestSuite) TestSubscriberUnSuccessful() {
-	suite.service.SubscribeTD = func(ctx context.Context, receivedAddress string) (bool, error) {
+	suite.service.SubscribeTD = func(ctx context.Context, receivedAddress string, options ethereum_parser.SubscriptionOptions) (bool, error) {
 		suite.Equal(address, receivedAddress)
 		return false, fmt.Errorf("there was an error trying to subscribe")
 	}
@@ -60,34 +64,315 @@ func (suite *APITestSuite) TestSubscriberUnSuccessful() {
 	suite.Require().Equal(http.StatusInternalServerError, w.Code)
 }
 
+func (suite *APITestSuite) TestSubscriberWithOptions() {
+	suite.service.SubscribeTD = func(ctx context.Context, receivedAddress string, options ethereum_parser.SubscriptionOptions) (bool, error) {
+		suite.Equal(address, receivedAddress)
+		suite.Equal(ethereum_parser.SubscriptionOptions{
+			Direction:     ethereum_parser.DirectionIncoming,
+			MinValue:      "1000",
+			Assets:        []string{"ETH", token},
+			IncludeFailed: true,
+		}, options)
+		return true, nil
+	}
+
+	r, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/subscribe?address=%v&direction=incoming&minValue=1000&asset=ETH,%v&includeFailed=true", address, token), nil)
+	suite.Require().NoError(err)
+
+	w := httptest.NewRecorder()
+	suite.handler.ServeHTTP(w, r)
+
+	suite.Require().Equal(http.StatusOK, w.Code)
+}
+
+func (suite *APITestSuite) TestSubscriberInvalidOptions() {
+	r, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/subscribe?address=%v&includeFailed=maybe", address), nil)
+	suite.Require().NoError(err)
+
+	w := httptest.NewRecorder()
+	suite.handler.ServeHTTP(w, r)
+
+	suite.Require().Equal(http.StatusBadRequest, w.Code)
+}
+
+func (suite *APITestSuite) TestSubscribeWallet() {
+	suite.service.SubscribeWalletTD = func(ctx context.Context, xpub string, path string, gapLimit int, options ethereum_parser.SubscriptionOptions) (ethereum_parser.Wallet, error) {
+		suite.Equal("xpub123", xpub)
+		suite.Equal("0", path)
+		suite.Equal(5, gapLimit)
+		suite.Equal(ethereum_parser.DirectionIncoming, options.Direction)
+		return ethereum_parser.Wallet{ID: "a1b2", Addresses: []ethereum_parser.WalletAddress{{Address: address}}}, nil
+	}
+
+	r, err := http.NewRequest(http.MethodPost, "/subscribe?xpub=xpub123&path=0&gapLimit=5&direction=incoming", nil)
+	suite.Require().NoError(err)
+
+	w := httptest.NewRecorder()
+	suite.handler.ServeHTTP(w, r)
+
+	var actual ethereum_parser.Wallet
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &actual))
+	suite.Require().Equal(http.StatusOK, w.Code)
+	suite.Equal("a1b2", actual.ID)
+}
+
+func (suite *APITestSuite) TestGetWalletNotFound() {
+	suite.service.GetWalletTransactionsTD = func(ctx context.Context, id string, query ethereum_parser.TransactionQuery) ([]ethereum_parser.Transaction, error) {
+		return nil, ethereum_parser.ErrWalletNotFound
+	}
+
+	r, err := http.NewRequest(http.MethodGet, "/wallet/transactions?id=missing", nil)
+	suite.Require().NoError(err)
+
+	w := httptest.NewRecorder()
+	suite.handler.ServeHTTP(w, r)
+
+	suite.Require().Equal(http.StatusNotFound, w.Code)
+}
+
+func (suite *APITestSuite) TestGetTransactionsByChain() {
+	suite.service.GetTransactionsTD = func(ctx context.Context, query ethereum_parser.TransactionQuery) ([]ethereum_parser.Transaction, error) {
+		suite.Equal(ethereum_parser.TransactionQuery{Address: address, ChainID: 137}, query)
+		return []ethereum_parser.Transaction{{Hash: "0x01", ChainID: "0x89"}}, nil
+	}
+
+	r, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/transactions?address=%v&chainId=0x89", address), nil)
+	suite.Require().NoError(err)
+
+	w := httptest.NewRecorder()
+	suite.handler.ServeHTTP(w, r)
+
+	var actual []ethereum_parser.Transaction
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &actual))
+	suite.Require().Equal(http.StatusOK, w.Code)
+	suite.Equal("0x89", actual[0].ChainID)
+}
+
+func (suite *APITestSuite) TestGetTransactionsByRange() {
+	suite.service.GetTransactionsTD = func(ctx context.Context, query ethereum_parser.TransactionQuery) ([]ethereum_parser.Transaction, error) {
+		suite.Equal(ethereum_parser.TransactionQuery{
+			Address:   address,
+			From:      time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			To:        time.Unix(1709856000, 0).UTC(),
+			FromBlock: 19000000,
+			ToBlock:   0x1220000,
+		}, query)
+		return []ethereum_parser.Transaction{}, nil
+	}
+
+	r, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/transactions?address=%v&from=2024-03-01T00:00:00Z&to=1709856000&fromBlock=19000000&toBlock=0x1220000", address), nil)
+	suite.Require().NoError(err)
+
+	w := httptest.NewRecorder()
+	suite.handler.ServeHTTP(w, r)
+
+	suite.Require().Equal(http.StatusOK, w.Code)
+}
+
+func (suite *APITestSuite) TestGetTransactionsByKind() {
+	suite.service.GetTransactionsTD = func(ctx context.Context, query ethereum_parser.TransactionQuery) ([]ethereum_parser.Transaction, error) {
+		suite.Equal([]ethereum_parser.TransactionKind{ethereum_parser.TransactionKindContractCall, ethereum_parser.TransactionKindTokenTransfer}, query.Kinds)
+		return []ethereum_parser.Transaction{}, nil
+	}
+
+	r, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/transactions?address=%v&kind=contractCall,tokenTransfer", address), nil)
+	suite.Require().NoError(err)
+
+	w := httptest.NewRecorder()
+	suite.handler.ServeHTTP(w, r)
+
+	suite.Require().Equal(http.StatusOK, w.Code)
+}
+
+func (suite *APITestSuite) TestGetTransactionsInvalidRange() {
+	r, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/transactions?address=%v&from=last-week", address), nil)
+	suite.Require().NoError(err)
+
+	w := httptest.NewRecorder()
+	suite.handler.ServeHTTP(w, r)
+
+	suite.Require().Equal(http.StatusBadRequest, w.Code)
+}
+
+func (suite *APITestSuite) TestReplayDeadLetterNotFound() {
+	suite.service.ReplayDeadLetterTD = func(ctx context.Context, id string) error {
+		suite.Equal(deadLetterID, id)
+		return ethereum_parser.ErrDeadLetterNotFound
+	}
+
+	r, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/admin/deadLetter/replay?id=%v", deadLetterID), nil)
+	suite.Require().NoError(err)
+
+	w := httptest.NewRecorder()
+	suite.handler.ServeHTTP(w, r)
+
+	suite.Require().Equal(http.StatusNotFound, w.Code)
+}
+
+func (suite *APITestSuite) TestDeadLetterMethodNotAllowed() {
+	suite.service.ReplayDeadLetterTD = func(ctx context.Context, id string) error {
+		suite.Fail("replayed on a GET")
+		return nil
+	}
+	suite.service.DiscardDeadLetterTD = func(ctx context.Context, id string) error {
+		suite.Fail("discarded on a GET")
+		return nil
+	}
+
+	for _, path := range []string{"/admin/deadLetter/replay", "/admin/deadLetter/discard"} {
+		r, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%v?id=%v", path, deadLetterID), nil)
+		suite.Require().NoError(err)
+
+		w := httptest.NewRecorder()
+		suite.handler.ServeHTTP(w, r)
+
+		suite.Equal(http.StatusMethodNotAllowed, w.Code, path)
+		suite.Equal(http.MethodPost, w.Header().Get("Allow"), path)
+	}
+}
+
 func TestAPI(t *testing.T) {
 	suite.Run(t, &APITestSuite{})
 }
 
+// TestAPIEndToEnd subscribes through the API, parses a simulated chain and lists what was parsed through the API again
+func TestAPIEndToEnd(t *testing.T) {
+	node := chaintest.NewChain(1)
+	defer node.Close()
+	node.Mine()
+
+	ctx := context.Background()
+	chain, err := ethereum_parser.NewChain(ctx, ethereum_parser.ChainConfig{
+		Name:         "simulated",
+		RPCURL:       node.URL(),
+		PollInterval: ethereum_parser.Duration(time.Second),
+		PollMode:     ethereum_parser.PollModeNumber,
+		StartBlock:   2,
+	}, "2.0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), chain.Config.ChainID)
+
+	repo := ethereum_parser.NewMemStorage()
+	deadLetters := ethereum_parser.NewMemDeadLetterStorage()
+	notifier := ethereum_parser.NewNotifier(ethereum_parser.NotifierConfig{MaxAttempts: 1}, &deadLetters, &recordingSink{})
+	digester := ethereum_parser.NewDigester(notifier)
+
+	service := ethereum_parser.NewService(&repo, &deadLetters, []ethereum_parser.Chain{chain}, notifier, nil, nil, nil)
+	server := httptest.NewServer(ethereum_parser.CreateAPIMux(ethereum_parser.NewHTTPHandlers(&service)))
+	defer server.Close()
+
+	response, err := http.Post(fmt.Sprintf("%v/subscribe?address=%v", server.URL, address), "", nil)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	block := node.Mine(ethereum_parser.Transaction{From: counterparty, To: address, Value: "0x1"})
+
+	parser, err := ethereum_parser.NewParserService(chain.Config, &repo, chain.Client, notifier, &digester, nil, nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, parser.Sync(ctx))
+
+	response, err = http.Get(fmt.Sprintf("%v/transactions?address=%v&chainId=1", server.URL, address))
+	require.NoError(t, err)
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	var transactions []ethereum_parser.Transaction
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&transactions))
+	require.Len(t, transactions, 1)
+	assert.Equal(t, block.Transactions[0].Hash, transactions[0].Hash)
+	assert.Equal(t, ethereum_parser.TransactionKindTransfer, transactions[0].Kind)
+}
+
 // Implement test double, only the subscribe has been tested above the rest are left for demonstration purposes
 var _ ethereum_parser.Service = ServiceTestDouble{}
 
 type ServiceTestDouble struct {
-	GetCurrentBlockTD func(ctx context.Context) (int64, error)
+	GetCurrentBlockTD func(ctx context.Context, chainID int64) (int64, error)
+
+	GetChainsTD func(ctx context.Context) ([]ethereum_parser.ChainStatus, error)
 
 	// Subscribe add address to observer
-	SubscribeTD func(ctx context.Context, address string) (bool, error)
+	SubscribeTD func(ctx context.Context, address string, options ethereum_parser.SubscriptionOptions) (bool, error)
 
 	// GetTransactions list of inbound or outbound transactions for an address
-	GetTransactionsTD func(ctx context.Context, address string) ([]ethereum_parser.Transaction, error)
+	GetTransactionsTD func(ctx context.Context, query ethereum_parser.TransactionQuery) ([]ethereum_parser.Transaction, error)
+
+	// GetWithdrawals list of beacon chain withdrawals credited to an address
+	GetWithdrawalsTD func(ctx context.Context, query ethereum_parser.TransactionQuery) ([]ethereum_parser.Withdrawal, error)
+
+	SubscribeWalletTD       func(ctx context.Context, xpub string, path string, gapLimit int, options ethereum_parser.SubscriptionOptions) (ethereum_parser.Wallet, error)
+	GetWalletTD             func(ctx context.Context, id string) (ethereum_parser.Wallet, error)
+	GetWalletTransactionsTD func(ctx context.Context, id string, query ethereum_parser.TransactionQuery) ([]ethereum_parser.Transaction, error)
+
+	GetBalancesTD func(ctx context.Context, address string, chainID int64) ([]ethereum_parser.Balance, error)
+
+	GetDeadLettersTD     func(ctx context.Context, sink string) ([]ethereum_parser.DeadLetter, error)
+	GetDeadLetterTD      func(ctx context.Context, id string) (ethereum_parser.DeadLetter, error)
+	ReplayDeadLetterTD   func(ctx context.Context, id string) error
+	DiscardDeadLetterTD  func(ctx context.Context, id string) error
+	GetDeadLetterStatsTD func(ctx context.Context) ([]ethereum_parser.DeadLetterStats, error)
+}
+
+func (s ServiceTestDouble) GetCurrentBlock(ctx context.Context, chainID int64) (int64, error) {
+	return s.GetCurrentBlockTD(ctx, chainID)
+}
+
+func (s ServiceTestDouble) GetChains(ctx context.Context) ([]ethereum_parser.ChainStatus, error) {
+	return s.GetChainsTD(ctx)
+}
+
+func (s ServiceTestDouble) Subscribe(ctx context.Context, address string, options ethereum_parser.SubscriptionOptions) (bool, error) {
+	return s.SubscribeTD(ctx, address, options)
+}
+
+func (s ServiceTestDouble) GetTransactions(ctx context.Context, query ethereum_parser.TransactionQuery) ([]ethereum_parser.Transaction, error) {
+	return s.GetTransactionsTD(ctx, query)
+}
+
+func (s ServiceTestDouble) GetWithdrawals(ctx context.Context, query ethereum_parser.TransactionQuery) ([]ethereum_parser.Withdrawal, error) {
+	return s.GetWithdrawalsTD(ctx, query)
+}
+
+func (s ServiceTestDouble) SubscribeWallet(ctx context.Context, xpub string, path string, gapLimit int, options ethereum_parser.SubscriptionOptions) (ethereum_parser.Wallet, error) {
+	return s.SubscribeWalletTD(ctx, xpub, path, gapLimit, options)
+}
+
+func (s ServiceTestDouble) GetWallet(ctx context.Context, id string) (ethereum_parser.Wallet, error) {
+	return s.GetWalletTD(ctx, id)
+}
+
+func (s ServiceTestDouble) GetWalletTransactions(ctx context.Context, id string, query ethereum_parser.TransactionQuery) ([]ethereum_parser.Transaction, error) {
+	return s.GetWalletTransactionsTD(ctx, id, query)
+}
+
+func (s ServiceTestDouble) GetBalances(ctx context.Context, address string, chainID int64) ([]ethereum_parser.Balance, error) {
+	return s.GetBalancesTD(ctx, address, chainID)
+}
+
+func (s ServiceTestDouble) GetDeadLetters(ctx context.Context, sink string) ([]ethereum_parser.DeadLetter, error) {
+	return s.GetDeadLettersTD(ctx, sink)
+}
+
+func (s ServiceTestDouble) GetDeadLetter(ctx context.Context, id string) (ethereum_parser.DeadLetter, error) {
+	return s.GetDeadLetterTD(ctx, id)
 }
 
-func (s ServiceTestDouble) GetCurrentBlock(ctx context.Context) (int64, error) {
-	return s.GetCurrentBlockTD(ctx)
+func (s ServiceTestDouble) ReplayDeadLetter(ctx context.Context, id string) error {
+	return s.ReplayDeadLetterTD(ctx, id)
 }
 
-func (s ServiceTestDouble) Subscribe(ctx context.Context, address string) (bool, error) {
-	return s.SubscribeTD(ctx, address)
+func (s ServiceTestDouble) DiscardDeadLetter(ctx context.Context, id string) error {
+	return s.DiscardDeadLetterTD(ctx, id)
 }
 
-func (s ServiceTestDouble) GetTransactions(ctx context.Context, address string) ([]ethereum_parser.Transaction, error) {
-	return s.GetTransactionsTD(ctx, address)
+func (s ServiceTestDouble) GetDeadLetterStats(ctx context.Context) ([]ethereum_parser.DeadLetterStats, error) {
+	return s.GetDeadLetterStatsTD(ctx)
 }
 
 const address = "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+const token = "0xdac17f958d2ee523a2206206994597c13d831ec7"
 const subscribedTrue = "subscribed true"
+const deadLetterID = "3f1c0a3b8a5e4c2d9b7e6f5a4d3c2b1a"
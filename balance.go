@@ -0,0 +1,271 @@
+package ethereum_parser
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+type BalanceConfig struct {
+	Enabled bool `env:"BALANCES_ENABLED" envDefault:"false"`
+	// ReconcileInterval how often the tracked balances are compared with what the node reports
+	ReconcileInterval time.Duration `env:"BALANCE_RECONCILE_INTERVAL" envDefault:"10m"`
+}
+
+// Balance of a single asset held by a subscribed address, derived from the parsed transfers and fees
+type Balance struct {
+	Address string `json:"address"`
+	ChainID string `json:"chainId"`
+	// Asset ETH or the token address
+	Asset   string `json:"asset"`
+	Balance string `json:"balance"`
+	// Symbol and Amount, the balance scaled by the decimals, are filled in when the token metadata is known
+	Symbol string `json:"symbol,omitempty"`
+	Amount string `json:"amount,omitempty"`
+	// SyncedBlock block the balance was last read from the node at, only later transfers are applied on top of it
+	SyncedBlock int64 `json:"syncedBlock"`
+	// UpdatedBlock block of the last transfer applied
+	UpdatedBlock int64 `json:"updatedBlock"`
+	// Applied transactions and withdrawals of UpdatedBlock applied already, a block persisted again is not counted twice
+	Applied []string `json:"-"`
+	// Mismatch the last time the derived balance disagreed with the node
+	Mismatch *BalanceMismatch `json:"mismatch,omitempty"`
+}
+
+// BalanceMismatch derived balance that did not match the node, the balance is reset to what the node reports
+type BalanceMismatch struct {
+	Block      int64     `json:"block"`
+	Expected   string    `json:"expected"`
+	Actual     string    `json:"actual"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+// BalanceTracker keeps the balances of subscribers up to date as their transfers are parsed. A balance is read from
+// the node the first time an address moves an asset, from then on the transfers and fees are applied to it and the
+// result is compared with the node every ReconcileInterval.
+type BalanceTracker struct {
+	mux sync.Mutex
+
+	chainID int64
+	storage Repository
+	client  ethereumClient
+	config  BalanceConfig
+
+	reconciledAt time.Time
+}
+
+// Apply adds the transfers and fees of a parsed transaction to the balances of the subscribers taking part, applying
+// the same transaction again is a no-op
+func (b *BalanceTracker) Apply(ctx context.Context, subs []Subscription, transaction Transaction) error {
+	number, err := hexDecoder(transaction.BlockNumber)
+	if err != nil {
+		return fmt.Errorf("invalid block number %v of %v: %v", transaction.BlockNumber, transaction.Hash, err)
+	}
+
+	for _, sub := range subs {
+		for asset, delta := range balanceDeltas(sub.Address, transaction) {
+			if err := b.apply(ctx, sub.Address, asset, number, transaction.Hash, delta); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ApplyWithdrawal credits a withdrawal to the balance of its address, once
+func (b *BalanceTracker) ApplyWithdrawal(ctx context.Context, withdrawal Withdrawal) error {
+	number, err := hexDecoder(withdrawal.BlockNumber)
+	if err != nil {
+		return fmt.Errorf("invalid block number %v of withdrawal %v: %v", withdrawal.BlockNumber, withdrawal.Index, err)
+	}
+
+	amount, err := quantityToBig(withdrawal.Value())
+	if err != nil {
+		return err
+	}
+
+	return b.apply(ctx, withdrawal.Address, AssetETH, number, "withdrawal:"+withdrawal.Index, amount)
+}
+
+// apply adds the delta of a transaction, or withdrawal, to the balance once, applying it again is a no-op
+func (b *BalanceTracker) apply(ctx context.Context, address string, asset string, number int64, applied string, delta *big.Int) error {
+	address = strings.ToLower(address)
+
+	balance, err := b.storage.GetBalance(ctx, b.chainID, address, asset)
+	if err != nil {
+		return err
+	}
+
+	// First time the address moves the asset, the node already knows the balance after this block
+	if balance.Address == "" {
+		actual, err := b.fetch(ctx, address, asset, number)
+		if err != nil {
+			return err
+		}
+
+		return b.storage.SetBalance(ctx, Balance{
+			Address:      address,
+			ChainID:      quantity(b.chainID),
+			Asset:        asset,
+			Balance:      bigToQuantity(actual),
+			SyncedBlock:  number,
+			UpdatedBlock: number,
+		})
+	}
+
+	if number <= balance.SyncedBlock || number < balance.UpdatedBlock {
+		return nil
+	}
+
+	if number != balance.UpdatedBlock {
+		balance.Applied = nil
+	}
+	for _, hash := range balance.Applied {
+		if hash == applied {
+			return nil
+		}
+	}
+
+	current, err := quantityToBig(balance.Balance)
+	if err != nil {
+		return err
+	}
+
+	balance.Balance = bigToQuantity(current.Add(current, delta))
+	balance.UpdatedBlock = number
+	// Never appending to the array the stored balance holds on to
+	balance.Applied = append(balance.Applied[:len(balance.Applied):len(balance.Applied)], applied)
+
+	return b.storage.SetBalance(ctx, balance)
+}
+
+// Reconcile compares every tracked balance with the node at the given block, once ReconcileInterval has passed since
+// the last time. The block has to be fully parsed so the derived balances are complete up to it.
+func (b *BalanceTracker) Reconcile(ctx context.Context, number int64) error {
+	b.mux.Lock()
+	due := time.Since(b.reconciledAt) >= b.config.ReconcileInterval
+	if due {
+		b.reconciledAt = time.Now()
+	}
+	b.mux.Unlock()
+
+	if !due {
+		return nil
+	}
+
+	balances, err := b.storage.GetBalances(ctx, b.chainID, "")
+	if err != nil {
+		return err
+	}
+
+	for _, balance := range balances {
+		if balance.SyncedBlock >= number {
+			continue
+		}
+
+		actual, err := b.fetch(ctx, balance.Address, balance.Asset, number)
+		if err != nil {
+			return err
+		}
+
+		if expected := balance.Balance; expected != bigToQuantity(actual) {
+			log.Printf("Balance of %v in %v on chain %d is %v but the node reports %v at block %d", balance.Address, balance.Asset, b.chainID, expected, bigToQuantity(actual), number)
+			balance.Mismatch = &BalanceMismatch{Block: number, Expected: expected, Actual: bigToQuantity(actual), DetectedAt: time.Now().UTC()}
+		}
+
+		balance.Balance = bigToQuantity(actual)
+		balance.SyncedBlock = number
+		if err := b.storage.SetBalance(ctx, balance); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetch reads the balance from the node, eth_getBalance for ETH and balanceOf for tokens
+func (b *BalanceTracker) fetch(ctx context.Context, address string, asset string, number int64) (*big.Int, error) {
+	if asset == AssetETH {
+		balance, err := b.client.GetBalance(ctx, address, number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve the balance of %v: %w", address, err)
+		}
+
+		return quantityToBig(balance)
+	}
+
+	input, err := encodeABICall("balanceOf(address)", address)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := b.client.Call(ctx, CallMsg{To: asset, Data: "0x" + hex.EncodeToString(input)}, number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the %v balance of %v: %w", asset, address, err)
+	}
+
+	data, err := hex.DecodeString(strings.TrimPrefix(result, "0x"))
+	if err != nil || len(data) < abiWord {
+		return nil, fmt.Errorf("unexpected %v balance of %v: %v", asset, address, result)
+	}
+
+	return new(big.Int).SetBytes(data[:abiWord]), nil
+}
+
+// balanceDeltas what the transaction changed for the address by asset, reverted transactions only cost the fee
+func balanceDeltas(address string, transaction Transaction) map[string]*big.Int {
+	deltas := make(map[string]*big.Int)
+	add := func(asset string, value *big.Int) {
+		if _, ok := deltas[asset]; !ok {
+			deltas[asset] = new(big.Int)
+		}
+		deltas[asset].Add(deltas[asset], value)
+	}
+
+	if strings.EqualFold(transaction.From, address) {
+		if fee, err := quantityToBig(transaction.Fee); err == nil {
+			add(AssetETH, new(big.Int).Neg(fee))
+		}
+	}
+
+	if transaction.Failed() {
+		return deltas
+	}
+
+	for _, transfer := range transaction.Transfers() {
+		value, err := quantityToBig(transfer.Value)
+		if err != nil {
+			continue
+		}
+
+		if strings.EqualFold(transfer.From, address) {
+			add(transfer.Asset, new(big.Int).Neg(value))
+		}
+
+		if strings.EqualFold(transfer.To, address) {
+			add(transfer.Asset, value)
+		}
+	}
+
+	return deltas
+}
+
+func NewBalanceTracker(config BalanceConfig, chainID int64, storage Repository, client ethereumClient) BalanceTracker {
+	return BalanceTracker{
+		chainID: chainID,
+		storage: storage,
+		client:  client,
+		config:  config,
+		// The first reconciliation waits a full interval, the balances were just read from the node
+		reconciledAt: time.Now(),
+	}
+}
+
+// etherDecimals wei in an ether
+const etherDecimals = 18
@@ -0,0 +1,100 @@
+package ethereum_parser_test
+
+import (
+	"context"
+	"encoding/json"
+	eth "ethereum_parser"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const counterparty = "0x00000000219ab540356cbb839cbe05303d7705fa"
+
+func TestBalanceTracker_ApplyAndReconcile(t *testing.T) {
+	// Balances reported by the node by block, ETH in wei and the token through balanceOf
+	ether := map[string]string{"0x64": "0x8ac7230489e80000", "0x66": "0x7ce66c50e2840000"}
+	tokens := map[string]string{"0x64": "0x5f5e100"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		var block string
+		require.NoError(t, json.Unmarshal(request.Params[1], &block))
+
+		var result string
+		switch request.Method {
+		case "eth_getBalance":
+			result = ether[block]
+		case "eth_call":
+			result = fmt.Sprintf("0x%064s", tokens[block][2:])
+		}
+		_, _ = fmt.Fprintf(w, `{"jsonrpc": "2.0", "id": 1, "result": "%v"}`, result)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	storage := eth.NewMemStorage()
+	client := eth.NewEthereumClient(eth.EthereumClientConfig{Addr: server.URL, JsonRPC: "2.0"})
+	tracker := eth.NewBalanceTracker(eth.BalanceConfig{}, 1, &storage, client)
+	subs := []eth.Subscription{{Address: address}}
+
+	// First sight of the address reads the balance after the block, 10 ETH and 100 USDT
+	require.NoError(t, tracker.Apply(ctx, subs, eth.Transaction{
+		BlockNumber:    "0x64",
+		From:           counterparty,
+		To:             address,
+		Value:          "0x1",
+		TokenTransfers: []eth.TokenTransfer{{Token: token, From: counterparty, To: address, Value: "0x1"}},
+	}))
+
+	// Sending 1 ETH for a 0.01 ETH fee and 40 USDT, applying it again as a retried sync does only counts it once
+	sent := eth.Transaction{
+		Hash:           "0x01",
+		BlockNumber:    "0x65",
+		From:           address,
+		To:             token,
+		Value:          "0xde0b6b3a7640000",
+		Fee:            "0x2386f26fc10000",
+		TokenTransfers: []eth.TokenTransfer{{Token: token, From: address, To: counterparty, Value: "0x2625a00"}},
+	}
+	require.NoError(t, tracker.Apply(ctx, subs, sent))
+	require.NoError(t, tracker.Apply(ctx, subs, sent))
+
+	// A reverted transaction only costs the fee
+	require.NoError(t, tracker.Apply(ctx, subs, eth.Transaction{
+		BlockNumber: "0x66",
+		From:        address,
+		To:          counterparty,
+		Value:       "0xde0b6b3a7640000",
+		Fee:         "0x2386f26fc10000",
+		Status:      "0x0",
+	}))
+
+	balances, err := storage.GetBalances(ctx, 1, address)
+	require.NoError(t, err)
+	require.Len(t, balances, 2)
+
+	// Ordered by asset, the token address sorts before ETH
+	assert.Equal(t, "0x3938700", balances[0].Balance, "60 USDT")
+	assert.Equal(t, "0x7c9f5e6c03020000", balances[1].Balance, "10 ETH minus 1 ETH and two fees")
+
+	// The node agrees on the token but says 9 ETH, as if the reverted transaction had cost nothing
+	tokens["0x66"] = "0x3938700"
+	require.NoError(t, tracker.Reconcile(ctx, 0x66))
+
+	balances, err = storage.GetBalances(ctx, 1, address)
+	require.NoError(t, err)
+	assert.Nil(t, balances[0].Mismatch)
+	assert.Equal(t, "0x7ce66c50e2840000", balances[1].Balance)
+	require.NotNil(t, balances[1].Mismatch)
+	assert.Equal(t, "0x7c9f5e6c03020000", balances[1].Mismatch.Expected)
+	assert.Equal(t, int64(0x66), balances[1].SyncedBlock)
+}
@@ -0,0 +1,161 @@
+package ethereum_parser
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+var _ blockSource = headBlockSource{}
+var _ blockSource = &filterBlockSource{}
+
+// headBlockSource asks for the most recent block number every tick and fetches blocks by number
+type headBlockSource struct {
+	client ethereumClient
+}
+
+func (s headBlockSource) Head(ctx context.Context) (int64, error) {
+	return s.client.GetCurrentBlock(ctx)
+}
+
+func (s headBlockSource) Block(ctx context.Context, number int64) (Block, error) {
+	return s.client.GetBlockByNumber(ctx, number)
+}
+
+// filterBlockSource receives the hashes of new blocks through eth_newBlockFilter, so only blocks that actually
+// arrived are fetched. The fetch workers of the pipeline ask for blocks at the same time.
+type filterBlockSource struct {
+	client ethereumClient
+
+	mux      sync.Mutex
+	filterID string
+	head     int64
+	// received blocks reported by the filter by number, handed out once the parser gets to them
+	received map[int64]Block
+}
+
+func (s *filterBlockSource) Head(ctx context.Context) (int64, error) {
+	s.mux.Lock()
+	filterID := s.filterID
+	s.mux.Unlock()
+
+	if filterID == "" {
+		filterID, err := s.client.NewBlockFilter(ctx)
+		if err != nil {
+			return 0, err
+		}
+		s.setFilter(filterID)
+
+		// Whatever happened before the filter existed is only known by number
+		return s.client.GetCurrentBlock(ctx)
+	}
+
+	hashes, err := s.client.GetFilterChanges(ctx, filterID)
+	if isFilterNotFound(err) {
+		// The node forgot the filter, the cursor makes sure the blocks produced in the meantime are fetched by number
+		log.Printf("Block filter %v expired, creating a new one", filterID)
+		s.setFilter("")
+		return s.Head(ctx)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for _, hash := range hashes {
+		block, err := s.client.GetBlockByHash(ctx, hash)
+		if err != nil {
+			return 0, err
+		}
+
+		// Block got reorged away between the notification and the fetch
+		if block.Hash == "" {
+			continue
+		}
+
+		number, err := hexDecoder(block.Number)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number for block %v: %v", hash, err)
+		}
+
+		s.mux.Lock()
+		// A later block at the same height is a reorg, the latest one wins
+		s.received[number] = block
+		if number > s.head {
+			s.head = number
+		}
+		s.mux.Unlock()
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.head, nil
+}
+
+func (s *filterBlockSource) Block(ctx context.Context, number int64) (Block, error) {
+	s.mux.Lock()
+	for received := range s.received {
+		// Blocks are fetched out of order, only those too far behind for any sync to still get to are dropped
+		if received < number-maxBlocksPerSync {
+			delete(s.received, received)
+		}
+	}
+
+	block, ok := s.received[number]
+	delete(s.received, number)
+	s.mux.Unlock()
+
+	if ok {
+		return block, nil
+	}
+
+	return s.client.GetBlockByNumber(ctx, number)
+}
+
+func (s *filterBlockSource) setFilter(filterID string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.filterID = filterID
+}
+
+func (s *filterBlockSource) Close(ctx context.Context) {
+	s.mux.Lock()
+	filterID := s.filterID
+	s.mux.Unlock()
+
+	if filterID == "" {
+		return
+	}
+
+	if _, err := s.client.UninstallFilter(ctx, filterID); err != nil {
+		log.Printf("There was an issue trying to uninstall filter %v: %v", filterID, err)
+	}
+}
+
+func newBlockSource(mode string, client ethereumClient) (blockSource, error) {
+	switch mode {
+	case "", PollModeNumber:
+		return headBlockSource{client: client}, nil
+	case PollModeFilter:
+		return &filterBlockSource{client: client, received: make(map[int64]Block)}, nil
+	default:
+		return nil, fmt.Errorf("unknown poll mode %v", mode)
+	}
+}
+
+type blockSource interface {
+	// Head returns the number of the most recent block known to the node
+	Head(ctx context.Context) (int64, error)
+
+	// Block returns the block at the given height
+	Block(ctx context.Context, number int64) (Block, error)
+}
+
+const (
+	// PollModeNumber polls eth_blockNumber and fetches blocks by number
+	PollModeNumber = "number"
+	// PollModeFilter polls a block filter and fetches the reported blocks by hash
+	PollModeFilter = "filter"
+)
@@ -0,0 +1,112 @@
+package ethereum_parser
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BusTopic kinds of what happens inside the parser that other parts of it may want to know about
+type BusTopic string
+
+const (
+	// TopicSubscribed an address got subscribed, directly, through a wallet or as an ens name moved
+	TopicSubscribed BusTopic = "subscribed"
+	// TopicUnsubscribed an address is no longer subscribed
+	TopicUnsubscribed BusTopic = "unsubscribed"
+	// TopicBlockParsed a block got parsed and the cursor of its chain moved past it
+	TopicBlockParsed BusTopic = "blockParsed"
+	// TopicTransactionMatched a transaction matched the subscription of an address and fired up its event
+	TopicTransactionMatched BusTopic = "transactionMatched"
+)
+
+// BusEvent published on the bus, only the fields that make sense for the topic are set
+type BusEvent struct {
+	Topic   BusTopic `json:"topic"`
+	ChainID int64    `json:"chainId,omitempty"`
+	// Address subscribed, unsubscribed or matched
+	Address string `json:"address,omitempty"`
+	// Block parsed, or the one the matched transaction was mined in
+	Block int64 `json:"block,omitempty"`
+	// Hash of the block parsed or of the transaction matched
+	Hash string    `json:"hash,omitempty"`
+	At   time.Time `json:"at"`
+}
+
+// EventBus an in process publish/subscribe bus for what happens inside the parser. Publishing never blocks, every
+// consumer has its own buffer and misses what does not fit in it, a slow consumer only ever slows down itself.
+type EventBus struct {
+	mux       sync.RWMutex
+	consumers []*BusConsumer
+}
+
+// BusConsumer receives the events of its topics on C until closed
+type BusConsumer struct {
+	C <-chan BusEvent
+
+	bus     *EventBus
+	events  chan BusEvent
+	topics  map[BusTopic]bool
+	dropped atomic.Uint64
+}
+
+// Publish hands the event over to every consumer of its topic that has room for it
+func (b *EventBus) Publish(event BusEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+
+	for _, consumer := range b.consumers {
+		if len(consumer.topics) > 0 && !consumer.topics[event.Topic] {
+			continue
+		}
+
+		select {
+		case consumer.events <- event:
+		default:
+			consumer.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe a consumer of the topics given, all of them when none are, buffering up to size events
+func (b *EventBus) Subscribe(size int, topics ...BusTopic) *BusConsumer {
+	events := make(chan BusEvent, size)
+	consumer := &BusConsumer{C: events, bus: b, events: events, topics: make(map[BusTopic]bool)}
+	for _, topic := range topics {
+		consumer.topics[topic] = true
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.consumers = append(b.consumers, consumer)
+
+	return consumer
+}
+
+// Close stops the consumer from receiving events and closes C, closing it again is a no-op
+func (c *BusConsumer) Close() {
+	c.bus.mux.Lock()
+	defer c.bus.mux.Unlock()
+
+	for i, consumer := range c.bus.consumers {
+		if consumer == c {
+			c.bus.consumers = append(c.bus.consumers[:i], c.bus.consumers[i+1:]...)
+			close(c.events)
+			return
+		}
+	}
+}
+
+// Dropped events the consumer missed because its buffer was full
+func (c *BusConsumer) Dropped() uint64 {
+	return c.dropped.Load()
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
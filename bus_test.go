@@ -0,0 +1,46 @@
+package ethereum_parser_test
+
+import (
+	eth "ethereum_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := eth.NewEventBus()
+
+	all := bus.Subscribe(4)
+	blocks := bus.Subscribe(1, eth.TopicBlockParsed)
+	// Nobody reads this one, publishing goes on regardless
+	stuck := bus.Subscribe(0, eth.TopicSubscribed)
+
+	bus.Publish(eth.BusEvent{Topic: eth.TopicSubscribed, Address: address})
+	bus.Publish(eth.BusEvent{Topic: eth.TopicBlockParsed, ChainID: 1, Block: 10})
+	bus.Publish(eth.BusEvent{Topic: eth.TopicBlockParsed, ChainID: 1, Block: 11})
+
+	// Every consumer gets its own copy of the topics it asked for
+	for _, topic := range []eth.BusTopic{eth.TopicSubscribed, eth.TopicBlockParsed, eth.TopicBlockParsed} {
+		event := <-all.C
+		assert.Equal(t, topic, event.Topic)
+		assert.False(t, event.At.IsZero())
+	}
+	assert.Zero(t, all.Dropped())
+
+	event := <-blocks.C
+	assert.Equal(t, int64(10), event.Block)
+	assert.Equal(t, uint64(1), blocks.Dropped())
+	assert.Equal(t, uint64(1), stuck.Dropped())
+
+	// A closed consumer no longer receives anything
+	blocks.Close()
+	blocks.Close()
+	bus.Publish(eth.BusEvent{Topic: eth.TopicBlockParsed, ChainID: 1, Block: 12})
+
+	_, open := <-blocks.C
+	assert.False(t, open)
+
+	event, open = <-all.C
+	require.True(t, open)
+	assert.Equal(t, int64(12), event.Block)
+}
@@ -0,0 +1,229 @@
+package ethereum_parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+var _ http.RoundTripper = &Recorder{}
+
+var ErrCassetteMiss = errors.New("no recorded interaction matches the request")
+
+// Interaction a JSON-RPC request together with the answer of the node, one per line of a cassette
+type Interaction struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	// Status and Body of the HTTP response, errors and rate limiting included
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+}
+
+// Recorder an http.RoundTripper for the Ethereum client that writes every JSON-RPC call to a cassette, or answers them
+// from one without a node. Calls are matched by method and params, the same call made several times is answered in the
+// order it was recorded, so a replay sees exactly what the node said while recording.
+type Recorder struct {
+	mux sync.Mutex
+
+	mode string
+	next http.RoundTripper
+
+	// file the cassette being recorded
+	file *os.File
+	// interactions recorded interactions not replayed yet by call
+	interactions map[string][]Interaction
+}
+
+func (r *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		if body, err = io.ReadAll(request.Body); err != nil {
+			return nil, err
+		}
+		_ = request.Body.Close()
+	}
+
+	call, err := readCall(body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot record or replay request: %v", err)
+	}
+
+	if r.mode == CassetteModeReplay {
+		return r.replay(request, call)
+	}
+
+	// The request is sent on as it came in, only its body has already been read
+	forwarded := request.Clone(request.Context())
+	forwarded.Body = io.NopCloser(bytes.NewReader(body))
+	response, err := r.next.RoundTrip(forwarded)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(responseBody))
+
+	call.Status = response.StatusCode
+	call.Body = string(responseBody)
+	if err := r.record(call); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// replay answers the request with the first recorded interaction of the call that has not been replayed yet
+func (r *Recorder) replay(request *http.Request, call Interaction) (*http.Response, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	key := call.key()
+	recorded := r.interactions[key]
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("%w: %v %s", ErrCassetteMiss, call.Method, call.Params)
+	}
+	r.interactions[key] = recorded[1:]
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %v", recorded[0].Status, http.StatusText(recorded[0].Status)),
+		StatusCode:    recorded[0].Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader([]byte(recorded[0].Body))),
+		ContentLength: int64(len(recorded[0].Body)),
+		Request:       request,
+	}, nil
+}
+
+// record appends the interaction to the cassette right away, a recording cut short by a crash is still usable
+func (r *Recorder) record(call Interaction) error {
+	line, err := json.Marshal(call)
+	if err != nil {
+		return fmt.Errorf("failed to record %v: %v", call.Method, err)
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to record %v: %v", call.Method, err)
+	}
+
+	return nil
+}
+
+// Close closes the cassette being recorded
+func (r *Recorder) Close() error {
+	if r.file == nil {
+		return nil
+	}
+
+	return r.file.Close()
+}
+
+// key identifies a call by its method and params, params are compacted so formatting does not matter
+func (i Interaction) key() string {
+	var params bytes.Buffer
+	if err := json.Compact(&params, i.Params); err != nil {
+		return i.Method + string(i.Params)
+	}
+
+	return i.Method + params.String()
+}
+
+// readCall the method and params of a JSON-RPC request body, the id is left out as it says nothing about the call
+func readCall(body []byte) (Interaction, error) {
+	var request struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return Interaction{}, err
+	}
+
+	if request.Method == "" {
+		return Interaction{}, fmt.Errorf("not a json-rpc request")
+	}
+
+	return Interaction{Method: request.Method, Params: request.Params}, nil
+}
+
+// loadCassette reads the interactions of a cassette by call, in the order they were recorded
+func loadCassette(path string) (map[string][]Interaction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette %v: %v", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	interactions := make(map[string][]Interaction)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxCassetteLine)
+	for line := 1; scanner.Scan(); line++ {
+		var interaction Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			return nil, fmt.Errorf("invalid interaction %d of cassette %v: %v", line, path, err)
+		}
+
+		key := interaction.key()
+		interactions[key] = append(interactions[key], interaction)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette %v: %v", path, err)
+	}
+
+	return interactions, nil
+}
+
+// NewRecorder records the calls sent through next to the cassette at path, truncating it, or replays the cassette
+// without sending anything
+func NewRecorder(path string, mode string, next http.RoundTripper) (*Recorder, error) {
+	switch mode {
+	case "", CassetteModeRecord:
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cassette %v: %v", path, err)
+		}
+
+		if next == nil {
+			next = http.DefaultTransport
+		}
+
+		return &Recorder{mode: CassetteModeRecord, next: next, file: file}, nil
+	case CassetteModeReplay:
+		interactions, err := loadCassette(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Recorder{mode: CassetteModeReplay, interactions: interactions}, nil
+	default:
+		return nil, fmt.Errorf("unknown cassette mode %v", mode)
+	}
+}
+
+const (
+	// CassetteModeRecord sends calls to the node and writes them to the cassette
+	CassetteModeRecord = "record"
+	// CassetteModeReplay answers calls from the cassette, the node is never contacted
+	CassetteModeReplay = "replay"
+
+	// maxCassetteLine blocks with all their transactions make for long lines
+	maxCassetteLine = 64 << 20
+)
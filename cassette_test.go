@@ -0,0 +1,75 @@
+package ethereum_parser_test
+
+import (
+	"context"
+	eth "ethereum_parser"
+	"ethereum_parser/chaintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	node := chaintest.NewChain(1)
+	node.Mine()
+
+	recorder, err := eth.NewRecorder(path, eth.CassetteModeRecord, nil)
+	require.NoError(t, err)
+	client := eth.NewEthereumClient(eth.EthereumClientConfig{Addr: node.URL(), JsonRPC: ver, Transport: recorder})
+
+	_, err = client.ChainID(ctx)
+	require.NoError(t, err)
+
+	head, err := client.GetCurrentBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), head)
+
+	// The same call answered differently, rate limited first and after a new block then
+	node.Throttle(1)
+	_, err = client.GetCurrentBlock(ctx)
+	require.Error(t, err)
+
+	block := node.Mine(eth.Transaction{From: counterparty, To: address, Value: "0x1"})
+	head, err = client.GetCurrentBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), head)
+
+	_, err = client.GetBlockByNumber(ctx, 2)
+	require.NoError(t, err)
+
+	require.NoError(t, recorder.Close())
+	node.Close()
+
+	// Replaying needs neither the node nor its url
+	chain, err := eth.NewChain(ctx, eth.ChainConfig{Name: "replayed", Cassette: path, CassetteMode: eth.CassetteModeReplay}, ver)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), chain.Config.ChainID)
+
+	head, err = chain.Client.GetCurrentBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), head)
+
+	_, err = chain.Client.GetCurrentBlock(ctx)
+	assert.ErrorContains(t, err, "429")
+
+	head, err = chain.Client.GetCurrentBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), head)
+
+	replayed, err := chain.Client.GetBlockByNumber(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, block.Hash, replayed.Hash)
+	require.Len(t, replayed.Transactions, 1)
+	assert.Equal(t, block.Transactions[0].Hash, replayed.Transactions[0].Hash)
+
+	// Calls that were never made, or made more often than recorded, are misses
+	_, err = chain.Client.GetBlockByNumber(ctx, 3)
+	assert.ErrorIs(t, err, eth.ErrCassetteMiss)
+
+	_, err = chain.Client.GetCurrentBlock(ctx)
+	assert.ErrorIs(t, err, eth.ErrCassetteMiss)
+}
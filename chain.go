@@ -0,0 +1,238 @@
+package ethereum_parser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+var ErrUnknownChain = errors.New("unknown chain")
+
+type ChainsConfig struct {
+	// Chains JSON list of ChainConfig, takes precedence over ChainsFile
+	Chains string `env:"CHAINS"`
+	// ChainsFile path to a JSON file with the list of ChainConfig
+	ChainsFile string `env:"CHAINS_FILE"`
+	// Dump glob of block dumps the single chain is parsed from instead of ETHEREUM_CLIENT_URL
+	Dump string `env:"DUMP"`
+	// Cassette and CassetteMode record the calls of the single chain to a file or replay them, see Recorder
+	Cassette     string `env:"CASSETTE"`
+	CassetteMode string `env:"CASSETTE_MODE"`
+	// ChainID of the single chain, checked against the node once it answers rather than resolved from it on start up
+	ChainID int64 `env:"CHAIN_ID"`
+}
+
+// ChainConfig a single EVM network with its own node, parser and cursor
+type ChainConfig struct {
+	Name   string `json:"name"`
+	RPCURL string `json:"rpcUrl"`
+	// Dump glob of block dump files parsed instead of talking to a node, see WriteDump
+	Dump string `json:"dump"`
+	// Cassette file the JSON-RPC calls to the node are recorded to, or replayed from depending on CassetteMode
+	Cassette     string `json:"cassette"`
+	CassetteMode string `json:"cassetteMode"`
+	// StartBlock where the first run starts, by default the most recent confirmed block or the first dumped one
+	StartBlock int64 `json:"startBlock"`
+	// ChainID verified against eth_chainId before the first sync, resolved from the node on start up when left empty
+	ChainID int64 `json:"chainId"`
+	// Confirmations number of blocks a block needs on top of it before it is parsed
+	Confirmations int64    `json:"confirmations"`
+	PollInterval  Duration `json:"pollInterval"`
+	// MinPollInterval and MaxPollInterval bound the poll interval tuned to the block times of the chain
+	MinPollInterval Duration `json:"minPollInterval"`
+	MaxPollInterval Duration `json:"maxPollInterval"`
+	PollMode        string   `json:"pollMode"`
+	// Tracer detects internal transfers, debug or parity depending on what the node supports, empty disables it
+	Tracer string `json:"tracer"`
+	// VerifyBlocks recomputes the hash and transactions root of every block before parsing it
+	VerifyBlocks bool `json:"verifyBlocks"`
+	// VerifySenders recovers the sender of every transaction involving a subscriber from its signature
+	VerifySenders bool `json:"verifySenders"`
+	// Pipeline queues and workers of the stages blocks go through, what is left out is taken from the parser
+	Pipeline PipelineConfig `json:"pipeline"`
+}
+
+// Chain a configured network together with the client talking to its node
+type Chain struct {
+	Config ChainConfig
+	Client ethereumClient
+}
+
+// ChainStatus what the API exposes about a chain, the rpc url is left out as it tends to carry api keys
+type ChainStatus struct {
+	Name         string `json:"name"`
+	ChainID      int64  `json:"chainId"`
+	CurrentBlock int64  `json:"currentBlock"`
+	// Parser how the parser of the chain is doing, missing when it is not supervised
+	Parser *SupervisorState `json:"parser,omitempty"`
+	// Pending how the pending watcher of the chain is doing, missing when mempool watching is off
+	Pending *SupervisorState `json:"pending,omitempty"`
+	// Pipeline what each stage of the parser has been up to, missing when it is not supervised
+	Pipeline []StageMetrics `json:"pipeline,omitempty"`
+}
+
+// Duration reads durations such as "5s" from JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration should be a string such as 5s: %v", err)
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadChains reads the configured chains, without any a single chain is built from the ethereum client configuration.
+// Settings a chain leaves empty are taken from the parser configuration.
+func LoadChains(config ChainsConfig, ethConfig EthereumClientConfig, parserConfig ParserConfig) ([]ChainConfig, error) {
+	data := []byte(config.Chains)
+	if len(data) == 0 && config.ChainsFile != "" {
+		var err error
+		if data, err = os.ReadFile(config.ChainsFile); err != nil {
+			return nil, fmt.Errorf("failed to read chains file: %v", err)
+		}
+	}
+
+	var chains []ChainConfig
+	if len(data) == 0 {
+		chains = []ChainConfig{{
+			Name:         defaultChainName,
+			RPCURL:       ethConfig.Addr,
+			Dump:         config.Dump,
+			Cassette:     config.Cassette,
+			CassetteMode: config.CassetteMode,
+			ChainID:      config.ChainID,
+		}}
+	} else if err := json.Unmarshal(data, &chains); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal chains: %v", err)
+	}
+
+	if len(chains) == 0 {
+		return nil, fmt.Errorf("at least one chain has to be configured")
+	}
+
+	names := make(map[string]bool)
+	for i, chain := range chains {
+		// Replaying a cassette never contacts the node, bug reports need not include an rpc url carrying an api key
+		replays := chain.Cassette != "" && chain.CassetteMode == CassetteModeReplay
+		if chain.Name == "" || (chain.RPCURL == "" && chain.Dump == "" && !replays) {
+			return nil, fmt.Errorf("chain %d needs a name and an rpc url or dump", i)
+		}
+
+		if names[chain.Name] {
+			return nil, fmt.Errorf("chain %v is configured twice", chain.Name)
+		}
+		names[chain.Name] = true
+
+		if chain.PollInterval <= 0 {
+			chains[i].PollInterval = Duration(parserConfig.PollInterval)
+		}
+
+		if chain.MinPollInterval <= 0 {
+			chains[i].MinPollInterval = Duration(parserConfig.MinPollInterval)
+		}
+
+		if chain.MaxPollInterval <= 0 {
+			chains[i].MaxPollInterval = Duration(parserConfig.MaxPollInterval)
+		}
+
+		if chain.PollMode == "" {
+			chains[i].PollMode = parserConfig.PollMode
+		}
+
+		if chain.Confirmations == 0 {
+			chains[i].Confirmations = parserConfig.Confirmations
+		}
+
+		if parserConfig.VerifyBlocks {
+			chains[i].VerifyBlocks = true
+		}
+
+		if parserConfig.VerifySenders {
+			chains[i].VerifySenders = true
+		}
+
+		if chain.Tracer == "" {
+			chains[i].Tracer = parserConfig.Tracer
+		}
+
+		chains[i].Pipeline = chain.Pipeline.withDefaults(parserConfig.Pipeline)
+
+		switch chains[i].Tracer {
+		case "", TracerDebug, TracerParity:
+		default:
+			return nil, fmt.Errorf("chain %v has an unknown tracer %v", chain.Name, chains[i].Tracer)
+		}
+	}
+
+	return chains, nil
+}
+
+// NewChain builds the client of a chain, reading its dumps when it has any and talking to its node otherwise. A chain id
+// left out is resolved from the node, which has to be up for it. A configured one is left for the parser to check, so
+// a node down on start up only degrades its chain.
+func NewChain(ctx context.Context, config ChainConfig, jsonRPC string) (Chain, error) {
+	var client ethereumClient
+	if config.Dump == "" {
+		clientConfig := EthereumClientConfig{Addr: config.RPCURL, JsonRPC: jsonRPC}
+		if config.Cassette != "" {
+			recorder, err := NewRecorder(config.Cassette, config.CassetteMode, nil)
+			if err != nil {
+				return Chain{}, fmt.Errorf("failed to set up the cassette of %v: %v", config.Name, err)
+			}
+			clientConfig.Transport = recorder
+		}
+		client = NewEthereumClient(clientConfig)
+	} else {
+		dump, err := NewDumpClient(config.ChainID, config.Dump)
+		if err != nil {
+			return Chain{}, fmt.Errorf("failed to load the dumps of %v: %v", config.Name, err)
+		}
+
+		// Dumps are parsed from the start rather than from the most recent block
+		if config.StartBlock == 0 {
+			config.StartBlock = dump.FirstBlock()
+		}
+		client = dump
+	}
+
+	if config.ChainID == 0 {
+		var err error
+		if config, err = ResolveChainID(ctx, config, client); err != nil {
+			return Chain{}, err
+		}
+	}
+
+	return Chain{Config: config, Client: client}, nil
+}
+
+// ResolveChainID fills in the chain id from the node, or makes sure the configured one is what the node serves
+func ResolveChainID(ctx context.Context, chain ChainConfig, client ethereumClient) (ChainConfig, error) {
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return chain, fmt.Errorf("failed to retrieve the chain id of %v: %w", chain.Name, err)
+	}
+
+	if chain.ChainID != 0 && chain.ChainID != chainID {
+		return chain, fmt.Errorf("chain %v is configured with id %d but the node serves %d", chain.Name, chain.ChainID, chainID)
+	}
+
+	chain.ChainID = chainID
+	return chain, nil
+}
+
+const defaultChainName = "ethereum"
@@ -0,0 +1,626 @@
+// Package chaintest simulates an Ethereum node behind a JSON-RPC server for tests. Blocks are only produced when a test
+// mines them and hashes are derived from their position, so every run sees the same chain.
+package chaintest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"ethereum_parser"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ http.Handler = &Chain{}
+
+// Chain a simulated node, serving the methods the parser relies on. Failures, rate limiting and latency are scripted
+// by the test rather than random.
+type Chain struct {
+	mux    sync.Mutex
+	server *httptest.Server
+
+	chainID   int64
+	blockTime time.Duration
+
+	// blocks the canonical chain by number, genesis included
+	blocks []ethereum_parser.Block
+	byHash map[string]int64
+	// transactions mined transactions by hash, as the node returns them
+	transactions map[string]ethereum_parser.Transaction
+	receipts     map[string]ethereum_parser.Receipt
+	pending      map[string]ethereum_parser.Transaction
+	// fork bumped by every reorg, so blocks mined again at the same height get other hashes
+	fork int
+	// verifiable blocks get a full header and the hash it commits to
+	verifiable bool
+
+	code     map[string]string
+	balances map[string]string
+	calls    map[string]string
+	// traces and parityTraces what the two tracers report for a block by number, nothing unless set
+	traces       map[int64][]ethereum_parser.TransactionTrace
+	parityTraces map[int64][]ethereum_parser.ParityTrace
+
+	filters    map[string]*filter
+	lastFilter int
+
+	failures  []failure
+	throttled int
+	latency   time.Duration
+	requests  map[string]int
+}
+
+type filter struct {
+	pending bool
+	hashes  []string
+}
+
+type failure struct {
+	method string
+	times  int
+	err    ethereum_parser.RPCError
+}
+
+// Head the most recent block of the canonical chain
+func (c *Chain) Head() ethereum_parser.Block {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.blocks[len(c.blocks)-1]
+}
+
+// Mine appends a block with the transactions on top of the head, see MineBlock
+func (c *Chain) Mine(transactions ...ethereum_parser.Transaction) ethereum_parser.Block {
+	return c.MineBlock(ethereum_parser.Block{Transactions: transactions})
+}
+
+// MineBlock appends the block on top of the head, filling in its number, hash, parent and timestamp. Transactions get
+// a hash unless they have one and a receipt from their Status (success by default) and TokenTransfers, which become
+// Transfer logs. Those fields are then cleared as a node does not return them with the transaction.
+func (c *Chain) MineBlock(block ethereum_parser.Block) ethereum_parser.Block {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	parent := c.blocks[len(c.blocks)-1]
+	number := int64(len(c.blocks))
+	c.mine(&block, number, parent.Hash)
+
+	var logIndex, gasUsed int64
+	for i, transaction := range block.Transactions {
+		if transaction.Hash == "" {
+			transaction.Hash = hash("transaction", block.Hash, i)
+		}
+		transaction.BlockNumber = block.Number
+		transaction.Nonce = orDefault(transaction.Nonce, "0x0")
+		transaction.Value = orDefault(transaction.Value, "0x0")
+		transaction.Input = orDefault(transaction.Input, "0x")
+		transaction.GasPrice = orDefault(transaction.GasPrice, defaultGasPrice)
+		transaction.Gas = orDefault(transaction.Gas, transferGas)
+
+		receipt := ethereum_parser.Receipt{
+			TransactionHash:   transaction.Hash,
+			BlockNumber:       block.Number,
+			Status:            orDefault(transaction.Status, "0x1"),
+			GasUsed:           transferGas,
+			EffectiveGasPrice: transaction.GasPrice,
+		}
+
+		if transaction.To == "" {
+			receipt.ContractAddress = "0x" + hash("contract", transaction.Hash)[26:]
+		}
+
+		// Reverted transactions emit no logs
+		if receipt.Status == "0x1" {
+			for _, transfer := range transaction.TokenTransfers {
+				receipt.Logs = append(receipt.Logs, ethereum_parser.Log{
+					Address:         strings.ToLower(transfer.Token),
+					Topics:          []string{transferTopic, word(transfer.From), word(transfer.To)},
+					Data:            word(transfer.Value),
+					BlockNumber:     block.Number,
+					TransactionHash: transaction.Hash,
+					LogIndex:        quantity(logIndex),
+				})
+				logIndex++
+			}
+		}
+		gasUsed += 21000
+
+		transaction.Status = ""
+		transaction.TokenTransfers = nil
+		block.Transactions[i] = transaction
+
+		c.transactions[strings.ToLower(transaction.Hash)] = transaction
+		c.receipts[strings.ToLower(transaction.Hash)] = receipt
+		delete(c.pending, strings.ToLower(transaction.Hash))
+	}
+	block.GasUsed = quantity(gasUsed)
+	if c.verifiable {
+		c.seal(&block)
+	}
+
+	c.blocks = append(c.blocks, block)
+	c.byHash[strings.ToLower(block.Hash)] = number
+
+	for _, f := range c.filters {
+		if !f.pending {
+			f.hashes = append(f.hashes, block.Hash)
+		}
+	}
+
+	return block
+}
+
+// mine fills in the header of a block at the given height
+func (c *Chain) mine(block *ethereum_parser.Block, number int64, parent string) {
+	block.Number = quantity(number)
+	block.Hash = hash("block", number, c.fork)
+	block.ParentHash = parent
+	block.Timestamp = quantity(genesisTime + number*int64(c.blockTime/time.Second))
+	block.Miner = orDefault(block.Miner, "0x"+strings.Repeat("0", 40))
+	block.BaseFeePerGas = orDefault(block.BaseFeePerGas, defaultGasPrice)
+}
+
+// seal fills in the rest of the header of an empty block and hashes it the way a node does, so it passes verification
+func (c *Chain) seal(block *ethereum_parser.Block) {
+	block.Sha3Uncles = emptyUnclesHash
+	block.StateRoot = "0x" + strings.Repeat("0", 64)
+	block.TransactionsRoot = emptyTrieRoot
+	block.ReceiptsRoot = emptyTrieRoot
+	block.LogsBloom = "0x" + strings.Repeat("0", 512)
+	block.Difficulty = "0x0"
+	block.GasLimit = "0x1c9c380"
+	// Blocks mined again after a reorg are told apart by their extra data
+	block.ExtraData = fmt.Sprintf("0x%02x", c.fork)
+	block.MixHash = "0x" + strings.Repeat("0", 64)
+	block.Nonce = "0x0000000000000000"
+
+	hash, err := ethereum_parser.BlockHash(*block)
+	if err != nil {
+		panic(err)
+	}
+	block.Hash = hash
+}
+
+// Reorg drops the most recent blocks together with their transactions, the blocks mined next replace them with
+// other hashes. Dropped transactions are gone rather than back in the mempool.
+func (c *Chain) Reorg(depth int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if depth >= len(c.blocks) {
+		depth = len(c.blocks) - 1
+	}
+
+	for _, block := range c.blocks[len(c.blocks)-depth:] {
+		delete(c.byHash, strings.ToLower(block.Hash))
+		for _, transaction := range block.Transactions {
+			delete(c.transactions, strings.ToLower(transaction.Hash))
+			delete(c.receipts, strings.ToLower(transaction.Hash))
+		}
+	}
+
+	c.blocks = c.blocks[:len(c.blocks)-depth]
+	c.fork++
+}
+
+// AddPending puts a transaction in the mempool, reported to pending transaction filters until it is mined
+func (c *Chain) AddPending(transaction ethereum_parser.Transaction) ethereum_parser.Transaction {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if transaction.Hash == "" {
+		transaction.Hash = hash("pending", len(c.pending), c.fork, len(c.blocks))
+	}
+	transaction.BlockNumber = ""
+	c.pending[strings.ToLower(transaction.Hash)] = transaction
+
+	for _, f := range c.filters {
+		if f.pending {
+			f.hashes = append(f.hashes, transaction.Hash)
+		}
+	}
+
+	return transaction
+}
+
+// Drop removes a transaction from the mempool without mining it, as a node evicting it does
+func (c *Chain) Drop(hash string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	delete(c.pending, strings.ToLower(hash))
+}
+
+// SetCode deploys code to the address, every other address is an account
+func (c *Chain) SetCode(address string, code string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.code[strings.ToLower(address)] = code
+}
+
+// SetBalance sets the wei held by the address whatever the block asked for
+func (c *Chain) SetBalance(address string, balance string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.balances[strings.ToLower(address)] = balance
+}
+
+// SetCall sets what eth_call to the address with the data returns, any other call reverts
+func (c *Chain) SetCall(to string, data string, result string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.calls[callKey(to, data)] = result
+}
+
+// SetTraces sets the call trees debug_traceBlockByNumber returns for the block
+func (c *Chain) SetTraces(number int64, traces []ethereum_parser.TransactionTrace) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.traces[number] = traces
+}
+
+// SetParityTraces sets the traces trace_block returns for the block
+func (c *Chain) SetParityTraces(number int64, traces []ethereum_parser.ParityTrace) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.parityTraces[number] = traces
+}
+
+// ForgetFilters drops every filter, as a node does after a restart
+func (c *Chain) ForgetFilters() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.filters = make(map[string]*filter)
+}
+
+// Fail answers the next calls to the method with the error, an empty method failing calls to any method
+func (c *Chain) Fail(method string, times int, err ethereum_parser.RPCError) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.failures = append(c.failures, failure{method: method, times: times, err: err})
+}
+
+// Throttle rejects the next requests with 429 Too Many Requests, as providers do over their rate limit
+func (c *Chain) Throttle(requests int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.throttled += requests
+}
+
+// SetLatency delays every response, requests cancelled in the meantime get no response
+func (c *Chain) SetLatency(latency time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.latency = latency
+}
+
+// SetVerifiable makes the blocks mined next pass verification, only those without transactions do as the transactions
+// of the simulated chain are not signed
+func (c *Chain) SetVerifiable() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.verifiable = true
+}
+
+// SetBlockTime time between the timestamps of consecutive blocks, 12 seconds by default
+func (c *Chain) SetBlockTime(blockTime time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.blockTime = blockTime
+}
+
+// Requests how many requests for the method were received, throttled and failed ones included
+func (c *Chain) Requests(method string) int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.requests[method]
+}
+
+// URL of the JSON-RPC server
+func (c *Chain) URL() string {
+	return c.server.URL
+}
+
+// Client an Ethereum client talking to the simulated node
+func (c *Chain) Client() ethereum_parser.EthereumClient {
+	return ethereum_parser.NewEthereumClient(ethereum_parser.EthereumClientConfig{Addr: c.URL(), JsonRPC: "2.0"})
+}
+
+func (c *Chain) Close() {
+	c.server.Close()
+}
+
+func (c *Chain) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mux.Lock()
+	c.requests[request.Method]++
+	latency := c.latency
+	throttled := c.throttled > 0
+	if throttled {
+		c.throttled--
+	}
+	c.mux.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if throttled {
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+	if result, err := c.handle(request.Method, request.Params); err != nil {
+		response["error"] = err
+	} else {
+		response["result"] = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// handle answers a JSON-RPC call, nil results are sent as null the way nodes answer for unknown blocks and hashes
+func (c *Chain) handle(method string, params []json.RawMessage) (interface{}, *ethereum_parser.RPCError) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for i, f := range c.failures {
+		if f.times > 0 && (f.method == "" || f.method == method) {
+			c.failures[i].times--
+			err := f.err
+			return nil, &err
+		}
+	}
+
+	switch method {
+	case "eth_chainId":
+		return quantity(c.chainID), nil
+	case "eth_blockNumber":
+		return quantity(int64(len(c.blocks) - 1)), nil
+	case "eth_getBlockByNumber":
+		number, err := c.blockParameter(param(params, 0))
+		if err != nil {
+			return nil, err
+		}
+		if number < 0 || number >= int64(len(c.blocks)) {
+			return nil, nil
+		}
+		return c.blocks[number], nil
+	case "eth_getBlockByHash":
+		number, ok := c.byHash[strings.ToLower(param(params, 0))]
+		if !ok {
+			return nil, nil
+		}
+		return c.blocks[number], nil
+	case "eth_getTransactionByHash":
+		if transaction, ok := c.transactions[strings.ToLower(param(params, 0))]; ok {
+			return transaction, nil
+		}
+		if transaction, ok := c.pending[strings.ToLower(param(params, 0))]; ok {
+			return transaction, nil
+		}
+		return nil, nil
+	case "eth_getTransactionReceipt":
+		receipt, ok := c.receipts[strings.ToLower(param(params, 0))]
+		if !ok {
+			return nil, nil
+		}
+		return receipt, nil
+	case "eth_getLogs":
+		return c.logs(params)
+	case "eth_getCode":
+		return orDefault(c.code[strings.ToLower(param(params, 0))], "0x"), nil
+	case "eth_getBalance":
+		return orDefault(c.balances[strings.ToLower(param(params, 0))], "0x0"), nil
+	case "eth_call":
+		var msg ethereum_parser.CallMsg
+		if len(params) == 0 || json.Unmarshal(params[0], &msg) != nil {
+			return nil, invalidParams("call")
+		}
+		result, ok := c.calls[callKey(msg.To, msg.Data)]
+		if !ok {
+			return nil, &ethereum_parser.RPCError{Code: 3, Message: "execution reverted"}
+		}
+		return result, nil
+	case "debug_traceBlockByNumber":
+		number, err := c.blockParameter(param(params, 0))
+		if err != nil {
+			return nil, err
+		}
+		return c.traces[number], nil
+	case "trace_block":
+		number, err := c.blockParameter(param(params, 0))
+		if err != nil {
+			return nil, err
+		}
+		return c.parityTraces[number], nil
+	case "eth_newBlockFilter", "eth_newPendingTransactionFilter":
+		c.lastFilter++
+		id := quantity(int64(c.lastFilter))
+		c.filters[id] = &filter{pending: method == "eth_newPendingTransactionFilter"}
+		return id, nil
+	case "eth_getFilterChanges":
+		f, ok := c.filters[param(params, 0)]
+		if !ok {
+			return nil, &ethereum_parser.RPCError{Code: -32000, Message: "filter not found"}
+		}
+		hashes := append([]string{}, f.hashes...)
+		f.hashes = nil
+		return hashes, nil
+	case "eth_uninstallFilter":
+		_, ok := c.filters[param(params, 0)]
+		delete(c.filters, param(params, 0))
+		return ok, nil
+	default:
+		return nil, &ethereum_parser.RPCError{Code: -32601, Message: fmt.Sprintf("the method %v does not exist/is not available", method)}
+	}
+}
+
+// logs the logs of the canonical blocks matching the filter
+func (c *Chain) logs(params []json.RawMessage) (interface{}, *ethereum_parser.RPCError) {
+	var logFilter ethereum_parser.LogFilter
+	if len(params) == 0 || json.Unmarshal(params[0], &logFilter) != nil {
+		return nil, invalidParams("log filter")
+	}
+
+	var from, to int64
+	if logFilter.BlockHash != "" {
+		number, ok := c.byHash[strings.ToLower(logFilter.BlockHash)]
+		if !ok {
+			return nil, &ethereum_parser.RPCError{Code: -32000, Message: "unknown block"}
+		}
+		from, to = number, number
+	} else {
+		var err *ethereum_parser.RPCError
+		if from, err = c.blockParameter(orDefault(logFilter.FromBlock, "latest")); err != nil {
+			return nil, err
+		}
+		if to, err = c.blockParameter(orDefault(logFilter.ToBlock, "latest")); err != nil {
+			return nil, err
+		}
+	}
+
+	logs := []ethereum_parser.Log{}
+	for number := from; number <= to && number < int64(len(c.blocks)); number++ {
+		for _, transaction := range c.blocks[number].Transactions {
+			for _, l := range c.receipts[strings.ToLower(transaction.Hash)].Logs {
+				if logFilter.Matches(l) {
+					logs = append(logs, l)
+				}
+			}
+		}
+	}
+
+	return logs, nil
+}
+
+// blockParameter the number a block parameter stands for, every tag past the head meaning the head
+func (c *Chain) blockParameter(value string) (int64, *ethereum_parser.RPCError) {
+	switch value {
+	case "latest", "pending", "safe", "finalized":
+		return int64(len(c.blocks) - 1), nil
+	case "earliest":
+		return 0, nil
+	}
+
+	number, err := strconv.ParseInt(value, 0, 64)
+	if err != nil {
+		return 0, invalidParams("block number " + value)
+	}
+
+	return number, nil
+}
+
+// NewChain starts a simulated node holding only a genesis block
+func NewChain(chainID int64) *Chain {
+	c := &Chain{
+		chainID:      chainID,
+		blockTime:    12 * time.Second,
+		byHash:       make(map[string]int64),
+		transactions: make(map[string]ethereum_parser.Transaction),
+		receipts:     make(map[string]ethereum_parser.Receipt),
+		pending:      make(map[string]ethereum_parser.Transaction),
+		code:         make(map[string]string),
+		balances:     make(map[string]string),
+		calls:        make(map[string]string),
+		traces:       make(map[int64][]ethereum_parser.TransactionTrace),
+		parityTraces: make(map[int64][]ethereum_parser.ParityTrace),
+		filters:      make(map[string]*filter),
+		requests:     make(map[string]int),
+	}
+
+	genesis := ethereum_parser.Block{}
+	c.mine(&genesis, 0, "0x"+strings.Repeat("0", 64))
+	genesis.GasUsed = "0x0"
+	c.blocks = append(c.blocks, genesis)
+	c.byHash[strings.ToLower(genesis.Hash)] = 0
+
+	c.server = httptest.NewServer(c)
+
+	return c
+}
+
+// param a string parameter, empty when missing
+func param(params []json.RawMessage, i int) string {
+	var value string
+	if i < len(params) {
+		_ = json.Unmarshal(params[i], &value)
+	}
+
+	return value
+}
+
+func invalidParams(what string) *ethereum_parser.RPCError {
+	return &ethereum_parser.RPCError{Code: -32602, Message: "invalid " + what}
+}
+
+// hash a 32 byte hash made up from the values
+func hash(values ...interface{}) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%v", values)))
+	return "0x" + hex.EncodeToString(sum[:])
+}
+
+// word left pads an address or quantity to 32 bytes, as topics and log data are
+func word(value string) string {
+	value = strings.TrimPrefix(strings.ToLower(value), "0x")
+	return "0x" + strings.Repeat("0", 64-len(value)) + value
+}
+
+func callKey(to string, data string) string {
+	return strings.ToLower(to) + "/" + strings.ToLower(data)
+}
+
+func quantity(value int64) string {
+	return fmt.Sprintf("0x%x", value)
+}
+
+func orDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+const (
+	transferTopic   = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	transferGas     = "0x5208"
+	defaultGasPrice = "0x3b9aca00"
+	// genesisTime timestamp of the genesis block
+	genesisTime = 1700000000
+	// emptyUnclesHash and emptyTrieRoot what the header of a block without uncles, transactions and receipts commits to
+	emptyUnclesHash = "0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347"
+	emptyTrieRoot   = "0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"
+)
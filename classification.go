@@ -0,0 +1,115 @@
+package ethereum_parser
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// TransactionKind what a transaction did, decided once the receipt is known
+type TransactionKind string
+
+// classify a deployment has no recipient, anything moving tokens is a token transfer whatever else it did,
+// the rest depends on whether the recipient holds code
+func classify(ctx context.Context, codes *codeCache, transaction Transaction, receipt Receipt) (TransactionKind, error) {
+	if transaction.To == "" || receipt.ContractAddress != "" {
+		return TransactionKindContractDeployment, nil
+	}
+
+	if len(transaction.TokenTransfers) > 0 || isTokenTransferInput(transaction.Input) {
+		return TransactionKindTokenTransfer, nil
+	}
+
+	contract, err := codes.IsContract(ctx, transaction.To, transaction.BlockNumber)
+	if err != nil {
+		return "", err
+	}
+
+	if contract {
+		return TransactionKindContractCall, nil
+	}
+
+	return TransactionKindTransfer, nil
+}
+
+// isTokenTransferInput failed token transfers emit no logs, the call data still gives them away
+func isTokenTransferInput(input string) bool {
+	selector := strings.ToLower(strings.TrimPrefix(input, "0x"))
+	if len(selector) < 8 {
+		return false
+	}
+
+	switch selector[:8] {
+	case transferSelector, transferFromSelector:
+		return true
+	default:
+		return false
+	}
+}
+
+// codeCache remembers which addresses hold code. Code does not go away once deployed, while an account can still get
+// code deployed to it later on (counterfactual wallets), so accounts are only trusted up to the block they were checked at.
+type codeCache struct {
+	mux sync.Mutex
+
+	client    ethereumClient
+	contracts map[string]bool
+	// accounts block number up to which the address was known to have no code
+	accounts map[string]int64
+}
+
+// IsContract whether the address held code at the given block
+func (c *codeCache) IsContract(ctx context.Context, address string, blockNumber string) (bool, error) {
+	address = strings.ToLower(address)
+	number, err := hexDecoder(blockNumber)
+	if err != nil {
+		return false, err
+	}
+
+	c.mux.Lock()
+	contract := c.contracts[address]
+	checked, ok := c.accounts[address]
+	c.mux.Unlock()
+
+	if contract {
+		return true, nil
+	}
+
+	if ok && number <= checked {
+		return false, nil
+	}
+
+	code, err := c.client.GetCode(ctx, address, number)
+	if err != nil {
+		return false, err
+	}
+
+	contract = code != "" && code != "0x"
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if contract {
+		c.contracts[address] = true
+		delete(c.accounts, address)
+	} else if number > c.accounts[address] {
+		c.accounts[address] = number
+	}
+
+	return contract, nil
+}
+
+func newCodeCache(client ethereumClient) *codeCache {
+	return &codeCache{
+		client:    client,
+		contracts: make(map[string]bool),
+		accounts:  make(map[string]int64),
+	}
+}
+
+const (
+	TransactionKindTransfer           TransactionKind = "transfer"
+	TransactionKindContractCall       TransactionKind = "contractCall"
+	TransactionKindContractDeployment TransactionKind = "contractDeployment"
+	TransactionKindTokenTransfer      TransactionKind = "tokenTransfer"
+)
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"ethereum_parser"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// Writes a range of blocks from a node as a dump the parser can be pointed at with DUMP or the dump of a chain,
+// gzip compressed when the output ends with .gz
+func main() {
+	rpcURL := flag.String("rpc", "https://cloudflare-eth.com", "json-rpc url of the node")
+	jsonRPC := flag.String("jsonrpc", "2.0", "json-rpc version")
+	from := flag.Int64("from", 0, "first block to dump")
+	to := flag.Int64("to", 0, "last block to dump, inclusive")
+	output := flag.String("out", "", "file to write, standard output when empty")
+	flag.Parse()
+
+	if *from <= 0 || *to < *from {
+		log.Fatal("-from and -to need to be a range of blocks")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	client := ethereum_parser.NewEthereumClient(ethereum_parser.EthereumClientConfig{Addr: *rpcURL, JsonRPC: *jsonRPC})
+	if err := dump(ctx, client, *output, *from, *to); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Dumped blocks %d to %d", *from, *to)
+}
+
+// dump writes the blocks, closing the output before returning so even a dump cut short can be read
+func dump(ctx context.Context, client ethereum_parser.EthereumClient, output string, from int64, to int64) (err error) {
+	if output == "" {
+		return ethereum_parser.WriteDump(ctx, client, os.Stdout, from, to)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to close the dump: %v", closeErr)
+		}
+	}()
+
+	var w io.Writer = file
+	if strings.HasSuffix(output, ".gz") {
+		gz := gzip.NewWriter(file)
+		defer func() {
+			if closeErr := gz.Close(); err == nil && closeErr != nil {
+				err = fmt.Errorf("failed to finish the compressed dump: %v", closeErr)
+			}
+		}()
+		w = gz
+	}
+
+	return ethereum_parser.WriteDump(ctx, client, w, from, to)
+}
@@ -36,7 +36,8 @@ func main() {
 	wg := new(sync.WaitGroup)
 	defer wg.Wait()
 
-	newSub := make(chan bool)
+	// Subscriptions, parsed blocks and matched transactions are published here for whoever is interested
+	bus := ethereum_parser.NewEventBus()
 
 	// Initializing services
 	var ethConfig ethereum_parser.EthereumClientConfig
@@ -44,9 +45,137 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
-	ethereumClient := ethereum_parser.NewEthereumClient(ethConfig)
+	var parserConfig ethereum_parser.ParserConfig
+	if err := env.Parse(&parserConfig); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	var chainsConfig ethereum_parser.ChainsConfig
+	if err := env.Parse(&chainsConfig); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	chainConfigs, err := ethereum_parser.LoadChains(chainsConfig, ethConfig, parserConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var abis *ethereum_parser.ABIRegistry
+	if parserConfig.ABIDir != "" {
+		if abis, err = ethereum_parser.LoadABIRegistry(parserConfig.ABIDir); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Loaded %d functions from %v", abis.Len(), parserConfig.ABIDir)
+	}
+
+	var balanceConfig ethereum_parser.BalanceConfig
+	if err := env.Parse(&balanceConfig); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	var pendingConfig ethereum_parser.PendingConfig
+	if err := env.Parse(&pendingConfig); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	var ensConfig ethereum_parser.ENSConfig
+	if err := env.Parse(&ensConfig); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	var supervisorConfig ethereum_parser.SupervisorConfig
+	if err := env.Parse(&supervisorConfig); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	var notifierConfig ethereum_parser.NotifierConfig
+	if err := env.Parse(&notifierConfig); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	sinks := []ethereum_parser.NotificationSink{ethereum_parser.LogSink{}}
+	if notifierConfig.WebhookURL != "" {
+		sinks = append(sinks, ethereum_parser.NewWebhookSink(notifierConfig.WebhookURL))
+	}
+
+	// Every chain gets its own client, only a chain without a configured chain id needs its node up to start
+	var chains []ethereum_parser.Chain
+	for _, chainConfig := range chainConfigs {
+		chain, err := ethereum_parser.NewChain(context.Background(), chainConfig, ethConfig.JsonRPC)
+		if err != nil {
+			log.Fatal(err)
+		}
+		chains = append(chains, chain)
+	}
+
 	repo := ethereum_parser.NewMemStorage()
-	service := ethereum_parser.NewService(&repo, ethereumClient, newSub)
+	deadLetters := ethereum_parser.NewMemDeadLetterStorage()
+	notifier := ethereum_parser.NewNotifier(notifierConfig, &deadLetters, sinks...)
+	digester := ethereum_parser.NewDigester(notifier)
+
+	// Optionally resolving ENS names through the chain the registry lives on
+	var ens *ethereum_parser.ENSResolver
+	if ensConfig.Enabled {
+		for _, chain := range chains {
+			if chain.Config.ChainID == ensConfig.ChainID {
+				resolver := ethereum_parser.NewENSResolver(ensConfig, chain.Client)
+				ens = &resolver
+			}
+		}
+
+		if ens == nil {
+			log.Fatalf("ens needs chain %d to be configured", ensConfig.ChainID)
+		}
+
+		go ens.Refresh(context.Background(), &repo, bus, wg)
+		wg.Add(1)
+	}
+
+	var supervisors []*ethereum_parser.Supervisor
+	for _, chain := range chains {
+		// Optionally following subscriber transactions from the mempool
+		var pendingWatcher *ethereum_parser.PendingWatcher
+		if pendingConfig.Enabled {
+			watcher := ethereum_parser.NewPendingWatcher(pendingConfig, chain.Config.ChainID, &repo, chain.Client, notifier)
+			pendingWatcher = &watcher
+
+			// Supervised like the parser, a failing node degrades the mempool watching rather than exiting
+			pendingSupervisor := ethereum_parser.NewPendingSupervisor(supervisorConfig, chain.Config, pendingWatcher)
+			supervisors = append(supervisors, pendingSupervisor)
+			go func() {
+				if err := pendingSupervisor.Run(context.Background(), wg); err != nil {
+					log.Println(err)
+				}
+			}()
+			wg.Add(1)
+		}
+
+		// Optionally keeping the balances of subscribers up to date
+		var balanceTracker *ethereum_parser.BalanceTracker
+		if balanceConfig.Enabled {
+			tracker := ethereum_parser.NewBalanceTracker(balanceConfig, chain.Config.ChainID, &repo, chain.Client)
+			balanceTracker = &tracker
+		}
+
+		// Start parsing service, one per chain each with its own cursor
+		parserService, err := ethereum_parser.NewParserService(chain.Config, &repo, chain.Client, notifier, &digester, pendingWatcher, abis, balanceTracker, bus)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Supervised so a failing node degrades the chain rather than taking the API down
+		supervisor := ethereum_parser.NewSupervisor(supervisorConfig, chain.Config, parserService, bus)
+		supervisors = append(supervisors, supervisor)
+		go func() {
+			if err := supervisor.Run(context.Background(), wg); err != nil {
+				log.Println(err)
+			}
+		}()
+
+		wg.Add(1)
+	}
+
+	service := ethereum_parser.NewService(&repo, &deadLetters, chains, notifier, bus, ens, supervisors)
 	h := ethereum_parser.NewHTTPHandlers(&service)
 
 	// Wiring up API
@@ -70,15 +199,8 @@ func main() {
 
 	fmt.Printf("Running on %v\n", config.Address)
 
-	// Start parsing service
-	parserService := ethereum_parser.NewParserService(&repo, ethereumClient)
-	go func() {
-		err := parserService.Parse(context.Background(), newSub, wg)
-		if err != nil {
-			log.Fatal(err)
-		}
-	}()
-
+	// Digests are flushed in the background once their window elapses
+	go digester.Run(context.Background(), wg)
 	wg.Add(1)
 
 	// Graceful and eager terminations
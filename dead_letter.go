@@ -0,0 +1,143 @@
+package ethereum_parser
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter an event that a sink failed to receive after all retries
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Sink     string    `json:"sink"`
+	Event    Event     `json:"event"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	Replays  int       `json:"replays"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// DeadLetterStats counters of dead-lettered events for a single sink
+type DeadLetterStats struct {
+	Sink string `json:"sink"`
+	// Total number of events that have ever been dead-lettered for the sink
+	Total int64 `json:"total"`
+	// Pending number of events still waiting to be replayed or discarded
+	Pending int `json:"pending"`
+}
+
+type InMemDeadLetterStorage struct {
+	mux sync.Mutex
+
+	deadLetters map[string]DeadLetter
+	totals      map[string]int64
+}
+
+func (s *InMemDeadLetterStorage) AddDeadLetter(_ context.Context, deadLetter DeadLetter) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.deadLetters[deadLetter.ID] = deadLetter
+	s.totals[deadLetter.Sink]++
+
+	return nil
+}
+
+func (s *InMemDeadLetterStorage) UpdateDeadLetter(_ context.Context, deadLetter DeadLetter) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, ok := s.deadLetters[deadLetter.ID]; !ok {
+		return ErrDeadLetterNotFound
+	}
+
+	s.deadLetters[deadLetter.ID] = deadLetter
+
+	return nil
+}
+
+func (s *InMemDeadLetterStorage) GetDeadLetters(_ context.Context, sink string) ([]DeadLetter, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var deadLetters []DeadLetter
+	for _, deadLetter := range s.deadLetters {
+		if sink == "" || deadLetter.Sink == sink {
+			deadLetters = append(deadLetters, deadLetter)
+		}
+	}
+
+	sort.Slice(deadLetters, func(i, j int) bool {
+		return deadLetters[i].FailedAt.Before(deadLetters[j].FailedAt)
+	})
+
+	return deadLetters, nil
+}
+
+func (s *InMemDeadLetterStorage) GetDeadLetter(_ context.Context, id string) (DeadLetter, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.deadLetters[id], nil
+}
+
+func (s *InMemDeadLetterStorage) RemoveDeadLetter(_ context.Context, id string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.deadLetters, id)
+
+	return nil
+}
+
+func (s *InMemDeadLetterStorage) GetDeadLetterStats(_ context.Context) ([]DeadLetterStats, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	pending := make(map[string]int)
+	for _, deadLetter := range s.deadLetters {
+		pending[deadLetter.Sink]++
+	}
+
+	var stats []DeadLetterStats
+	for sink, total := range s.totals {
+		stats = append(stats, DeadLetterStats{Sink: sink, Total: total, Pending: pending[sink]})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Sink < stats[j].Sink
+	})
+
+	return stats, nil
+}
+
+func NewMemDeadLetterStorage() InMemDeadLetterStorage {
+	return InMemDeadLetterStorage{
+		deadLetters: make(map[string]DeadLetter),
+		totals:      make(map[string]int64),
+	}
+}
+
+type DeadLetterRepository interface {
+	// AddDeadLetter stores an event that exhausted its retries and counts it against its sink
+	AddDeadLetter(ctx context.Context, deadLetter DeadLetter) error
+
+	// UpdateDeadLetter overwrites an existing dead letter, used after a failed replay
+	UpdateDeadLetter(ctx context.Context, deadLetter DeadLetter) error
+
+	// GetDeadLetters retrieves dead letters for a sink ordered by failure time, empty sink returns all of them
+	GetDeadLetters(ctx context.Context, sink string) ([]DeadLetter, error)
+
+	// GetDeadLetter retrieves a single dead letter, a missing one is returned empty
+	GetDeadLetter(ctx context.Context, id string) (DeadLetter, error)
+
+	// RemoveDeadLetter deletes a dead letter once it has been replayed or discarded
+	RemoveDeadLetter(ctx context.Context, id string) error
+
+	// GetDeadLetterStats retrieves the dead-letter counters per sink
+	GetDeadLetterStats(ctx context.Context) ([]DeadLetterStats, error)
+}
@@ -0,0 +1,216 @@
+package ethereum_parser
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Digest aggregation of the events held back for a subscription using digest delivery
+type Digest struct {
+	Count    int                    `json:"count"`
+	CountIn  int                    `json:"countIn"`
+	CountOut int                    `json:"countOut"`
+	Totals   map[string]DigestTotal `json:"totals"`
+	Hashes   []string               `json:"hashes"`
+	// Withdrawals indices of the beacon chain withdrawals in the digest
+	Withdrawals []string  `json:"withdrawals,omitempty"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+}
+
+// DigestTotal value moved in and out of the subscribed address for a single asset, in base units
+type DigestTotal struct {
+	In  string `json:"in"`
+	Out string `json:"out"`
+}
+
+// Digester holds back events of digest subscriptions until their window elapses or enough of them pile up
+type Digester struct {
+	mux sync.Mutex
+
+	notifier Notifier
+	batches  map[string]*digestBatch
+}
+
+type digestBatch struct {
+	chainID      int64
+	subscription Subscription
+	events       []Event
+	opened       time.Time
+}
+
+// Add queues an event for the subscription, sending the digest straight away once the batch is full.
+// Every chain gets its own digest.
+func (d *Digester) Add(ctx context.Context, subscription Subscription, event Event) error {
+	key := fmt.Sprintf("%d:%v", event.ChainID, subscription.Address)
+
+	d.mux.Lock()
+	batch, ok := d.batches[key]
+	if !ok {
+		batch = &digestBatch{chainID: event.ChainID, opened: time.Now().UTC()}
+		d.batches[key] = batch
+	}
+
+	// Keeping the latest options, the subscriber might have changed them while the batch was open
+	batch.subscription = subscription
+	batch.events = append(batch.events, event)
+
+	var full *digestBatch
+	if size := subscription.Options.DigestSize; size > 0 && len(batch.events) >= size {
+		full = batch
+		delete(d.batches, key)
+	}
+	d.mux.Unlock()
+
+	if full == nil {
+		return nil
+	}
+
+	return d.send(ctx, full)
+}
+
+// Run flushes batches whose window has elapsed until the context is done, whatever is left is flushed on the way out
+func (d *Digester) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(digestTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.Flush(ctx, false)
+		case <-ctx.Done():
+			// Parent context is gone, the remaining digests still deserve a delivery attempt
+			d.Flush(context.Background(), true)
+			return
+		}
+	}
+}
+
+// Flush sends the digests whose window has elapsed, or all of them when forced
+func (d *Digester) Flush(ctx context.Context, force bool) {
+	now := time.Now().UTC()
+
+	d.mux.Lock()
+	var due []*digestBatch
+	for key, batch := range d.batches {
+		if force || now.Sub(batch.opened) >= batch.subscription.Options.DigestWindow {
+			due = append(due, batch)
+			delete(d.batches, key)
+		}
+	}
+	d.mux.Unlock()
+
+	for _, batch := range due {
+		if err := d.send(ctx, batch); err != nil {
+			log.Printf("There was an issue trying to send the digest for %v: %v", batch.subscription.Address, err)
+		}
+	}
+}
+
+func (d *Digester) send(ctx context.Context, batch *digestBatch) error {
+	return d.notifier.Notify(ctx, Event{
+		ID:        newID(),
+		Type:      EventTypeDigest,
+		ChainID:   batch.chainID,
+		Address:   batch.subscription.Address,
+		Wallet:    batch.subscription.Wallet,
+		Digest:    summarise(batch, time.Now().UTC()),
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// summarise totals the transfers of the subscription across the batched events
+func summarise(batch *digestBatch, closed time.Time) *Digest {
+	digest := &Digest{
+		Count:  len(batch.events),
+		Totals: make(map[string]DigestTotal),
+		From:   batch.opened,
+		To:     closed,
+	}
+
+	totalsIn := make(map[string]*big.Int)
+	totalsOut := make(map[string]*big.Int)
+	address := batch.subscription.Address
+	for _, event := range batch.events {
+		if event.Withdrawal != nil {
+			digest.Withdrawals = append(digest.Withdrawals, event.Withdrawal.Index)
+		} else {
+			digest.Hashes = append(digest.Hashes, event.Transaction.Hash)
+		}
+
+		var in, out bool
+		for _, transfer := range event.Transfers() {
+			if !batch.subscription.MatchesTransfer(transfer) {
+				continue
+			}
+
+			value, err := quantityToBig(transfer.Value)
+			if err != nil || event.Transaction.Failed() {
+				// Reverted transactions did not move anything
+				value = new(big.Int)
+			}
+
+			if strings.EqualFold(transfer.To, address) {
+				in = true
+				addTotal(totalsIn, transfer.Asset, value)
+			}
+
+			if strings.EqualFold(transfer.From, address) {
+				out = true
+				addTotal(totalsOut, transfer.Asset, value)
+			}
+		}
+
+		if in {
+			digest.CountIn++
+		}
+
+		if out {
+			digest.CountOut++
+		}
+	}
+
+	for asset := range totalsIn {
+		digest.Totals[asset] = DigestTotal{In: bigToQuantity(totalsIn[asset]), Out: bigToQuantity(totalsOut[asset])}
+	}
+
+	for asset := range totalsOut {
+		digest.Totals[asset] = DigestTotal{In: bigToQuantity(totalsIn[asset]), Out: bigToQuantity(totalsOut[asset])}
+	}
+
+	return digest
+}
+
+func addTotal(totals map[string]*big.Int, asset string, value *big.Int) {
+	if _, ok := totals[asset]; !ok {
+		totals[asset] = new(big.Int)
+	}
+
+	totals[asset].Add(totals[asset], value)
+}
+
+// bigToQuantity encodes a value the same way the node does, a missing value is zero
+func bigToQuantity(value *big.Int) string {
+	if value == nil {
+		return "0x0"
+	}
+
+	return "0x" + value.Text(16)
+}
+
+func NewDigester(notifier Notifier) Digester {
+	return Digester{
+		notifier: notifier,
+		batches:  make(map[string]*digestBatch),
+	}
+}
+
+// digestTickInterval how often the windows are checked, can move internal to environment
+const digestTickInterval = time.Second
@@ -0,0 +1,401 @@
+package ethereum_parser
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var _ ethereumClient = DumpClient{}
+
+var ErrNotInDump = errors.New("not available from block dumps")
+
+// DumpBlock a line of a dump, the eth_getBlockByNumber result with full transactions. The receipts of its
+// transactions and which of their recipients hold code are optional, without them transactions have no status, fee
+// or logs and every recipient is taken for an account.
+type DumpBlock struct {
+	Block
+	Receipts []Receipt `json:"receipts,omitempty"`
+	// Contracts recipients of the transactions of the block holding code at the block
+	Contracts []string `json:"contracts,omitempty"`
+}
+
+// DumpClient serves the parser from block dumps instead of a node, so history can be parsed again without one. The
+// dumps are read into memory up front, state such as balances, calls and traces is not available offline.
+type DumpClient struct {
+	chainID int64
+
+	numbers []int64
+	blocks  map[int64]Block
+	byHash  map[string]int64
+	// transactions block number by transaction hash
+	transactions map[string]int64
+	receipts     map[string]Receipt
+	// contracts addresses holding code by block number
+	contracts map[int64]map[string]bool
+}
+
+// GetCurrentBlock the highest block of the dumps
+func (c DumpClient) GetCurrentBlock(_ context.Context) (int64, error) {
+	if len(c.numbers) == 0 {
+		return 0, fmt.Errorf("%w: the dumps hold no blocks", ErrNotInDump)
+	}
+
+	return c.numbers[len(c.numbers)-1], nil
+}
+
+// FirstBlock the lowest block of the dumps, where parsing them starts
+func (c DumpClient) FirstBlock() int64 {
+	if len(c.numbers) == 0 {
+		return 0
+	}
+
+	return c.numbers[0]
+}
+
+// GetBlockByNumber returns an empty block when the dumps do not have it, as the node does for blocks it does not know
+func (c DumpClient) GetBlockByNumber(_ context.Context, number int64) (Block, error) {
+	return c.blocks[number], nil
+}
+
+func (c DumpClient) GetBlockByHash(_ context.Context, hash string) (Block, error) {
+	number, ok := c.byHash[strings.ToLower(hash)]
+	if !ok {
+		return Block{}, nil
+	}
+
+	return c.blocks[number], nil
+}
+
+func (c DumpClient) GetTransactionReceipt(_ context.Context, hash string) (Receipt, error) {
+	return c.receipts[strings.ToLower(hash)], nil
+}
+
+// GetLogs the logs of the dumped receipts matching the filter
+func (c DumpClient) GetLogs(_ context.Context, filter LogFilter) ([]Log, error) {
+	from, to := int64(0), int64(0)
+	if filter.BlockHash != "" {
+		number, ok := c.byHash[strings.ToLower(filter.BlockHash)]
+		if !ok {
+			return nil, nil
+		}
+		from, to = number, number
+	} else {
+		var err error
+		if from, err = c.blockParameter(filter.FromBlock); err != nil {
+			return nil, err
+		}
+		if to, err = c.blockParameter(filter.ToBlock); err != nil {
+			return nil, err
+		}
+	}
+
+	var logs []Log
+	for _, number := range c.numbers {
+		if number < from || number > to {
+			continue
+		}
+
+		for _, transaction := range c.blocks[number].Transactions {
+			for _, l := range c.receipts[strings.ToLower(transaction.Hash)].Logs {
+				if filter.Matches(l) {
+					logs = append(logs, l)
+				}
+			}
+		}
+	}
+
+	return logs, nil
+}
+
+// blockParameter block numbers of a log filter, missing or latest meaning the highest block
+func (c DumpClient) blockParameter(value string) (int64, error) {
+	if value == "" || value == "latest" {
+		return c.GetCurrentBlock(context.Background())
+	}
+
+	if value == "earliest" {
+		return c.FirstBlock(), nil
+	}
+
+	return hexDecoder(value)
+}
+
+func (c DumpClient) GetTransactionByHash(_ context.Context, hash string) (Transaction, error) {
+	number, ok := c.transactions[strings.ToLower(hash)]
+	if !ok {
+		return Transaction{}, nil
+	}
+
+	for _, transaction := range c.blocks[number].Transactions {
+		if strings.EqualFold(transaction.Hash, hash) {
+			return transaction, nil
+		}
+	}
+
+	return Transaction{}, nil
+}
+
+func (c DumpClient) NewPendingTransactionFilter(_ context.Context) (string, error) {
+	return "", fmt.Errorf("%w: there is no mempool", ErrNotInDump)
+}
+
+func (c DumpClient) GetFilterChanges(_ context.Context, _ string) ([]string, error) {
+	return nil, fmt.Errorf("%w: filters", ErrNotInDump)
+}
+
+func (c DumpClient) UninstallFilter(_ context.Context, _ string) (bool, error) {
+	return false, nil
+}
+
+func (c DumpClient) NewBlockFilter(_ context.Context) (string, error) {
+	return "", fmt.Errorf("%w: filters, use the number poll mode", ErrNotInDump)
+}
+
+func (c DumpClient) ChainID(_ context.Context) (int64, error) {
+	return c.chainID, nil
+}
+
+// GetCode only knows whether an address holds code, which is all the classification needs, so contracts get a single
+// INVALID opcode
+func (c DumpClient) GetCode(_ context.Context, address string, number int64) (string, error) {
+	if c.contracts[number][strings.ToLower(address)] {
+		return dumpedCode, nil
+	}
+
+	return "0x", nil
+}
+
+func (c DumpClient) GetBalance(_ context.Context, address string, _ int64) (string, error) {
+	return "", fmt.Errorf("%w: balance of %v", ErrNotInDump, address)
+}
+
+func (c DumpClient) Call(_ context.Context, msg CallMsg, _ int64) (string, error) {
+	return "", fmt.Errorf("%w: call to %v", ErrNotInDump, msg.To)
+}
+
+func (c DumpClient) TraceBlockByNumber(_ context.Context, number int64) ([]TransactionTrace, error) {
+	return nil, fmt.Errorf("%w: traces of block %d", ErrNotInDump, number)
+}
+
+func (c DumpClient) TraceBlock(_ context.Context, number int64) ([]ParityTrace, error) {
+	return nil, fmt.Errorf("%w: traces of block %d", ErrNotInDump, number)
+}
+
+// add indexes a dumped block, a block dumped twice replaces the earlier one
+func (c *DumpClient) add(dumped DumpBlock) error {
+	number, err := hexDecoder(dumped.Number)
+	if err != nil {
+		return fmt.Errorf("invalid number of block %v: %v", dumped.Hash, err)
+	}
+
+	if _, ok := c.blocks[number]; !ok {
+		c.numbers = append(c.numbers, number)
+	}
+
+	c.blocks[number] = dumped.Block
+	c.byHash[strings.ToLower(dumped.Hash)] = number
+
+	for _, transaction := range dumped.Transactions {
+		c.transactions[strings.ToLower(transaction.Hash)] = number
+	}
+
+	for _, receipt := range dumped.Receipts {
+		c.receipts[strings.ToLower(receipt.TransactionHash)] = receipt
+	}
+
+	c.contracts[number] = make(map[string]bool)
+	for _, contract := range dumped.Contracts {
+		c.contracts[number][strings.ToLower(contract)] = true
+	}
+
+	return nil
+}
+
+// signedChainID the chain id typed transactions carry, or legacy ones fold into v since EIP-155, zero when no
+// transaction gives it away
+func (c DumpClient) signedChainID() int64 {
+	for _, number := range c.numbers {
+		for _, transaction := range c.blocks[number].Transactions {
+			if transaction.Type != "" && transaction.Type != "0x0" && transaction.ChainID != "" {
+				if chainID, err := hexDecoder(transaction.ChainID); err == nil {
+					return chainID
+				}
+			}
+
+			if v, err := hexDecoder(orZero(transaction.V)); err == nil && v >= 35 {
+				return (v - 35) / 2
+			}
+		}
+	}
+
+	return 0
+}
+
+// load reads a dump file, gzip compressed or not, one JSON block after the other
+func (c *DumpClient) load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open dump %v: %v", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	reader := bufio.NewReader(file)
+	var source io.Reader = reader
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("failed to decompress dump %v: %v", path, err)
+		}
+		defer func() {
+			_ = gz.Close()
+		}()
+		source = gz
+	}
+
+	decoder := json.NewDecoder(source)
+	for line := 1; ; line++ {
+		var dumped DumpBlock
+		if err := decoder.Decode(&dumped); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read block %d of dump %v: %v", line, path, err)
+		}
+
+		if err := c.add(dumped); err != nil {
+			return fmt.Errorf("block %d of dump %v: %v", line, path, err)
+		}
+	}
+}
+
+// NewDumpClient reads every dump matching the glob pattern. Dumps do not say which chain they are from, without a chain
+// id it is taken from the signatures of the transactions.
+func NewDumpClient(chainID int64, pattern string) (DumpClient, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return DumpClient{}, fmt.Errorf("invalid dump pattern %v: %v", pattern, err)
+	}
+
+	if len(paths) == 0 {
+		return DumpClient{}, fmt.Errorf("no dumps match %v", pattern)
+	}
+
+	client := DumpClient{
+		chainID:      chainID,
+		blocks:       make(map[int64]Block),
+		byHash:       make(map[string]int64),
+		transactions: make(map[string]int64),
+		receipts:     make(map[string]Receipt),
+		contracts:    make(map[int64]map[string]bool),
+	}
+
+	for _, path := range paths {
+		if err := client.load(path); err != nil {
+			return DumpClient{}, err
+		}
+	}
+
+	sort.Slice(client.numbers, func(i, j int) bool { return client.numbers[i] < client.numbers[j] })
+
+	if client.chainID == 0 {
+		if client.chainID = client.signedChainID(); client.chainID == 0 {
+			return DumpClient{}, fmt.Errorf("the chain of %v is unknown, it needs a chain id", pattern)
+		}
+	}
+
+	return client, nil
+}
+
+// Matches whether the log was emitted by one of the addresses and has the topics, every position of the topics lists
+// the alternatives and an empty position matches anything
+func (f LogFilter) Matches(l Log) bool {
+	if len(f.Address) > 0 {
+		found := false
+		for _, address := range f.Address {
+			found = found || strings.EqualFold(address, l.Address)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for i, alternatives := range f.Topics {
+		if len(alternatives) == 0 {
+			continue
+		}
+
+		if i >= len(l.Topics) {
+			return false
+		}
+
+		found := false
+		for _, topic := range alternatives {
+			found = found || strings.EqualFold(topic, l.Topics[i])
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// WriteDump writes the blocks from one number to another inclusive as a dump, together with the receipts of their
+// transactions and which of their recipients hold code
+func WriteDump(ctx context.Context, client ethereumClient, w io.Writer, from int64, to int64) error {
+	encoder := json.NewEncoder(w)
+	for number := from; number <= to; number++ {
+		block, err := client.GetBlockByNumber(ctx, number)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve block %d: %w", number, err)
+		}
+
+		if block.Hash == "" {
+			return fmt.Errorf("block %d is not available", number)
+		}
+
+		dumped := DumpBlock{Block: block}
+		checked := make(map[string]bool)
+		for _, transaction := range block.Transactions {
+			receipt, err := client.GetTransactionReceipt(ctx, transaction.Hash)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve the receipt of %v: %w", transaction.Hash, err)
+			}
+			dumped.Receipts = append(dumped.Receipts, receipt)
+
+			to := strings.ToLower(transaction.To)
+			if to == "" || checked[to] {
+				continue
+			}
+			checked[to] = true
+
+			code, err := client.GetCode(ctx, to, number)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve the code of %v: %w", to, err)
+			}
+
+			if code != "" && code != "0x" {
+				dumped.Contracts = append(dumped.Contracts, to)
+			}
+		}
+
+		if err := encoder.Encode(dumped); err != nil {
+			return fmt.Errorf("failed to write block %d: %v", number, err)
+		}
+	}
+
+	return nil
+}
+
+// dumpedCode stands in for the code of contracts, dumps do not keep it
+const dumpedCode = "0xfe"
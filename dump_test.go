@@ -0,0 +1,142 @@
+package ethereum_parser_test
+
+import (
+	"context"
+	"encoding/json"
+	eth "ethereum_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDumpClient(t *testing.T) {
+	padded := func(address string) string {
+		return "0x" + strings.Repeat("0", 24) + strings.TrimPrefix(address, "0x")
+	}
+
+	// An EIP-155 mainnet transaction, v 0x25, pays the subscriber, which then calls a contract and sends USDT
+	blocks := map[string]eth.Block{
+		"0x64": {Number: "0x64", Hash: "0x" + strings.Repeat("a", 64), Transactions: []eth.Transaction{
+			{Hash: "0x" + strings.Repeat("1", 64), BlockNumber: "0x64", From: counterparty, To: address, Value: "0xde0b6b3a7640000", Input: "0x", V: "0x25"},
+		}},
+		"0x65": {Number: "0x65", Hash: "0x" + strings.Repeat("b", 64), Transactions: []eth.Transaction{
+			{Hash: "0x" + strings.Repeat("2", 64), BlockNumber: "0x65", From: address, To: counterparty, Value: "0x1", Input: "0x", V: "0x26"},
+			{Hash: "0x" + strings.Repeat("3", 64), BlockNumber: "0x65", From: address, To: token, Value: "0x0", Input: "0x", V: "0x25"},
+		}},
+	}
+	receipts := map[string]eth.Receipt{
+		"0x" + strings.Repeat("1", 64): {TransactionHash: "0x" + strings.Repeat("1", 64), Status: "0x1"},
+		"0x" + strings.Repeat("2", 64): {TransactionHash: "0x" + strings.Repeat("2", 64), Status: "0x1"},
+		"0x" + strings.Repeat("3", 64): {TransactionHash: "0x" + strings.Repeat("3", 64), Status: "0x1", Logs: []eth.Log{{
+			Address:         token,
+			Topics:          []string{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef", padded(address), padded(counterparty)},
+			Data:            "0x" + strings.Repeat("0", 56) + "02625a00",
+			BlockNumber:     "0x65",
+			TransactionHash: "0x" + strings.Repeat("3", 64),
+		}}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		var param string
+		require.NoError(t, json.Unmarshal(request.Params[0], &param))
+
+		var result interface{}
+		switch request.Method {
+		case "eth_getBlockByNumber":
+			result = blocks[param]
+		case "eth_getTransactionReceipt":
+			result = receipts[param]
+		case "eth_getCode":
+			result = "0x"
+			if param == counterparty || param == token {
+				result = "0x6080"
+			}
+		default:
+			t.Fatalf("unexpected call to %v", request.Method)
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result})
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	node := eth.NewEthereumClient(eth.EthereumClientConfig{Addr: server.URL, JsonRPC: "2.0"})
+
+	// Dumping closes the node for good, everything below runs from the file
+	path := filepath.Join(t.TempDir(), "mainnet-100.jsonl")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, eth.WriteDump(ctx, node, file, 0x64, 0x65))
+	require.NoError(t, file.Close())
+	server.Close()
+
+	client, err := eth.NewDumpClient(0, filepath.Join(filepath.Dir(path), "*.jsonl"))
+	require.NoError(t, err)
+
+	chainID, err := client.ChainID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), chainID, "inferred from v")
+	assert.Equal(t, int64(0x64), client.FirstBlock())
+
+	head, err := client.GetCurrentBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x65), head)
+
+	logs, err := client.GetLogs(ctx, eth.LogFilter{FromBlock: "earliest", Topics: [][]string{{}, {padded(address)}}})
+	require.NoError(t, err)
+	assert.Len(t, logs, 1)
+
+	_, err = client.GetBalance(ctx, address, 0x65)
+	assert.ErrorIs(t, err, eth.ErrNotInDump)
+
+	storage := eth.NewMemStorage()
+	require.NoError(t, storage.Subscribe(ctx, eth.Subscription{Address: address}))
+
+	deadLetters := eth.NewMemDeadLetterStorage()
+	sink := &recordingSink{}
+	digester := eth.NewDigester(eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, sink))
+
+	parser, err := eth.NewParserService(eth.ChainConfig{
+		Name:         "mainnet",
+		ChainID:      chainID,
+		PollInterval: eth.Duration(time.Second),
+		PollMode:     "number",
+		StartBlock:   client.FirstBlock(),
+	}, &storage, client, eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, sink), &digester, nil, nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, parser.Sync(ctx))
+
+	cursor, err := storage.GetCurrentBlock(ctx, chainID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0x65), cursor)
+
+	kinds := map[string]eth.TransactionKind{
+		"0x" + strings.Repeat("1", 64): eth.TransactionKindTransfer,
+		"0x" + strings.Repeat("2", 64): eth.TransactionKindContractCall,
+		"0x" + strings.Repeat("3", 64): eth.TransactionKindTokenTransfer,
+	}
+	for hash, kind := range kinds {
+		transaction, err := storage.GetTransactionByHash(ctx, chainID, hash)
+		require.NoError(t, err)
+		assert.Equal(t, "0x1", transaction.Status, hash)
+		assert.Equal(t, kind, transaction.Kind, hash)
+	}
+
+	transaction, err := storage.GetTransactionByHash(ctx, chainID, "0x"+strings.Repeat("3", 64))
+	require.NoError(t, err)
+	require.Len(t, transaction.TokenTransfers, 1)
+	assert.Equal(t, "0x2625a00", transaction.TokenTransfers[0].Value)
+	assert.Len(t, sink.events, 3)
+}
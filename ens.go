@@ -0,0 +1,275 @@
+package ethereum_parser
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNameNotFound = errors.New("ens name not found")
+
+type ENSConfig struct {
+	Enabled bool `env:"ENS_ENABLED" envDefault:"false"`
+	// ChainID chain the registry lives on, names are resolved through its node
+	ChainID  int64  `env:"ENS_CHAIN_ID" envDefault:"1"`
+	Registry string `env:"ENS_REGISTRY" envDefault:"0x00000000000c2e074ec69a0dfb2997ba6c7d2e1e"`
+	// RefreshInterval how often the names of subscriptions are resolved again to follow their owners
+	RefreshInterval time.Duration `env:"ENS_REFRESH_INTERVAL" envDefault:"1h"`
+	// CacheTTL how long reverse resolved names are kept
+	CacheTTL time.Duration `env:"ENS_CACHE_TTL" envDefault:"1h"`
+}
+
+// ENSResolver resolves names to addresses and back through the ENS registry with eth_call
+type ENSResolver struct {
+	mux sync.Mutex
+
+	client ethereumClient
+	config ENSConfig
+	// names reverse resolved names by address, empty when the address has none
+	names map[string]cachedName
+}
+
+type cachedName struct {
+	name    string
+	expires time.Time
+}
+
+// Resolve returns the address a name points to, ErrNameNotFound when there is none
+func (r *ENSResolver) Resolve(ctx context.Context, name string) (string, error) {
+	node := Namehash(name)
+
+	resolver, err := r.resolver(ctx, node)
+	if err != nil {
+		return "", err
+	}
+
+	if resolver == "" {
+		return "", fmt.Errorf("%w: %v", ErrNameNotFound, name)
+	}
+
+	data, err := r.call(ctx, resolver, "addr(bytes32)", node)
+	if err != nil {
+		return "", err
+	}
+
+	address := wordToAddress(data)
+	if address == "" {
+		return "", fmt.Errorf("%w: %v", ErrNameNotFound, name)
+	}
+
+	return address, nil
+}
+
+// Reverse returns the primary name of an address, empty when there is none or it does not resolve back to the address
+func (r *ENSResolver) Reverse(ctx context.Context, address string) (string, error) {
+	address = strings.ToLower(address)
+
+	r.mux.Lock()
+	cached, ok := r.names[address]
+	r.mux.Unlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.name, nil
+	}
+
+	name, err := r.reverse(ctx, address)
+	if err != nil {
+		return "", err
+	}
+
+	r.mux.Lock()
+	r.names[address] = cachedName{name: name, expires: time.Now().Add(r.config.CacheTTL)}
+	r.mux.Unlock()
+
+	return name, nil
+}
+
+func (r *ENSResolver) reverse(ctx context.Context, address string) (string, error) {
+	node := Namehash(strings.TrimPrefix(address, "0x") + ".addr.reverse")
+
+	resolver, err := r.resolver(ctx, node)
+	if err != nil || resolver == "" {
+		return "", err
+	}
+
+	data, err := r.call(ctx, resolver, "name(bytes32)", node)
+	if err != nil || len(data) == 0 {
+		return "", err
+	}
+
+	values, err := decodeABITuple([]abiType{{kind: abiString, canonical: "string"}}, data)
+	if err != nil {
+		return "", nil
+	}
+
+	name := values[0].(string)
+	if name == "" {
+		return "", nil
+	}
+
+	// Anyone can claim any name in their reverse record, it only counts when the name points back
+	forward, err := r.Resolve(ctx, name)
+	if errors.Is(err, ErrNameNotFound) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if forward != address {
+		return "", nil
+	}
+
+	return name, nil
+}
+
+// resolver the resolver contract of the node, empty when it has none
+func (r *ENSResolver) resolver(ctx context.Context, node []byte) (string, error) {
+	data, err := r.call(ctx, r.config.Registry, "resolver(bytes32)", node)
+	if err != nil {
+		return "", err
+	}
+
+	return wordToAddress(data), nil
+}
+
+// call reverting calls come back empty, resolvers do not have to implement every function
+func (r *ENSResolver) call(ctx context.Context, to string, signature string, node []byte) ([]byte, error) {
+	input, err := encodeABICall(signature, node)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := r.client.Call(ctx, CallMsg{To: to, Data: "0x" + hex.EncodeToString(input)}, 0)
+	if isReverted(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %v on %v: %w", signature, to, err)
+	}
+
+	return hex.DecodeString(strings.TrimPrefix(result, "0x"))
+}
+
+// Refresh resolves the names of subscriptions every RefreshInterval, moving a subscription over when its name points
+// somewhere else. The bus is optional, it is told about the moves.
+func (r *ENSResolver) Refresh(ctx context.Context, storage Repository, bus *EventBus, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(r.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.refresh(ctx, storage, bus); err != nil {
+				log.Printf("There was an issue trying to refresh the ens names: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *ENSResolver) refresh(ctx context.Context, storage Repository, bus *EventBus) error {
+	subs, err := storage.GetSubscribers(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		if sub.Name == "" {
+			continue
+		}
+
+		address, err := r.Resolve(ctx, sub.Name)
+		if errors.Is(err, ErrNameNotFound) {
+			// Keeping the subscription, the name might be in the middle of changing hands
+			log.Printf("%v no longer resolves, keeping %v subscribed", sub.Name, sub.Address)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if address == sub.Address {
+			continue
+		}
+
+		log.Printf("%v moved from %v to %v, moving the subscription", sub.Name, sub.Address, address)
+		previous := sub.Address
+		sub.Address = address
+		moved, err := storage.MoveSubscription(ctx, previous, sub)
+		if err != nil {
+			return err
+		}
+
+		if !moved {
+			// Unsubscribed, or subscribed without the name, since the subscribers were retrieved
+			log.Printf("%v is no longer subscribed through %v, leaving it be", previous, sub.Name)
+			continue
+		}
+
+		if bus != nil {
+			bus.Publish(BusEvent{Topic: TopicUnsubscribed, Address: previous})
+			bus.Publish(BusEvent{Topic: TopicSubscribed, Address: address})
+		}
+	}
+
+	return nil
+}
+
+// Namehash the ENS node of a name, labels are hashed from the top level domain down. Names are only lowercased, full
+// UTS-46 normalisation is left to the caller.
+func Namehash(name string) []byte {
+	node := make([]byte, 32)
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return node
+	}
+
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = keccak256(node, keccak256([]byte(labels[i])))
+	}
+
+	return node
+}
+
+// isENSName anything with a dot that is not an address is worth a lookup
+func isENSName(name string) bool {
+	return strings.Contains(name, ".") && !strings.HasPrefix(name, ".") && !strings.HasSuffix(name, ".")
+}
+
+// wordToAddress the address held by an ABI word, empty for the zero address or anything too short
+func wordToAddress(data []byte) string {
+	if len(data) < abiWord {
+		return ""
+	}
+
+	address := "0x" + hex.EncodeToString(data[12:abiWord])
+	if address == zeroAddress {
+		return ""
+	}
+
+	return address
+}
+
+func NewENSResolver(config ENSConfig, client ethereumClient) ENSResolver {
+	return ENSResolver{
+		client: client,
+		config: config,
+		names:  make(map[string]cachedName),
+	}
+}
+
+const zeroAddress = "0x0000000000000000000000000000000000000000"
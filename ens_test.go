@@ -0,0 +1,132 @@
+package ethereum_parser_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	eth "ethereum_parser"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	ensRegistry = "0x00000000000c2e074ec69a0dfb2997ba6c7d2e1e"
+	ensResolver = "0x231b0ee14048e9dccd1d247744d114a4eb5e8e63"
+)
+
+func TestNamehash(t *testing.T) {
+	assert.Equal(t, strings.Repeat("0", 64), hex.EncodeToString(eth.Namehash("")))
+	assert.Equal(t, "93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae", hex.EncodeToString(eth.Namehash("eth")))
+	assert.Equal(t, "de9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f", hex.EncodeToString(eth.Namehash("Foo.eth")))
+}
+
+func TestENSResolver(t *testing.T) {
+	node := func(name string) string { return hex.EncodeToString(eth.Namehash(name)) }
+	word := func(address string) string { return fmt.Sprintf("0x%064s", strings.TrimPrefix(address, "0x")) }
+
+	var mux sync.Mutex
+	var limited bool
+	responses := map[string]string{
+		ensRegistry + "0178b8bf" + node("alice.eth"):                      word(ensResolver),
+		ensResolver + "3b3b57de" + node("alice.eth"):                      word(address),
+		ensRegistry + "0178b8bf" + node(address[2:]+".addr.reverse"):      word(ensResolver),
+		ensResolver + "691f3431" + node(address[2:]+".addr.reverse"):      "0x" + abiString("alice.eth"),
+		ensRegistry + "0178b8bf" + node(counterparty[2:]+".addr.reverse"): word(ensResolver),
+		ensResolver + "691f3431" + node(counterparty[2:]+".addr.reverse"): "0x" + abiString("alice.eth"),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		var msg eth.CallMsg
+		require.NoError(t, json.Unmarshal(request.Params[0], &msg))
+
+		mux.Lock()
+		result, ok := responses[msg.To+strings.TrimPrefix(msg.Data, "0x")]
+		throttled := limited
+		mux.Unlock()
+		if throttled {
+			_, _ = w.Write([]byte(`{"jsonrpc": "2.0", "id": 1, "error": {"code": -32005, "message": "daily request count exceeded"}}`))
+			return
+		}
+		if !ok {
+			_, _ = w.Write([]byte(`{"jsonrpc": "2.0", "id": 1, "error": {"code": 3, "message": "execution reverted"}}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"jsonrpc": "2.0", "id": 1, "result": "%v"}`, result)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := eth.NewEthereumClient(eth.EthereumClientConfig{Addr: server.URL, JsonRPC: "2.0"})
+	resolver := eth.NewENSResolver(eth.ENSConfig{Registry: ensRegistry, RefreshInterval: 10 * time.Millisecond, CacheTTL: time.Hour}, client)
+
+	t.Run("forward", func(t *testing.T) {
+		resolved, err := resolver.Resolve(ctx, "alice.eth")
+		require.NoError(t, err)
+		assert.Equal(t, address, resolved)
+
+		_, err = resolver.Resolve(ctx, "nobody.eth")
+		assert.ErrorIs(t, err, eth.ErrNameNotFound)
+	})
+
+	t.Run("node errors are not missing names", func(t *testing.T) {
+		mux.Lock()
+		limited = true
+		mux.Unlock()
+		defer func() {
+			mux.Lock()
+			limited = false
+			mux.Unlock()
+		}()
+
+		_, err := resolver.Resolve(ctx, "alice.eth")
+		var rpcErr *eth.RPCError
+		require.ErrorAs(t, err, &rpcErr)
+		assert.NotErrorIs(t, err, eth.ErrNameNotFound)
+		assert.Equal(t, -32005, rpcErr.Code)
+	})
+
+	t.Run("reverse", func(t *testing.T) {
+		name, err := resolver.Reverse(ctx, address)
+		require.NoError(t, err)
+		assert.Equal(t, "alice.eth", name)
+
+		// Claims alice.eth in its reverse record, but the name does not point back to it
+		name, err = resolver.Reverse(ctx, counterparty)
+		require.NoError(t, err)
+		assert.Empty(t, name)
+	})
+
+	t.Run("refresh follows the name", func(t *testing.T) {
+		storage := eth.NewMemStorage()
+		require.NoError(t, storage.Subscribe(ctx, eth.Subscription{Address: address, Name: "alice.eth"}))
+
+		mux.Lock()
+		responses[ensResolver+"3b3b57de"+node("alice.eth")] = word(counterparty)
+		mux.Unlock()
+
+		refreshCtx, cancel := context.WithCancel(ctx)
+		wg := new(sync.WaitGroup)
+		wg.Add(1)
+		go resolver.Refresh(refreshCtx, &storage, nil, wg)
+
+		assert.Eventually(t, func() bool {
+			subs, err := storage.GetSubscribers(ctx)
+			return err == nil && len(subs) == 1 && subs[0].Address == counterparty && subs[0].Name == "alice.eth"
+		}, time.Second, 10*time.Millisecond)
+
+		cancel()
+		wg.Wait()
+	})
+}
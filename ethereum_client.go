@@ -21,6 +21,8 @@ type EthereumClient struct {
 type EthereumClientConfig struct {
 	Addr    string `env:"ETHEREUM_CLIENT_URL" envDefault:"https://cloudflare-eth.com"`
 	JsonRPC string `env:"JSON_RPC" envDefault:"2.0"`
+	// Transport sends the requests to the node, http.DefaultTransport when nil. A Recorder records or replays them.
+	Transport http.RoundTripper
 }
 
 func (c EthereumClient) call(ctx context.Context, method string, params []interface{}, v interface{}) error {
@@ -54,16 +56,20 @@ func (c EthereumClient) call(ctx context.Context, method string, params []interf
 		var respBody responseBody
 		// unmarshalling response and result from ethereum api
 		if err = json.Unmarshal(bodyBytes, &respBody); err != nil {
-			return fmt.Errorf("failed to unmarshal the response body: %v", err)
+			return &MalformedResponseError{Err: err}
+		}
+
+		if respBody.Error != nil {
+			return respBody.Error
 		}
 
 		if err = json.Unmarshal([]byte(respBody.Result), &v); err != nil {
-			return fmt.Errorf("failed to unmarshal the response body: %v", err)
+			return &MalformedResponseError{Err: err}
 		}
 
 		return nil
 	default:
-		return fmt.Errorf("there was an error with the request")
+		return &HTTPError{StatusCode: response.StatusCode, Status: response.Status}
 	}
 }
 
@@ -89,9 +95,153 @@ func (c EthereumClient) GetBlockByNumber(ctx context.Context, number int64) (Blo
 	return result, nil
 }
 
+func (c EthereumClient) GetTransactionReceipt(ctx context.Context, hash string) (Receipt, error) {
+	var result Receipt
+	err := c.call(ctx, getReceipt, []interface{}{hash}, &result)
+	if err != nil {
+		return Receipt{}, err
+	}
+	return result, nil
+}
+
+func (c EthereumClient) GetLogs(ctx context.Context, filter LogFilter) ([]Log, error) {
+	var result []Log
+	err := c.call(ctx, getLogs, []interface{}{filter}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetTransactionByHash returns an empty transaction when the node does not know the hash (anymore)
+func (c EthereumClient) GetTransactionByHash(ctx context.Context, hash string) (Transaction, error) {
+	var result Transaction
+	err := c.call(ctx, getTransaction, []interface{}{hash}, &result)
+	if err != nil {
+		return Transaction{}, err
+	}
+	return result, nil
+}
+
+func (c EthereumClient) NewPendingTransactionFilter(ctx context.Context) (string, error) {
+	var filterID string
+	err := c.call(ctx, newPendingTransactionFilter, []interface{}{}, &filterID)
+	if err != nil {
+		return "", err
+	}
+	return filterID, nil
+}
+
+// GetFilterChanges returns the hashes collected by a block or pending transaction filter since the last poll
+func (c EthereumClient) GetFilterChanges(ctx context.Context, filterID string) ([]string, error) {
+	var hashes []string
+	err := c.call(ctx, getFilterChanges, []interface{}{filterID}, &hashes)
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+func (c EthereumClient) UninstallFilter(ctx context.Context, filterID string) (bool, error) {
+	var uninstalled bool
+	err := c.call(ctx, uninstallFilter, []interface{}{filterID}, &uninstalled)
+	if err != nil {
+		return false, err
+	}
+	return uninstalled, nil
+}
+
+func (c EthereumClient) NewBlockFilter(ctx context.Context) (string, error) {
+	var filterID string
+	err := c.call(ctx, newBlockFilter, []interface{}{}, &filterID)
+	if err != nil {
+		return "", err
+	}
+	return filterID, nil
+}
+
+// GetBlockByHash returns an empty block when the node does not know the hash
+func (c EthereumClient) GetBlockByHash(ctx context.Context, hash string) (Block, error) {
+	var result Block
+	err := c.call(ctx, getBlockByHash, []interface{}{hash, true}, &result)
+	if err != nil {
+		return Block{}, err
+	}
+	return result, nil
+}
+
+func (c EthereumClient) ChainID(ctx context.Context) (int64, error) {
+	var result string
+	err := c.call(ctx, chainID, []interface{}{}, &result)
+	if err != nil {
+		return 0, err
+	}
+	return hexDecoder(result)
+}
+
+// GetCode returns the code held by the address at the given block, 0x for accounts
+func (c EthereumClient) GetCode(ctx context.Context, address string, number int64) (string, error) {
+	var result string
+	err := c.call(ctx, getCode, []interface{}{address, hexEndcoder(number)}, &result)
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// GetBalance returns the wei held by the address at the given block
+func (c EthereumClient) GetBalance(ctx context.Context, address string, number int64) (string, error) {
+	var result string
+	err := c.call(ctx, getBalance, []interface{}{address, hexEndcoder(number)}, &result)
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// Call executes a read-only call against the state at the given block, zero meaning the latest block
+func (c EthereumClient) Call(ctx context.Context, msg CallMsg, number int64) (string, error) {
+	block := "latest"
+	if number > 0 {
+		block = hexEndcoder(number)
+	}
+
+	var result string
+	err := c.call(ctx, ethCall, []interface{}{msg, block}, &result)
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// TraceBlockByNumber returns the call tree of every transaction in the block using the geth callTracer
+func (c EthereumClient) TraceBlockByNumber(ctx context.Context, number int64) ([]TransactionTrace, error) {
+	var result []TransactionTrace
+	err := c.call(ctx, traceBlockByNumber, []interface{}{hexEndcoder(number), map[string]string{"tracer": "callTracer"}}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TraceBlock returns the flattened call traces of the block from the parity trace module
+func (c EthereumClient) TraceBlock(ctx context.Context, number int64) ([]ParityTrace, error) {
+	var result []ParityTrace
+	err := c.call(ctx, traceBlock, []interface{}{hexEndcoder(number)}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func NewEthereumClient(config EthereumClientConfig) EthereumClient {
+	client := http.DefaultClient
+	if config.Transport != nil {
+		client = &http.Client{Transport: config.Transport}
+	}
+
 	return EthereumClient{
-		client:  http.DefaultClient,
+		client:  client,
 		rootUrl: config.Addr,
 		jsonRPC: config.JsonRPC,
 	}
@@ -111,10 +261,57 @@ func hexEndcoder(decValue int64) string {
 	return fmt.Sprintf("0x%X", decValue)
 }
 
+// quantity encodes a number the way the node does, lowercase without leading zeros
+func quantity(value int64) string {
+	return fmt.Sprintf("0x%x", value)
+}
+
 type ethereumClient interface {
 	// GetCurrentBlock retrieves the number of the most recent block
 	GetCurrentBlock(ctx context.Context) (int64, error)
 
 	// GetBlockByNumber returns information about a block by block number.
 	GetBlockByNumber(ctx context.Context, number int64) (Block, error)
+
+	// GetTransactionReceipt returns the receipt of a mined transaction
+	GetTransactionReceipt(ctx context.Context, hash string) (Receipt, error)
+
+	// GetLogs returns the logs matching the filter
+	GetLogs(ctx context.Context, filter LogFilter) ([]Log, error)
+
+	// GetTransactionByHash returns a pending or mined transaction, empty when the node does not know it
+	GetTransactionByHash(ctx context.Context, hash string) (Transaction, error)
+
+	// NewPendingTransactionFilter creates a filter collecting the hashes of transactions entering the mempool
+	NewPendingTransactionFilter(ctx context.Context) (string, error)
+
+	// GetFilterChanges polls a filter for the hashes collected since the last poll
+	GetFilterChanges(ctx context.Context, filterID string) ([]string, error)
+
+	// UninstallFilter removes a filter from the node
+	UninstallFilter(ctx context.Context, filterID string) (bool, error)
+
+	// NewBlockFilter creates a filter collecting the hashes of new blocks
+	NewBlockFilter(ctx context.Context) (string, error)
+
+	// GetBlockByHash returns information about a block by block hash
+	GetBlockByHash(ctx context.Context, hash string) (Block, error)
+
+	// ChainID returns the chain id of the network served by the node
+	ChainID(ctx context.Context) (int64, error)
+
+	// GetCode returns the code held by an address at a block, 0x for accounts without code
+	GetCode(ctx context.Context, address string, number int64) (string, error)
+
+	// GetBalance returns the wei held by an address at a block
+	GetBalance(ctx context.Context, address string, number int64) (string, error)
+
+	// Call executes a read-only call against the state at a block, zero meaning the latest block
+	Call(ctx context.Context, msg CallMsg, number int64) (string, error)
+
+	// TraceBlockByNumber returns the call tree of every transaction in the block (debug namespace)
+	TraceBlockByNumber(ctx context.Context, number int64) ([]TransactionTrace, error)
+
+	// TraceBlock returns the flattened call traces of the block (trace namespace)
+	TraceBlock(ctx context.Context, number int64) ([]ParityTrace, error)
 }
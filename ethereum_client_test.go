@@ -3,29 +3,53 @@ package ethereum_parser_test
 import (
 	"context"
 	eth "ethereum_parser"
+	"ethereum_parser/chaintest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 // Implementing table-testing as well as simple test case to showcase different types ( test suit on api_test.go)
 func TestEthereumClient_GetCurrentBlock(t *testing.T) {
-	client := eth.NewEthereumClient(eth.EthereumClientConfig{Addr: addr, JsonRPC: ver})
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+	chain.Mine()
+	chain.Mine()
+
+	client := eth.NewEthereumClient(eth.EthereumClientConfig{Addr: chain.URL(), JsonRPC: ver})
 
 	block, err := client.GetCurrentBlock(context.Background())
 	assert.NoError(t, err)
-	assert.Greater(t, block, int64(0))
+	assert.Equal(t, int64(2), block)
 }
 
 func TestEthereumClient_GetBlockByNumber(t *testing.T) {
-	client := eth.NewEthereumClient(eth.EthereumClientConfig{Addr: addr, JsonRPC: ver})
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+	first := chain.Mine(eth.Transaction{From: counterparty, To: address, Value: "0x1"})
+	second := chain.Mine()
+
+	client := eth.NewEthereumClient(eth.EthereumClientConfig{Addr: chain.URL(), JsonRPC: ver})
 
 	tt := []struct {
 		block        int64
 		expectedHash string
 	}{
 		{
-			block:        17085880,
-			expectedHash: "0x08f2a2cd8370df0e926d3fdb92f4ebf61bf1c849f5b5967155eb82657b31b539",
+			block:        1,
+			expectedHash: first.Hash,
+		},
+		{
+			block:        2,
+			expectedHash: second.Hash,
+		},
+		{
+			// Unknown blocks come back empty rather than as an error
+			block:        3,
+			expectedHash: "",
 		},
 	}
 
@@ -34,7 +58,54 @@ func TestEthereumClient_GetBlockByNumber(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, testCase.expectedHash, receivedBlock.Hash)
 	}
+
+	receivedBlock, err := client.GetBlockByNumber(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, receivedBlock.Transactions, 1)
+	assert.Equal(t, first.Transactions[0].Hash, receivedBlock.Transactions[0].Hash)
+
+	receipt, err := client.GetTransactionReceipt(context.Background(), first.Transactions[0].Hash)
+	require.NoError(t, err)
+	assert.Equal(t, "0x1", receipt.Status)
+}
+
+func TestEthereumClient_Errors(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+
+	client := eth.NewEthereumClient(eth.EthereumClientConfig{Addr: chain.URL(), JsonRPC: ver})
+	ctx := context.Background()
+
+	chain.Fail("eth_blockNumber", 1, eth.RPCError{Code: -32000, Message: "header not found"})
+	_, err := client.GetCurrentBlock(ctx)
+	var rpcErr *eth.RPCError
+	require.ErrorAs(t, err, &rpcErr)
+	assert.Equal(t, -32000, rpcErr.Code)
+
+	chain.Throttle(1)
+	_, err = client.GetCurrentBlock(ctx)
+	assert.ErrorContains(t, err, "429")
+
+	// Both were one offs
+	_, err = client.GetCurrentBlock(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, chain.Requests("eth_blockNumber"))
+
+	chain.SetLatency(time.Second)
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = client.GetCurrentBlock(timeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// A gateway answering 200 with an error page
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html><body>502 Bad Gateway</body></html>"))
+	}))
+	defer gateway.Close()
+
+	_, err = eth.NewEthereumClient(eth.EthereumClientConfig{Addr: gateway.URL, JsonRPC: ver}).GetCurrentBlock(ctx)
+	var malformedErr *eth.MalformedResponseError
+	assert.ErrorAs(t, err, &malformedErr)
 }
 
-const addr = "https://cloudflare-eth.com"
 const ver = "2.0"
@@ -1,6 +1,12 @@
 package ethereum_parser
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 type requestBody struct {
 	JsonRPC        string        `json:"jsonrpc"`
@@ -13,6 +19,54 @@ type responseBody struct {
 	ID      int             `json:"ID"`
 	JsonRPC string          `json:"jsonrpc"`
 	Result  json.RawMessage `json:"result"`
+	Error   *RPCError       `json:"error"`
+}
+
+// RPCError error object returned by the node instead of a result
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %v", e.Code, e.Message)
+}
+
+// HTTPError the node answered with something else than a 200, rate limiting and overloaded gateways mostly
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("there was an error with the request: %v", e.Status)
+}
+
+// MalformedResponseError the node answered 200 with a body that is no json-rpc response, gateways in front of it serving
+// an html error page or cutting the body short mostly
+type MalformedResponseError struct {
+	Err error
+}
+
+func (e *MalformedResponseError) Error() string {
+	return fmt.Sprintf("failed to unmarshal the response body: %v", e.Err)
+}
+
+func (e *MalformedResponseError) Unwrap() error {
+	return e.Err
+}
+
+// isFilterNotFound nodes forget filters that have not been polled for a while, or after a restart
+func isFilterNotFound(err error) bool {
+	var rpcErr *RPCError
+	return errors.As(err, &rpcErr) && strings.Contains(strings.ToLower(rpcErr.Message), "filter not found")
+}
+
+// isReverted the call reverted, the contract refused it or does not implement the function. Anything else the node
+// answers with is about the node rather than the contract.
+func isReverted(err error) bool {
+	var rpcErr *RPCError
+	return errors.As(err, &rpcErr) && (rpcErr.Code == 3 || strings.Contains(strings.ToLower(rpcErr.Message), "execution reverted"))
 }
 
 type Transaction struct {
@@ -21,17 +75,294 @@ type Transaction struct {
 	From        string `json:"from"`
 	To          string `json:"to"`
 	Value       string `json:"value"`
+	Nonce       string `json:"nonce"`
+	Input       string `json:"input"`
+	// ChainID of the network the transaction was parsed from
+	ChainID string `json:"chainId,omitempty"`
+
+	// Type and the fee, access list and signature fields below are what the transaction hash is computed over, only
+	// needed to verify blocks
+	Type                 string          `json:"type,omitempty"`
+	Gas                  string          `json:"gas,omitempty"`
+	GasPrice             string          `json:"gasPrice,omitempty"`
+	MaxFeePerGas         string          `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string          `json:"maxPriorityFeePerGas,omitempty"`
+	MaxFeePerBlobGas     string          `json:"maxFeePerBlobGas,omitempty"`
+	AccessList           []AccessTuple   `json:"accessList,omitempty"`
+	BlobVersionedHashes  []string        `json:"blobVersionedHashes,omitempty"`
+	AuthorizationList    []Authorization `json:"authorizationList,omitempty"`
+	V                    string          `json:"v,omitempty"`
+	R                    string          `json:"r,omitempty"`
+	S                    string          `json:"s,omitempty"`
+	YParity              string          `json:"yParity,omitempty"`
+
+	// Status taken from the receipt, 0x1 success and 0x0 reverted
+	Status string `json:"status,omitempty"`
+
+	// TokenTransfers ERC-20 transfers emitted while executing the transaction
+	TokenTransfers []TokenTransfer `json:"tokenTransfers,omitempty"`
+
+	// InternalTransfers ETH moved by calls made from inside contracts, only available when tracing is enabled
+	InternalTransfers []InternalTransfer `json:"internalTransfers,omitempty"`
+
+	// Fee paid by the sender, gas used times the effective gas price from the receipt
+	Fee string `json:"fee,omitempty"`
+
+	// Kind classification of the transaction, set once the receipt is known
+	Kind TransactionKind `json:"kind,omitempty"`
+	// ContractAddress of the contract created by a deployment
+	ContractAddress string `json:"contractAddress,omitempty"`
+	// Decoded the function called by the input, only when its ABI is known
+	Decoded *DecodedCall `json:"decoded,omitempty"`
+
+	// Block header of the block the transaction was mined in, attached by the parser
+	Block *BlockHeader `json:"block,omitempty"`
+
+	// SenderCheck the sender recovered from the signature, only when sender verification is enabled
+	SenderCheck *SenderCheck `json:"senderCheck,omitempty"`
+
+	// Names primary ENS names of the addresses taking part, only filled in on API responses
+	Names map[string]string `json:"names,omitempty"`
+}
+
+// Time when the block of the transaction was produced, zero when the header is not attached
+func (t Transaction) Time() time.Time {
+	if t.Block == nil {
+		return time.Time{}
+	}
+
+	return t.Block.Time()
+}
+
+// Failed whether the receipt reported the transaction as reverted
+func (t Transaction) Failed() bool {
+	return t.Status == statusFailed
+}
+
+// Transfers every movement of value in the transaction, the native one first followed by token and internal transfers
+func (t Transaction) Transfers() []Transfer {
+	transfers := []Transfer{{Kind: TransferKindNative, Asset: AssetETH, From: t.From, To: t.To, Value: t.Value}}
+	for _, tokenTransfer := range t.TokenTransfers {
+		transfers = append(transfers, Transfer{
+			Kind:  TransferKindToken,
+			Asset: tokenTransfer.Token,
+			From:  tokenTransfer.From,
+			To:    tokenTransfer.To,
+			Value: tokenTransfer.Value,
+		})
+	}
+
+	for _, internalTransfer := range t.InternalTransfers {
+		transfers = append(transfers, Transfer{
+			Kind:  TransferKindInternal,
+			Asset: AssetETH,
+			From:  internalTransfer.From,
+			To:    internalTransfer.To,
+			Value: internalTransfer.Value,
+		})
+	}
+
+	return transfers
+}
+
+// AccessTuple storage slots of a contract a transaction declares up front, EIP-2930
+type AccessTuple struct {
+	Address     string   `json:"address"`
+	StorageKeys []string `json:"storageKeys"`
+}
+
+// Authorization delegation of an account to contract code signed by the account, EIP-7702
+type Authorization struct {
+	ChainID string `json:"chainId"`
+	Address string `json:"address"`
+	Nonce   string `json:"nonce"`
+	YParity string `json:"yParity"`
+	R       string `json:"r"`
+	S       string `json:"s"`
+}
+
+// Transfer a single movement of an asset between two addresses
+type Transfer struct {
+	Kind  string `json:"kind"`
+	Asset string `json:"asset"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"value"`
+}
+
+type TokenTransfer struct {
+	Token    string `json:"token"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Value    string `json:"value"`
+	LogIndex string `json:"logIndex"`
+
+	// Symbol and Amount, the value scaled by the decimals of the token, are filled in from the token metadata
+	Symbol string `json:"symbol,omitempty"`
+	Amount string `json:"amount,omitempty"`
+}
+
+// CallMsg a read-only call executed by the node against the state of a block
+type CallMsg struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	Data string `json:"data"`
+}
+
+type Receipt struct {
+	TransactionHash   string `json:"transactionHash"`
+	BlockNumber       string `json:"blockNumber"`
+	Status            string `json:"status"`
+	GasUsed           string `json:"gasUsed"`
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+	ContractAddress   string `json:"contractAddress"`
+	Logs              []Log  `json:"logs"`
+}
+
+type Log struct {
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	BlockNumber     string   `json:"blockNumber"`
+	TransactionHash string   `json:"transactionHash"`
+	LogIndex        string   `json:"logIndex"`
+	Removed         bool     `json:"removed"`
+}
+
+// TokenTransfer decodes an ERC-20 Transfer log, ERC-721 transfers share the topic but index the token id so they are skipped
+func (l Log) TokenTransfer() (TokenTransfer, bool) {
+	if len(l.Topics) != 3 || !strings.EqualFold(l.Topics[0], transferEventTopic) {
+		return TokenTransfer{}, false
+	}
+
+	value, err := quantityToBig(l.Data)
+	if err != nil {
+		return TokenTransfer{}, false
+	}
+
+	return TokenTransfer{
+		Token:    strings.ToLower(l.Address),
+		From:     topicToAddress(l.Topics[1]),
+		To:       topicToAddress(l.Topics[2]),
+		Value:    bigToQuantity(value),
+		LogIndex: l.LogIndex,
+	}, true
+}
+
+type LogFilter struct {
+	// BlockHash restricts the filter to a single block, can not be combined with FromBlock and ToBlock
+	BlockHash string     `json:"blockHash,omitempty"`
+	FromBlock string     `json:"fromBlock,omitempty"`
+	ToBlock   string     `json:"toBlock,omitempty"`
+	Address   []string   `json:"address,omitempty"`
+	Topics    [][]string `json:"topics,omitempty"`
+}
+
+// topicToAddress takes the last 20 bytes of an indexed address topic
+func topicToAddress(topic string) string {
+	if len(topic) < 40 {
+		return ""
+	}
+
+	return "0x" + strings.ToLower(topic[len(topic)-40:])
 }
 
 type Block struct {
-	Hash         string        `json:"hash"`
-	Number       string        `json:"number"`
-	Transactions []Transaction `json:"transactions"`
+	Hash      string `json:"hash"`
+	Number    string `json:"number"`
+	Timestamp string `json:"timestamp"`
+	// Miner the fee recipient since the merge
+	Miner string `json:"miner"`
+	// BaseFeePerGas missing before London
+	BaseFeePerGas string        `json:"baseFeePerGas"`
+	GasUsed       string        `json:"gasUsed"`
+	Transactions  []Transaction `json:"transactions"`
+	Withdrawals   []Withdrawal  `json:"withdrawals"`
+
+	// The rest of the header, only needed to verify the block hash
+	ParentHash       string `json:"parentHash"`
+	Sha3Uncles       string `json:"sha3Uncles"`
+	StateRoot        string `json:"stateRoot"`
+	TransactionsRoot string `json:"transactionsRoot"`
+	ReceiptsRoot     string `json:"receiptsRoot"`
+	LogsBloom        string `json:"logsBloom"`
+	Difficulty       string `json:"difficulty"`
+	GasLimit         string `json:"gasLimit"`
+	ExtraData        string `json:"extraData"`
+	MixHash          string `json:"mixHash"`
+	Nonce            string `json:"nonce"`
+	// Fields added by later forks, missing from the blocks before them
+	WithdrawalsRoot       string `json:"withdrawalsRoot"`
+	BlobGasUsed           string `json:"blobGasUsed"`
+	ExcessBlobGas         string `json:"excessBlobGas"`
+	ParentBeaconBlockRoot string `json:"parentBeaconBlockRoot"`
+	RequestsHash          string `json:"requestsHash"`
+}
+
+// Header the parts of the block worth keeping next to every transaction
+func (b Block) Header() BlockHeader {
+	return BlockHeader{
+		Hash:          b.Hash,
+		Number:        b.Number,
+		Timestamp:     b.Timestamp,
+		Miner:         strings.ToLower(b.Miner),
+		BaseFeePerGas: b.BaseFeePerGas,
+		GasUsed:       b.GasUsed,
+	}
+}
+
+// BlockHeader block level information stored with the transactions and withdrawals of the block
+type BlockHeader struct {
+	Hash          string `json:"hash"`
+	Number        string `json:"number"`
+	Timestamp     string `json:"timestamp"`
+	Miner         string `json:"miner"`
+	BaseFeePerGas string `json:"baseFeePerGas,omitempty"`
+	GasUsed       string `json:"gasUsed"`
+}
+
+// Time the timestamp of the block, zero when the node left it out
+func (h BlockHeader) Time() time.Time {
+	if h.Timestamp == "" {
+		return time.Time{}
+	}
+
+	seconds, err := hexDecoder(h.Timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(seconds, 0).UTC()
 }
 
 const (
 	blockNumber       = "eth_blockNumber"
 	getBlocksByNumber = "eth_getBlockByNumber"
+	getReceipt        = "eth_getTransactionReceipt"
+	getLogs           = "eth_getLogs"
+	getTransaction    = "eth_getTransactionByHash"
+
+	newPendingTransactionFilter = "eth_newPendingTransactionFilter"
+	getFilterChanges            = "eth_getFilterChanges"
+	uninstallFilter             = "eth_uninstallFilter"
+	newBlockFilter              = "eth_newBlockFilter"
+	getBlockByHash              = "eth_getBlockByHash"
+	chainID                     = "eth_chainId"
+	getCode                     = "eth_getCode"
+	ethCall                     = "eth_call"
+	getBalance                  = "eth_getBalance"
+	traceBlockByNumber          = "debug_traceBlockByNumber"
+	traceBlock                  = "trace_block"
+
+	// transferEventTopic keccak256 of Transfer(address,address,uint256)
+	transferEventTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+	statusFailed = "0x0"
+
+	TransferKindNative     = "native"
+	TransferKindToken      = "token"
+	TransferKindInternal   = "internal"
+	TransferKindWithdrawal = "withdrawal"
 
 	// ID Not sure about the ID, so I have left it as a const here
 	ID = 1
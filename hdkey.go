@@ -0,0 +1,166 @@
+package ethereum_parser
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidExtendedKey = errors.New("invalid extended public key")
+
+// extendedKey BIP-32 extended public key, only public derivation is supported as the private key never reaches us
+type extendedKey struct {
+	depth     byte
+	chainCode []byte
+	key       curvePoint
+}
+
+// parseExtendedKey decodes a base58check xpub, or tpub for test networks
+func parseExtendedKey(encoded string) (extendedKey, error) {
+	data, err := base58CheckDecode(strings.TrimSpace(encoded))
+	if err != nil {
+		return extendedKey{}, fmt.Errorf("%w: %v", ErrInvalidExtendedKey, err)
+	}
+
+	if len(data) != 78 {
+		return extendedKey{}, fmt.Errorf("%w: expected 78 bytes, got %d", ErrInvalidExtendedKey, len(data))
+	}
+
+	switch version := binary.BigEndian.Uint32(data[:4]); version {
+	case xpubVersion, tpubVersion:
+	case xprvVersion, tprvVersion:
+		return extendedKey{}, fmt.Errorf("%w: that is a private key, only the public one is needed", ErrInvalidExtendedKey)
+	default:
+		return extendedKey{}, fmt.Errorf("%w: unknown version %08x", ErrInvalidExtendedKey, version)
+	}
+
+	key, err := decompressPoint(data[45:])
+	if err != nil {
+		return extendedKey{}, fmt.Errorf("%w: %v", ErrInvalidExtendedKey, err)
+	}
+
+	return extendedKey{depth: data[4], chainCode: data[13:45], key: key}, nil
+}
+
+// child CKDpub, the public key and chain code of a non-hardened child
+func (k extendedKey) child(index uint32) (extendedKey, error) {
+	if index >= hardenedOffset {
+		return extendedKey{}, fmt.Errorf("%w: hardened child %d cannot be derived from a public key", ErrInvalidExtendedKey, index-hardenedOffset)
+	}
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(k.key.compressed())
+	_ = binary.Write(mac, binary.BigEndian, index)
+	sum := mac.Sum(nil)
+
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(secp256k1N) >= 0 {
+		// Astronomically unlikely, BIP-32 leaves such an index unused. Refused rather than skipped, so the address at an
+		// index is always the one wallets derive for it.
+		return extendedKey{}, fmt.Errorf("%w: child %d is invalid", ErrInvalidExtendedKey, index)
+	}
+
+	key := secp256k1G.multiply(tweak).add(k.key)
+	if key.infinity() {
+		return extendedKey{}, fmt.Errorf("%w: child %d is invalid", ErrInvalidExtendedKey, index)
+	}
+
+	return extendedKey{depth: k.depth + 1, chainCode: sum[32:], key: key}, nil
+}
+
+func (k extendedKey) derive(path []uint32) (extendedKey, error) {
+	var err error
+	for _, index := range path {
+		if k, err = k.child(index); err != nil {
+			return extendedKey{}, err
+		}
+	}
+
+	return k, nil
+}
+
+// address the Ethereum address of the key
+func (k extendedKey) address() string {
+	return pubkeyToAddress(k.key)
+}
+
+// parseDerivationPath path below the extended key such as 0 or 0/5, an optional m/ prefix is ignored. Hardened steps
+// need the private key so they belong in the path the xpub was exported at.
+func parseDerivationPath(path string) ([]uint32, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(path), "m"), "/")
+	if path == "" {
+		return nil, nil
+	}
+
+	var indexes []uint32
+	for _, step := range strings.Split(path, "/") {
+		if strings.HasSuffix(step, "'") || strings.HasSuffix(step, "h") || strings.HasSuffix(step, "H") {
+			return nil, fmt.Errorf("%w: hardened step %v cannot be derived from a public key", ErrInvalidExtendedKey, step)
+		}
+
+		index, err := strconv.ParseUint(step, 10, 32)
+		if err != nil || index >= hardenedOffset {
+			return nil, fmt.Errorf("%w: invalid path step %v", ErrInvalidExtendedKey, step)
+		}
+
+		indexes = append(indexes, uint32(index))
+	}
+
+	return indexes, nil
+}
+
+// formatDerivationPath the path of the indexes the way parseDerivationPath reads it, without prefix
+func formatDerivationPath(indexes []uint32) string {
+	steps := make([]string, 0, len(indexes))
+	for _, index := range indexes {
+		steps = append(steps, strconv.FormatUint(uint64(index), 10))
+	}
+
+	return strings.Join(steps, "/")
+}
+
+// base58CheckDecode base58 with the first four bytes of a double SHA-256 appended as checksum
+func base58CheckDecode(encoded string) ([]byte, error) {
+	value := new(big.Int)
+	for _, r := range encoded {
+		digit := strings.IndexRune(base58Alphabet, r)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		value.Mul(value, big.NewInt(58))
+		value.Add(value, big.NewInt(int64(digit)))
+	}
+
+	// Leading zero bytes are written as leading ones
+	zeros := len(encoded) - len(strings.TrimLeft(encoded, base58Alphabet[:1]))
+	data := append(make([]byte, zeros), value.Bytes()...)
+	if len(data) < 4 {
+		return nil, errors.New("too short for a checksum")
+	}
+
+	payload, checksum := data[:len(data)-4], data[len(data)-4:]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], checksum) {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	return payload, nil
+}
+
+const (
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	hardenedOffset = 1 << 31
+
+	xpubVersion = 0x0488b21e
+	xprvVersion = 0x0488ade4
+	tpubVersion = 0x043587cf
+	tprvVersion = 0x04358394
+)
@@ -0,0 +1,100 @@
+package ethereum_parser
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// keccak256 the original Keccak submission with 0x01 padding that Ethereum settled on, not the standardised SHA3-256
+func keccak256(data ...[]byte) []byte {
+	var state [25]uint64
+	var block [keccakRate]byte
+
+	var buffered int
+	for _, chunk := range data {
+		for len(chunk) > 0 {
+			n := copy(block[buffered:], chunk)
+			buffered += n
+			chunk = chunk[n:]
+
+			if buffered == keccakRate {
+				keccakAbsorb(&state, block[:])
+				buffered = 0
+			}
+		}
+	}
+
+	// Padding always adds at least one byte, so a full block is never left over here
+	for i := buffered; i < keccakRate; i++ {
+		block[i] = 0
+	}
+	block[buffered] ^= 0x01
+	block[keccakRate-1] ^= 0x80
+	keccakAbsorb(&state, block[:])
+
+	digest := make([]byte, 32)
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint64(digest[i*8:], state[i])
+	}
+
+	return digest
+}
+
+func keccakAbsorb(state *[25]uint64, block []byte) {
+	for i := 0; i < keccakRate/8; i++ {
+		state[i] ^= binary.LittleEndian.Uint64(block[i*8:])
+	}
+
+	keccakF(state)
+}
+
+// keccakF the keccak-f[1600] permutation
+func keccakF(state *[25]uint64) {
+	var column [5]uint64
+	for round := 0; round < 24; round++ {
+		// theta
+		for i := 0; i < 5; i++ {
+			column[i] = state[i] ^ state[i+5] ^ state[i+10] ^ state[i+15] ^ state[i+20]
+		}
+		for i := 0; i < 5; i++ {
+			t := column[(i+4)%5] ^ bits.RotateLeft64(column[(i+1)%5], 1)
+			for j := 0; j < 25; j += 5 {
+				state[j+i] ^= t
+			}
+		}
+
+		// rho and pi
+		t := state[1]
+		for i := 0; i < 24; i++ {
+			j := keccakPi[i]
+			t, state[j] = state[j], bits.RotateLeft64(t, keccakRho[i])
+		}
+
+		// chi
+		for j := 0; j < 25; j += 5 {
+			copy(column[:], state[j:j+5])
+			for i := 0; i < 5; i++ {
+				state[j+i] ^= ^column[(i+1)%5] & column[(i+2)%5]
+			}
+		}
+
+		// iota
+		state[0] ^= keccakRoundConstants[round]
+	}
+}
+
+// keccakRate bytes absorbed per permutation for a 256 bit output
+const keccakRate = 136
+
+var keccakRoundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808a, 0x8000000080008000,
+	0x000000000000808b, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008a, 0x0000000000000088, 0x0000000080008009, 0x000000008000000a,
+	0x000000008000808b, 0x800000000000008b, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800a, 0x800000008000000a,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+var keccakRho = [24]int{1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14, 27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44}
+
+var keccakPi = [24]int{10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4, 15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1}
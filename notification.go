@@ -0,0 +1,277 @@
+package ethereum_parser
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+var _ NotificationSink = LogSink{}
+var _ NotificationSink = WebhookSink{}
+
+type NotifierConfig struct {
+	WebhookURL   string        `env:"NOTIFY_WEBHOOK_URL"`
+	MaxAttempts  int           `env:"NOTIFY_MAX_ATTEMPTS" envDefault:"3"`
+	RetryBackoff time.Duration `env:"NOTIFY_RETRY_BACKOFF" envDefault:"500ms"`
+}
+
+// Event is what gets handed over to the notification service for a subscribed address
+type Event struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	ChainID int64  `json:"chainId"`
+	Address string `json:"address"`
+	// Wallet id of the wallet the address belongs to, empty for plain subscriptions
+	Wallet      string      `json:"wallet,omitempty"`
+	Transaction Transaction `json:"transaction"`
+	Withdrawal  *Withdrawal `json:"withdrawal,omitempty"`
+	Digest      *Digest     `json:"digest,omitempty"`
+	ReplacedBy  string      `json:"replacedBy,omitempty"`
+	CreatedAt   time.Time   `json:"createdAt"`
+}
+
+// Transfers the movements of value the event is about
+func (e Event) Transfers() []Transfer {
+	if e.Withdrawal != nil {
+		return []Transfer{e.Withdrawal.Transfer()}
+	}
+
+	return e.Transaction.Transfers()
+}
+
+// Notifier delivers events to every sink, retrying failed deliveries and moving the ones
+// that exhaust their retries to the dead-letter store
+type Notifier struct {
+	sinks       []NotificationSink
+	deadLetters DeadLetterRepository
+
+	maxAttempts  int
+	retryBackoff time.Duration
+}
+
+// Notify sends the event to all sinks, an error is only returned when a failed delivery could not be dead-lettered
+func (n Notifier) Notify(ctx context.Context, event Event) error {
+	for _, sink := range n.sinks {
+		attempts, err := n.deliver(ctx, sink, event)
+		if err == nil {
+			continue
+		}
+
+		log.Printf("Delivering event %v to %v failed after %d attempts: %v", event.ID, sink.Name(), attempts, err)
+
+		err = n.deadLetters.AddDeadLetter(ctx, DeadLetter{
+			ID:       newID(),
+			Sink:     sink.Name(),
+			Event:    event,
+			Error:    err.Error(),
+			Attempts: attempts,
+			FailedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to dead-letter event %v: %v", event.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// Replay redelivers a dead-lettered event to the sink it failed on, removing it from the store on success
+func (n Notifier) Replay(ctx context.Context, id string) error {
+	deadLetter, err := n.deadLetters.GetDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if deadLetter.ID == "" {
+		return ErrDeadLetterNotFound
+	}
+
+	sink, ok := n.sink(deadLetter.Sink)
+	if !ok {
+		return fmt.Errorf("sink %v is not configured", deadLetter.Sink)
+	}
+
+	attempts, err := n.deliver(ctx, sink, deadLetter.Event)
+	if err != nil {
+		deadLetter.Attempts += attempts
+		deadLetter.Replays++
+		deadLetter.Error = err.Error()
+		deadLetter.FailedAt = time.Now().UTC()
+		if updateErr := n.deadLetters.UpdateDeadLetter(ctx, deadLetter); updateErr != nil {
+			return updateErr
+		}
+
+		return fmt.Errorf("replay of %v failed: %v", id, err)
+	}
+
+	return n.deadLetters.RemoveDeadLetter(ctx, id)
+}
+
+// Discard drops a dead-lettered event without delivering it
+func (n Notifier) Discard(ctx context.Context, id string) error {
+	deadLetter, err := n.deadLetters.GetDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if deadLetter.ID == "" {
+		return ErrDeadLetterNotFound
+	}
+
+	return n.deadLetters.RemoveDeadLetter(ctx, id)
+}
+
+// deliver attempts to send the event to a sink, backing off exponentially between attempts
+func (n Notifier) deliver(ctx context.Context, sink NotificationSink, event Event) (int, error) {
+	var err error
+	backoff := n.retryBackoff
+	for attempt := 1; ; attempt++ {
+		if err = sink.Send(ctx, event); err == nil {
+			return attempt, nil
+		}
+
+		if attempt >= n.maxAttempts {
+			return attempt, err
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return attempt, err
+		}
+	}
+}
+
+func (n Notifier) sink(name string) (NotificationSink, bool) {
+	for _, sink := range n.sinks {
+		if sink.Name() == name {
+			return sink, true
+		}
+	}
+
+	return nil, false
+}
+
+func NewNotifier(config NotifierConfig, deadLetters DeadLetterRepository, sinks ...NotificationSink) Notifier {
+	maxAttempts := config.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	return Notifier{
+		sinks:        sinks,
+		deadLetters:  deadLetters,
+		maxAttempts:  maxAttempts,
+		retryBackoff: config.RetryBackoff,
+	}
+}
+
+// LogSink writes events to the log, mostly useful for local runs
+type LogSink struct{}
+
+func (LogSink) Name() string {
+	return "log"
+}
+
+func (LogSink) Send(_ context.Context, event Event) error {
+	if digest := event.Digest; digest != nil {
+		log.Printf("Digest for address %v with %d transactions (%d in, %d out) between %v and %v, totals: %v", event.Address, digest.Count, digest.CountIn, digest.CountOut, digest.From, digest.To, digest.Totals)
+		return nil
+	}
+
+	if withdrawal := event.Withdrawal; withdrawal != nil {
+		log.Printf("Withdrawal for address %v with Index: %v Validator: %v Amount: %v gwei", event.Address, withdrawal.Index, withdrawal.ValidatorIndex, withdrawal.Amount)
+		return nil
+	}
+
+	transaction := event.Transaction
+	if event.Type != EventTypeTransaction {
+		log.Printf("Event %v for address %v transaction with Hash: %v From: %v To: %v with Value: %v ", event.Type, event.Address, transaction.Hash, transaction.From, transaction.To, transaction.Value)
+		return nil
+	}
+
+	if decoded := transaction.Decoded; decoded != nil {
+		log.Printf("Event for address %v transaction with Hash: %v From: %v To: %v with Value: %v calling %v", event.Address, transaction.Hash, transaction.From, transaction.To, transaction.Value, decoded.Signature)
+		return nil
+	}
+
+	log.Printf("Event for address %v transaction with Hash: %v From: %v To: %v with Value: %v ", event.Address, transaction.Hash, transaction.From, transaction.To, transaction.Value)
+	return nil
+}
+
+// WebhookSink posts every event as JSON to the configured url
+type WebhookSink struct {
+	client *http.Client
+	url    string
+}
+
+func (s WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s WebhookSink) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Add("Content-Type", "application/json")
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	_ = response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+func NewWebhookSink(url string) WebhookSink {
+	return WebhookSink{
+		client: http.DefaultClient,
+		url:    url,
+	}
+}
+
+// newID generates a random identifier for events and dead letters
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type NotificationSink interface {
+	// Name identifies the sink in dead letters and counters
+	Name() string
+
+	// Send delivers a single event to the sink
+	Send(ctx context.Context, event Event) error
+}
+
+const (
+	EventTypeTransaction = "transaction"
+	EventTypeDigest      = "digest"
+	EventTypeWithdrawal  = "withdrawal"
+
+	// Lifecycle of a transaction seen in the mempool before being mined
+	EventTypePending  = "pending"
+	EventTypeMined    = "mined"
+	EventTypeDropped  = "dropped"
+	EventTypeReplaced = "replaced"
+)
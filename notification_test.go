@@ -0,0 +1,131 @@
+package ethereum_parser_test
+
+import (
+	"context"
+	"errors"
+	eth "ethereum_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNotifier_DeadLettersAfterRetries(t *testing.T) {
+	ctx := context.Background()
+	deadLetters := eth.NewMemDeadLetterStorage()
+	sink := &flakySink{failures: 6}
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 3}, &deadLetters, sink)
+
+	err := notifier.Notify(ctx, eth.Event{ID: "event-1", Type: eth.EventTypeTransaction, Address: address})
+	require.NoError(t, err)
+	assert.Equal(t, 3, sink.calls)
+
+	stored, err := deadLetters.GetDeadLetters(ctx, sink.Name())
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.Equal(t, "event-1", stored[0].Event.ID)
+	assert.Equal(t, 3, stored[0].Attempts)
+
+	stats, err := deadLetters.GetDeadLetterStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []eth.DeadLetterStats{{Sink: sink.Name(), Total: 1, Pending: 1}}, stats)
+
+	// Still failing, the dead letter is kept with the extra attempts
+	err = notifier.Replay(ctx, stored[0].ID)
+	assert.Error(t, err)
+
+	replayed, err := deadLetters.GetDeadLetter(ctx, stored[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, 6, replayed.Attempts)
+	assert.Equal(t, 1, replayed.Replays)
+
+	// Sink recovered, the dead letter is delivered and removed
+	err = notifier.Replay(ctx, stored[0].ID)
+	require.NoError(t, err)
+
+	stats, err = deadLetters.GetDeadLetterStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []eth.DeadLetterStats{{Sink: sink.Name(), Total: 1, Pending: 0}}, stats)
+}
+
+func TestNotifier_Discard(t *testing.T) {
+	ctx := context.Background()
+	deadLetters := eth.NewMemDeadLetterStorage()
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, &flakySink{failures: 1})
+
+	require.NoError(t, notifier.Notify(ctx, eth.Event{ID: "event-1"}))
+
+	stored, err := deadLetters.GetDeadLetters(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+
+	require.NoError(t, notifier.Discard(ctx, stored[0].ID))
+	assert.ErrorIs(t, notifier.Discard(ctx, stored[0].ID), eth.ErrDeadLetterNotFound)
+	assert.ErrorIs(t, notifier.Replay(ctx, stored[0].ID), eth.ErrDeadLetterNotFound)
+}
+
+// flakySink fails the given number of sends before it starts accepting events
+type flakySink struct {
+	failures int
+	calls    int
+}
+
+func (s *flakySink) Name() string {
+	return "flaky"
+}
+
+func (s *flakySink) Send(_ context.Context, _ eth.Event) error {
+	s.calls++
+	if s.calls <= s.failures {
+		return errors.New("sink unavailable")
+	}
+
+	return nil
+}
+
+func TestDigester_AggregatesEvents(t *testing.T) {
+	ctx := context.Background()
+	deadLetters := eth.NewMemDeadLetterStorage()
+	sink := &recordingSink{}
+	digester := eth.NewDigester(eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, sink))
+
+	options, err := eth.SubscriptionOptions{Delivery: eth.DeliveryDigest, DigestSize: 3}.Validate()
+	require.NoError(t, err)
+	sub := eth.Subscription{Address: address, Options: options}
+
+	counterparty := "0x28c6c06298d514db089934071355e5743bf21d60"
+	transactions := []eth.Transaction{
+		{Hash: "0x01", From: counterparty, To: address, Value: "0x64", Status: "0x1"},
+		{Hash: "0x02", From: address, To: counterparty, Value: "0x0a", Status: "0x1"},
+		{Hash: "0x03", From: counterparty, To: address, Value: "0x01", Status: "0x1"},
+	}
+
+	for i, transaction := range transactions {
+		require.NoError(t, digester.Add(ctx, sub, eth.Event{Type: eth.EventTypeTransaction, Address: address, Transaction: transaction}))
+		if i < len(transactions)-1 {
+			assert.Empty(t, sink.events)
+		}
+	}
+
+	require.Len(t, sink.events, 1)
+	digest := sink.events[0].Digest
+	require.NotNil(t, digest)
+	assert.Equal(t, eth.EventTypeDigest, sink.events[0].Type)
+	assert.Equal(t, 3, digest.Count)
+	assert.Equal(t, 2, digest.CountIn)
+	assert.Equal(t, 1, digest.CountOut)
+	assert.Equal(t, []string{"0x01", "0x02", "0x03"}, digest.Hashes)
+	assert.Equal(t, map[string]eth.DigestTotal{eth.AssetETH: {In: "0x65", Out: "0xa"}}, digest.Totals)
+}
+
+type recordingSink struct {
+	events []eth.Event
+}
+
+func (s *recordingSink) Name() string {
+	return "recording"
+}
+
+func (s *recordingSink) Send(_ context.Context, event eth.Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
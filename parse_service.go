@@ -2,79 +2,473 @@ package ethereum_parser
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var _ Parser = ParserService{}
 
+// ErrBlockNotAvailable the node knows about a block it cannot serve yet, usually one lagging behind its load balancer
+var ErrBlockNotAvailable = errors.New("block is not available")
+
+// ParserConfig defaults for the chains that do not set their own
+type ParserConfig struct {
+	// PollMode number polls the head block number, filter relies on eth_newBlockFilter
+	PollMode     string        `env:"POLL_MODE" envDefault:"number"`
+	PollInterval time.Duration `env:"POLL_INTERVAL" envDefault:"5s"`
+	// MinPollInterval and MaxPollInterval bound the poll interval once it is tuned to the block times, it stays fixed
+	// at PollInterval unless both are set
+	MinPollInterval time.Duration `env:"POLL_INTERVAL_MIN"`
+	MaxPollInterval time.Duration `env:"POLL_INTERVAL_MAX"`
+	Confirmations   int64         `env:"CONFIRMATIONS" envDefault:"0"`
+	// Tracer debug or parity to detect internal transfers, off by default as tracing is expensive
+	Tracer string `env:"TRACER"`
+	// ABIDir directory of JSON ABIs used to decode the input of contract calls, empty disables decoding
+	ABIDir string `env:"ABI_DIR"`
+	// VerifyBlocks turns block verification on for every chain, chains can also turn it on for themselves
+	VerifyBlocks bool `env:"VERIFY_BLOCKS" envDefault:"false"`
+	// VerifySenders turns sender recovery on for every chain, chains can also turn it on for themselves
+	VerifySenders bool `env:"VERIFY_SENDERS" envDefault:"false"`
+	// Pipeline queues and workers of the stages blocks go through, chains can set their own
+	Pipeline PipelineConfig
+}
+
 type ParserService struct {
-	storage Repository
-	client  ethereumClient
+	chain    ChainConfig
+	storage  Repository
+	client   ethereumClient
+	source   blockSource
+	notifier Notifier
+	digester *Digester
+	// pending optional, correlates mined transactions with the ones seen in the mempool
+	pending *PendingWatcher
+	codes   *codeCache
+	// abis optional, decodes the input of contract calls
+	abis   *ABIRegistry
+	tokens TokenResolver
+	// balances optional, keeps the balances of subscribers up to date
+	balances *BalanceTracker
+	// bus optional, told about parsed blocks, matched transactions and wallet addresses subscribed on the way
+	bus *EventBus
+	// pipeline the stages blocks go through on every sync
+	pipeline *pipeline
+	poll     *pollSchedule
+	// checked whether the node has been found to serve the chain id configured
+	checked *atomic.Bool
 }
 
-func (p ParserService) Parse(ctx context.Context, newSub chan bool, wg *sync.WaitGroup) error {
+func (p ParserService) Parse(ctx context.Context, wg *sync.WaitGroup) error {
 	defer wg.Done()
 
-	// Can move internal to environment
-	ticker := time.NewTicker(5 * time.Second)
+	timer := time.NewTimer(time.Duration(p.chain.PollInterval))
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-newSub:
-			log.Println("New Sub, retrieving all transactions")
-		case <-ticker.C:
-			log.Println("Retrieving Transactions")
-			transactions, err := p.UnsyncedTransactions(ctx)
-			if err != nil {
+		case <-timer.C:
+			log.Printf("Retrieving Transactions for %v", p.chain.Name)
+			if err := p.Sync(ctx); err != nil {
 				return err
 			}
+			timer.Reset(p.NextPoll())
+		case <-ctx.Done():
+			// times up
+			p.Close(context.Background())
+			return nil
+		}
+	}
+}
+
+// Sync parses the confirmed blocks past the cursor of the chain, advancing the cursor block by block. The first one
+// that gets through to the node makes sure it serves the chain configured.
+func (p ParserService) Sync(ctx context.Context) error {
+	if !p.checked.Load() {
+		if _, err := ResolveChainID(ctx, p.chain, p.client); err != nil {
+			return err
+		}
+		p.checked.Store(true)
+	}
 
-			subs, err := p.storage.GetSubscribers(ctx)
-			if err != nil {
+	head, err := p.source.Head(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve the head of %v: %w", p.chain.Name, err)
+	}
+	p.poll.observe(head, time.Now())
+
+	target := head - p.chain.Confirmations
+	cursor, err := p.storage.GetCurrentBlock(ctx, p.chain.ChainID)
+	if err != nil {
+		return err
+	}
+
+	// First run starts from the most recent confirmed block rather than replaying the whole chain
+	if cursor == 0 {
+		cursor = target - 1
+		if p.chain.StartBlock > 0 {
+			cursor = p.chain.StartBlock - 1
+		}
+	}
+
+	if target-cursor > maxBlocksPerSync {
+		log.Printf("%v is %d blocks behind, catching up", p.chain.Name, target-cursor)
+		target = cursor + maxBlocksPerSync
+	}
+
+	return p.run(ctx, cursor+1, target)
+}
+
+// NextPoll how long to wait after a sync before the next one, tuned to the block times observed when the chain has
+// poll interval bounds
+func (p ParserService) NextPoll() time.Duration {
+	return p.poll.next(time.Now())
+}
+
+// followsParent makes sure the block builds on the previous block, the one committed last for the first of a sync
+func (p ParserService) followsParent(block Block, parent string) error {
+	if !strings.EqualFold(block.ParentHash, parent) {
+		return fmt.Errorf("%w: parent %v is not the previous block %v", ErrBlockVerification, block.ParentHash, parent)
+	}
+
+	return nil
+}
+
+// Close releases what the block source holds on the node, the block filter
+func (p ParserService) Close(ctx context.Context) {
+	if closer, ok := p.source.(interface{ Close(ctx context.Context) }); ok {
+		closer.Close(ctx)
+	}
+}
+
+// ParseBlock stores the transactions of the block involving subscribers and fires up their events, taking the block
+// through the same stages as a sync one after the other, save for commit. The cursor is left alone.
+func (p ParserService) ParseBlock(ctx context.Context, block Block) error {
+	number, err := hexDecoder(block.Number)
+	if err != nil {
+		return fmt.Errorf("invalid number %v of block %v: %v", block.Number, block.Hash, err)
+	}
+
+	b := &batch{number: number, block: block}
+	for _, step := range []struct {
+		stage *stage
+		work  func(ctx context.Context, b *batch) error
+	}{
+		{p.pipeline.fetch, p.fetchBlock},
+		{p.pipeline.decode, p.decodeBlock},
+		{p.pipeline.match, p.matchBlock},
+		{p.pipeline.persist, p.persistBlock},
+		{p.pipeline.notify, p.notifyBlock},
+	} {
+		if err := step.stage.do(ctx, b, step.work); err != nil {
+			return err
+		}
+
+		if b.refused != nil {
+			return b.refused
+		}
+	}
+
+	return nil
+}
+
+// fetchBlock retrieves the block together with its token transfers and internal transfers, only the latter when the
+// block is already known
+func (p ParserService) fetchBlock(ctx context.Context, b *batch) error {
+	if b.block.Hash == "" {
+		block, err := p.source.Block(ctx, b.number)
+		if err != nil {
+			return err
+		}
+
+		if block.Hash == "" {
+			return fmt.Errorf("%w: %d of %v", ErrBlockNotAvailable, b.number, p.chain.Name)
+		}
+
+		b.block = block
+	}
+
+	return p.gather(ctx, b)
+}
+
+// gather retrieves what the block leaves out, its token transfers and internal transfers
+func (p ParserService) gather(ctx context.Context, b *batch) error {
+	var err error
+	if b.tokenTransfers, err = p.tokenTransfers(ctx, b.block.Hash); err != nil {
+		return err
+	}
+
+	if p.chain.Tracer != "" {
+		if b.internal, err = internalTransfers(ctx, p.client, p.chain.Tracer, b.block); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeBlock verifies the block is what its hash commits to and puts its transactions together with their transfers.
+// A block failing verification is refused rather than failing the stage.
+func (p ParserService) decodeBlock(_ context.Context, b *batch) error {
+	if p.chain.VerifyBlocks {
+		if err := VerifyBlock(b.block); err != nil {
+			b.refused = err
+			return nil
+		}
+	}
+
+	header := b.block.Header()
+	b.transactions = make([]Transaction, 0, len(b.block.Transactions))
+	for _, trans := range b.block.Transactions {
+		trans.ChainID = quantity(p.chain.ChainID)
+		trans.TokenTransfers = b.tokenTransfers[trans.Hash]
+		trans.InternalTransfers = b.internal[trans.Hash]
+		trans.Block = &header
+		b.transactions = append(b.transactions, trans)
+	}
+
+	return nil
+}
+
+// matchBlock finds the transactions and withdrawals involving subscribers, completing the transactions from their
+// receipt, and the events each subscription gets for them
+func (p ParserService) matchBlock(ctx context.Context, b *batch) error {
+	if b.refused != nil {
+		return nil
+	}
+
+	b.matched, b.withdrawals, b.events = nil, nil, nil
+	b.derived = p.pipeline.derived.Load()
+	subs, err := p.storage.GetSubscribers(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, trans := range b.transactions {
+		var involved []Subscription
+		for _, sub := range subs {
+			if sub.Involves(trans) {
+				involved = append(involved, sub)
+			}
+		}
+
+		if len(involved) == 0 {
+			continue
+		}
+
+		if trans, err = p.complete(ctx, trans); err != nil {
+			return err
+		}
+		b.matched = append(b.matched, matchedTransaction{transaction: trans, involved: involved})
+
+		for _, sub := range involved {
+			if sub.Matches(trans) {
+				b.events = append(b.events, queuedEvent{subscription: sub, event: p.transactionEvent(sub, trans)})
+			}
+		}
+	}
+
+	header := b.block.Header()
+	for _, withdrawal := range b.block.Withdrawals {
+		var involved []Subscription
+		for _, sub := range subs {
+			if strings.EqualFold(sub.Address, withdrawal.Address) {
+				involved = append(involved, sub)
+			}
+		}
+
+		if len(involved) == 0 {
+			continue
+		}
+
+		withdrawal.BlockNumber = b.block.Number
+		withdrawal.ChainID = quantity(p.chain.ChainID)
+		withdrawal.Block = &header
+		b.withdrawals = append(b.withdrawals, matchedWithdrawal{withdrawal: withdrawal, involved: involved})
+
+		for _, sub := range involved {
+			if sub.MatchesTransfer(withdrawal.Transfer()) {
+				b.events = append(b.events, queuedEvent{subscription: sub, event: p.withdrawalEvent(sub, withdrawal)})
+			}
+		}
+	}
+
+	return nil
+}
+
+// complete fills in what a transaction involving subscribers needs beyond the block, its receipt in the first place
+func (p ParserService) complete(ctx context.Context, trans Transaction) (Transaction, error) {
+	// The status is only known from the receipt, which is only worth fetching for transactions someone cares about
+	receipt, err := p.client.GetTransactionReceipt(ctx, trans.Hash)
+	if err != nil {
+		return Transaction{}, err
+	}
+	trans.Status = receipt.Status
+	trans.Fee = fee(receipt)
+	trans.TokenTransfers = p.tokens.Annotate(ctx, trans.TokenTransfers)
+	trans.ContractAddress = strings.ToLower(receipt.ContractAddress)
+
+	if trans.Kind, err = classify(ctx, p.codes, trans, receipt); err != nil {
+		return Transaction{}, err
+	}
+
+	if p.chain.VerifySenders {
+		trans.SenderCheck = CheckSender(trans)
+	}
+
+	if p.abis != nil && trans.Kind != TransactionKindTransfer && trans.Kind != TransactionKindContractDeployment {
+		// Anyone can send garbage input, that is no reason to stop parsing
+		if trans.Decoded, err = p.abis.Decode(trans.Input); err != nil {
+			log.Printf("Could not decode the input of %v: %v", trans.Hash, err)
+		}
+	}
+
+	return trans, nil
+}
+
+// persistBlock stores the matched transactions and withdrawals, keeping wallets and balances up to date and reconciling
+// the balances when due. Those stored by an earlier sync that failed before moving the cursor past the block are not
+// stored again, their wallets and balances are brought up to date in case the failure came in between.
+func (p ParserService) persistBlock(ctx context.Context, b *batch) error {
+	// Matched ahead of the blocks before it, which derived addresses for a wallet the block may well involve too
+	if b.derived != p.pipeline.derived.Load() {
+		if err := p.matchBlock(ctx, b); err != nil {
+			return err
+		}
+	}
+
+	if p.pending != nil {
+		for _, trans := range b.transactions {
+			if err := p.pending.Mined(ctx, trans); err != nil {
 				return err
 			}
+		}
+	}
+
+	for _, matched := range b.matched {
+		trans := matched.transaction
+		stored, err := p.storage.GetTransactionByHash(ctx, p.chain.ChainID, trans.Hash)
+		if err != nil {
+			return err
+		}
 
-			// Adding all unparsed transactions and firing up events
-			for _, trans := range transactions {
-				for _, sub := range subs {
-					if sub == trans.From || sub == trans.To {
-						err := p.FireUpEvent(sub, trans)
-						if err != nil {
-							return err
-						}
-
-						err = p.storage.AddTransaction(ctx, trans)
-						if err != nil {
-							return err
-						}
-					}
+		if stored.Hash == "" {
+			if err := p.storage.AddTransaction(ctx, trans); err != nil {
+				return err
+			}
+		}
+
+		// Kept up to date whether or not the transaction was stored already, a sync that failed in between is made
+		// good without counting anything twice
+		if !trans.Failed() {
+			for _, sub := range matched.involved {
+				if !receives(sub.Address, trans) {
+					continue
+				}
+
+				if err := p.useWalletAddress(ctx, sub); err != nil {
+					return err
 				}
 			}
-		case <-ctx.Done():
-			// times up
-			return nil
+		}
+
+		if p.balances != nil {
+			if err := p.balances.Apply(ctx, matched.involved, trans); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, matched := range b.withdrawals {
+		withdrawal := matched.withdrawal
+		stored, err := p.storage.GetWithdrawal(ctx, p.chain.ChainID, withdrawal.Index)
+		if err != nil {
+			return err
+		}
+
+		if stored.Index == "" {
+			if err := p.storage.AddWithdrawal(ctx, withdrawal); err != nil {
+				return err
+			}
+		}
+
+		for _, sub := range matched.involved {
+			if err := p.useWalletAddress(ctx, sub); err != nil {
+				return err
+			}
+		}
+
+		if p.balances != nil {
+			if err := p.balances.ApplyWithdrawal(ctx, withdrawal); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Compared with the node before any later block is persisted, the balances are complete up to this one and no further
+	if p.balances != nil {
+		return p.balances.Reconcile(ctx, b.number)
+	}
+
+	return nil
+}
+
+// notifyBlock hands the events of the block over to the notifier, or the digester
+func (p ParserService) notifyBlock(ctx context.Context, b *batch) error {
+	for _, queued := range b.events {
+		if err := p.dispatch(ctx, queued.subscription, queued.event); err != nil {
+			return err
+		}
+
+		if p.bus != nil && queued.event.Type == EventTypeTransaction {
+			p.bus.Publish(BusEvent{
+				Topic:   TopicTransactionMatched,
+				ChainID: p.chain.ChainID,
+				Address: queued.subscription.Address,
+				Block:   b.number,
+				Hash:    queued.event.Transaction.Hash,
+			})
 		}
 	}
+
+	return nil
 }
 
-// UnsyncedTransactions responsible for checking if each new transaction from current block is already processed or not
-func (p ParserService) UnsyncedTransactions(ctx context.Context) ([]Transaction, error) {
-	currentRemoteBlock, err := p.client.GetCurrentBlock(ctx)
-	if err != nil {
-		return nil, nil
+// commitBlock moves the cursor past the block, the last stage a block goes through
+func (p ParserService) commitBlock(ctx context.Context, b *batch) error {
+	if err := p.storage.SetCurrentBlock(ctx, p.chain.ChainID, b.number); err != nil {
+		return err
 	}
 
-	blockTransactions, err := p.client.GetBlockByNumber(ctx, currentRemoteBlock)
-	if err != nil {
+	p.pipeline.mux.Lock()
+	p.pipeline.committed, p.pipeline.committedHash = b.number, b.block.Hash
+	p.pipeline.mux.Unlock()
+
+	if p.bus != nil {
+		p.bus.Publish(BusEvent{Topic: TopicBlockParsed, ChainID: p.chain.ChainID, Block: b.number, Hash: b.block.Hash})
+	}
+
+	return nil
+}
+
+// UnsyncedTransactions responsible for checking if each transaction from the block is already processed or not
+func (p ParserService) UnsyncedTransactions(ctx context.Context, block Block) ([]Transaction, error) {
+	b := &batch{block: block}
+	if err := p.gather(ctx, b); err != nil {
+		return nil, err
+	}
+
+	if err := p.decodeBlock(ctx, b); err != nil {
 		return nil, err
 	}
 
 	// gathering transactions that have not been parsed
 	var unprocessedTransactions []Transaction
-	for _, trans := range blockTransactions.Transactions {
-		retrievedTransaction, err := p.storage.GetTransactionByHash(ctx, trans.Hash)
+	for _, trans := range b.transactions {
+		retrievedTransaction, err := p.storage.GetTransactionByHash(ctx, p.chain.ChainID, trans.Hash)
 		if err != nil {
 			return nil, err
 		}
@@ -83,32 +477,200 @@ func (p ParserService) UnsyncedTransactions(ctx context.Context) ([]Transaction,
 		if retrievedTransaction.Hash == "" {
 			unprocessedTransactions = append(unprocessedTransactions, trans)
 		}
-
 	}
 
 	return unprocessedTransactions, nil
 }
 
-// FireUpEvent will trigger an event that will be sent to the notification service
-func (p ParserService) FireUpEvent(address string, transaction Transaction) error {
-	log.Printf("Event for address %v transaction with Hash: %v From: %v To: %v with Value: %v ", address, transaction.Hash, transaction.From, transaction.To, transaction.Value)
+// tokenTransfers gathers the ERC-20 transfers of a block grouped by transaction hash, one eth_getLogs call covers the whole block
+func (p ParserService) tokenTransfers(ctx context.Context, blockHash string) (map[string][]TokenTransfer, error) {
+	logs, err := p.client.GetLogs(ctx, LogFilter{
+		BlockHash: blockHash,
+		Topics:    [][]string{{transferEventTopic}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := make(map[string][]TokenTransfer)
+	for _, l := range logs {
+		if l.Removed {
+			continue
+		}
+
+		if transfer, ok := l.TokenTransfer(); ok {
+			transfers[l.TransactionHash] = append(transfers[l.TransactionHash], transfer)
+		}
+	}
+
+	return transfers, nil
+}
+
+// useWalletAddress marks a wallet address that received funds as used, subscribing the addresses derived to keep the gap
+func (p ParserService) useWalletAddress(ctx context.Context, sub Subscription) error {
+	if sub.Wallet == "" {
+		return nil
+	}
+
+	wallet, err := p.storage.GetWallet(ctx, sub.Wallet)
+	if err != nil {
+		return err
+	}
+
+	// Left behind by a wallet that is gone
+	if wallet.ID == "" {
+		return nil
+	}
+
+	added, err := wallet.Use(sub.Address)
+	if err != nil {
+		return err
+	}
+
+	if err := p.storage.SetWallet(ctx, wallet); err != nil {
+		return err
+	}
+
+	for _, derived := range added {
+		if err := p.storage.Subscribe(ctx, Subscription{Address: derived.Address, Wallet: wallet.ID, Options: wallet.Options}); err != nil {
+			return err
+		}
+
+		if p.bus != nil {
+			p.bus.Publish(BusEvent{Topic: TopicSubscribed, Address: derived.Address})
+		}
+	}
+
+	if len(added) > 0 {
+		p.pipeline.derived.Add(1)
+		log.Printf("%v of wallet %v received funds, subscribed %d more addresses", sub.Address, wallet.ID, len(added))
+	}
+
 	return nil
 }
 
-func NewParserService(storage Repository, client ethereumClient) ParserService {
-	return ParserService{
-		storage: storage,
-		client:  client,
+// receives whether any of the transfers of the transaction goes to the address
+func receives(address string, transaction Transaction) bool {
+	for _, transfer := range transaction.Transfers() {
+		if strings.EqualFold(transfer.To, address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fee gas used times the effective gas price, empty when the receipt leaves either out
+func fee(receipt Receipt) string {
+	gasUsed, err := quantityToBig(receipt.GasUsed)
+	if err != nil || receipt.GasUsed == "" {
+		return ""
+	}
+
+	price, err := quantityToBig(receipt.EffectiveGasPrice)
+	if err != nil || receipt.EffectiveGasPrice == "" {
+		return ""
+	}
+
+	return bigToQuantity(gasUsed.Mul(gasUsed, price))
+}
+
+// FireUpEvent will trigger an event that will be sent to the notification service, or held back for digest subscriptions
+func (p ParserService) FireUpEvent(ctx context.Context, subscription Subscription, transaction Transaction) error {
+	return p.dispatch(ctx, subscription, p.transactionEvent(subscription, transaction))
+}
+
+func (p ParserService) transactionEvent(subscription Subscription, transaction Transaction) Event {
+	return Event{
+		ID:          newID(),
+		Type:        EventTypeTransaction,
+		ChainID:     p.chain.ChainID,
+		Address:     subscription.Address,
+		Wallet:      subscription.Wallet,
+		Transaction: transaction,
+		CreatedAt:   time.Now().UTC(),
+	}
+}
+
+func (p ParserService) withdrawalEvent(subscription Subscription, withdrawal Withdrawal) Event {
+	return Event{
+		ID:         newID(),
+		Type:       EventTypeWithdrawal,
+		ChainID:    p.chain.ChainID,
+		Address:    subscription.Address,
+		Wallet:     subscription.Wallet,
+		Withdrawal: &withdrawal,
+		CreatedAt:  time.Now().UTC(),
+	}
+}
+
+// dispatch hands the event to the notifier, or to the digester for digest subscriptions
+func (p ParserService) dispatch(ctx context.Context, subscription Subscription, event Event) error {
+	if subscription.Options.Delivery == DeliveryDigest {
+		return p.digester.Add(ctx, subscription, event)
+	}
+
+	return p.notifier.Notify(ctx, event)
+}
+
+func NewParserService(chain ChainConfig, storage Repository, client ethereumClient, notifier Notifier, digester *Digester, pending *PendingWatcher, abis *ABIRegistry, balances *BalanceTracker, bus *EventBus) (ParserService, error) {
+	source, err := newBlockSource(chain.PollMode, client)
+	if err != nil {
+		return ParserService{}, err
+	}
+
+	if chain.PollInterval <= 0 {
+		return ParserService{}, fmt.Errorf("poll interval of %v has to be positive", chain.Name)
+	}
+
+	if chain.MinPollInterval > chain.MaxPollInterval && chain.MaxPollInterval > 0 {
+		return ParserService{}, fmt.Errorf("min poll interval of %v is above its max", chain.Name)
 	}
+
+	return ParserService{
+		chain:    chain,
+		storage:  storage,
+		client:   client,
+		source:   source,
+		notifier: notifier,
+		digester: digester,
+		pending:  pending,
+		codes:    newCodeCache(client),
+		abis:     abis,
+		tokens:   NewTokenResolver(chain.ChainID, storage, client),
+		balances: balances,
+		bus:      bus,
+		pipeline: newPipeline(chain.Pipeline),
+		poll:     newPollSchedule(chain),
+		checked:  new(atomic.Bool),
+	}, nil
 }
 
 type Parser interface {
-	// Parse a parser triggered by a ticker as well as new subscription
-	Parse(ctx context.Context, newSub chan bool, wg *sync.WaitGroup) error
+	// Parse a parser triggered by a ticker, returns on the first error. Run it under a Supervisor to outlive a flaky node
+	Parse(ctx context.Context, wg *sync.WaitGroup) error
+
+	// Sync parses the confirmed blocks past the cursor of the chain
+	Sync(ctx context.Context) error
+
+	// Close releases what the parser holds on the node once it is done
+	Close(ctx context.Context)
+
+	// Metrics what each stage of the pipeline has been up to since start up
+	Metrics() []StageMetrics
 
-	// UnsyncedTransactions retrieves all transactions that have not been parsed ( perhaps better name ( sync local with blockchain was the thought )
-	UnsyncedTransactions(ctx context.Context) ([]Transaction, error)
+	// NextPoll how long to wait after a sync before the next one
+	NextPoll() time.Duration
+
+	// ParseBlock stores the transactions of a block involving subscribers and fires up their events
+	ParseBlock(ctx context.Context, block Block) error
+
+	// UnsyncedTransactions retrieves all transactions of the block that have not been parsed ( perhaps better name ( sync local with blockchain was the thought )
+	UnsyncedTransactions(ctx context.Context, block Block) ([]Transaction, error)
 
 	// FireUpEvent responsible for sending an event to the notification service
-	FireUpEvent(address string, transaction Transaction) error
+	FireUpEvent(ctx context.Context, subscription Subscription, transaction Transaction) error
 }
+
+// maxBlocksPerSync keeps a single sync from taking forever when far behind, the rest follows on the next ticks
+const maxBlocksPerSync = 100
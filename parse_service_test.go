@@ -0,0 +1,503 @@
+package ethereum_parser_test
+
+import (
+	"context"
+	eth "ethereum_parser"
+	"ethereum_parser/chaintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParserService_Sync(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+	chain.SetCode(counterparty, "0x6080")
+
+	received := chain.Mine(eth.Transaction{From: counterparty, To: address, Value: "0xde0b6b3a7640000"})
+	reverted := chain.Mine(eth.Transaction{From: address, To: counterparty, Value: "0x1", Status: "0x0"})
+	tokens := chain.Mine(eth.Transaction{
+		From:           address,
+		To:             token,
+		TokenTransfers: []eth.TokenTransfer{{Token: token, From: address, To: counterparty, Value: "0x2625a00"}},
+	})
+	// Not confirmed yet
+	unconfirmed := chain.Mine(eth.Transaction{From: counterparty, To: address, Value: "0x1"})
+
+	ctx := context.Background()
+	storage := eth.NewMemStorage()
+	require.NoError(t, storage.Subscribe(ctx, eth.Subscription{Address: address}))
+
+	deadLetters := eth.NewMemDeadLetterStorage()
+	sink := &recordingSink{}
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, sink)
+	digester := eth.NewDigester(notifier)
+	bus := eth.NewEventBus()
+	events := bus.Subscribe(16, eth.TopicBlockParsed, eth.TopicTransactionMatched)
+
+	parser, err := eth.NewParserService(eth.ChainConfig{
+		Name:          "simulated",
+		ChainID:       1,
+		PollInterval:  eth.Duration(time.Second),
+		PollMode:      eth.PollModeNumber,
+		Confirmations: 1,
+		StartBlock:    1,
+	}, &storage, chain.Client(), notifier, &digester, nil, nil, nil, bus)
+	require.NoError(t, err)
+
+	// A failing node leaves the cursor where it was
+	chain.Fail("eth_getLogs", 1, eth.RPCError{Code: -32000, Message: "request timed out"})
+	assert.Error(t, parser.Sync(ctx))
+
+	cursor, err := storage.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), cursor)
+
+	require.NoError(t, parser.Sync(ctx))
+
+	cursor, err = storage.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), cursor)
+
+	tt := []struct {
+		hash   string
+		status string
+		kind   eth.TransactionKind
+	}{
+		{hash: received.Transactions[0].Hash, status: "0x1", kind: eth.TransactionKindTransfer},
+		{hash: reverted.Transactions[0].Hash, status: "0x0", kind: eth.TransactionKindContractCall},
+		{hash: tokens.Transactions[0].Hash, status: "0x1", kind: eth.TransactionKindTokenTransfer},
+	}
+
+	for _, testCase := range tt {
+		transaction, err := storage.GetTransactionByHash(ctx, 1, testCase.hash)
+		require.NoError(t, err)
+		assert.Equal(t, testCase.status, transaction.Status)
+		assert.Equal(t, testCase.kind, transaction.Kind)
+	}
+
+	transaction, err := storage.GetTransactionByHash(ctx, 1, unconfirmed.Transactions[0].Hash)
+	require.NoError(t, err)
+	assert.Empty(t, transaction.Hash)
+
+	// Reverted transactions are stored but not notified by default
+	assert.Len(t, sink.events, 2)
+
+	// Blocks parsed and matched transactions go out on the bus, each in block order
+	published := make(map[eth.BusTopic][]int64)
+	for len(events.C) > 0 {
+		event := <-events.C
+		assert.Equal(t, int64(1), event.ChainID)
+		published[event.Topic] = append(published[event.Topic], event.Block)
+	}
+	assert.Equal(t, []int64{1, 2, 3}, published[eth.TopicBlockParsed])
+	assert.Equal(t, []int64{1, 3}, published[eth.TopicTransactionMatched])
+}
+
+func TestParserService_SyncPipeline(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+
+	var hashes []string
+	for i := 0; i < 30; i++ {
+		block := chain.Mine(eth.Transaction{From: counterparty, To: address, Value: "0x1"})
+		hashes = append(hashes, block.Transactions[0].Hash)
+	}
+
+	ctx := context.Background()
+	storage := eth.NewMemStorage()
+	require.NoError(t, storage.Subscribe(ctx, eth.Subscription{Address: address}))
+
+	deadLetters := eth.NewMemDeadLetterStorage()
+	sink := &recordingSink{}
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, sink)
+	digester := eth.NewDigester(notifier)
+
+	parser, err := eth.NewParserService(eth.ChainConfig{
+		Name:         "simulated",
+		ChainID:      1,
+		PollInterval: eth.Duration(time.Second),
+		PollMode:     eth.PollModeNumber,
+		StartBlock:   1,
+		Pipeline:     eth.PipelineConfig{QueueSize: 2, FetchWorkers: 4, DecodeWorkers: 2, MatchWorkers: 3, NotifyWorkers: 1},
+	}, &storage, chain.Client(), notifier, &digester, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	// A block somewhere in the middle fails to come through, the blocks before it still make it all the way
+	chain.Fail("eth_getLogs", 1, eth.RPCError{Code: -32000, Message: "request timed out"})
+	chain.SetLatency(time.Millisecond)
+	assert.Error(t, parser.Sync(ctx))
+
+	cursor, err := storage.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Less(t, cursor, int64(30))
+	assert.Len(t, sink.events, int(cursor))
+
+	require.NoError(t, parser.Sync(ctx))
+
+	cursor, err = storage.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), cursor)
+
+	// Every transaction went out exactly once, in block order
+	require.Len(t, sink.events, 30)
+	for i, event := range sink.events {
+		assert.Equal(t, hashes[i], event.Transaction.Hash)
+	}
+
+	metrics := parser.Metrics()
+	require.Len(t, metrics, 6)
+	assert.Equal(t, "fetch", metrics[0].Stage)
+	assert.Equal(t, 4, metrics[0].Workers)
+	assert.Equal(t, uint64(1), metrics[0].Failed)
+	assert.Equal(t, "commit", metrics[5].Stage)
+	assert.Equal(t, uint64(30), metrics[5].Processed)
+	for _, stage := range metrics {
+		assert.Zero(t, stage.Queued, stage.Stage)
+		assert.Zero(t, stage.Busy, stage.Stage)
+	}
+}
+
+func TestParserService_SyncFailedMatch(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+
+	// Only the tenth block involves the subscriber, the receipt of its transaction fails to come through once
+	for i := 1; i <= 20; i++ {
+		to := token
+		if i == 10 {
+			to = address
+		}
+		chain.Mine(eth.Transaction{From: counterparty, To: to, Value: "0x1"})
+	}
+	chain.Fail("eth_getTransactionReceipt", 1, eth.RPCError{Code: -32000, Message: "request timed out"})
+	chain.SetLatency(time.Millisecond)
+
+	ctx := context.Background()
+	storage := eth.NewMemStorage()
+	require.NoError(t, storage.Subscribe(ctx, eth.Subscription{Address: address}))
+
+	deadLetters := eth.NewMemDeadLetterStorage()
+	sink := &recordingSink{}
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, sink)
+	digester := eth.NewDigester(notifier)
+
+	parser, err := eth.NewParserService(eth.ChainConfig{
+		Name:         "simulated",
+		ChainID:      1,
+		PollInterval: eth.Duration(time.Second),
+		PollMode:     eth.PollModeNumber,
+		StartBlock:   1,
+		Pipeline:     eth.PipelineConfig{QueueSize: 4, FetchWorkers: 4, DecodeWorkers: 2, MatchWorkers: 3, NotifyWorkers: 1},
+	}, &storage, chain.Client(), notifier, &digester, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	// Every block before the failing one is seen through, whatever stage it was in
+	assert.Error(t, parser.Sync(ctx))
+
+	cursor, err := storage.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), cursor)
+	assert.Empty(t, sink.events)
+
+	require.NoError(t, parser.Sync(ctx))
+
+	cursor, err = storage.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), cursor)
+	assert.Len(t, sink.events, 1)
+}
+
+func TestParserService_SyncFilter(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+
+	first := chain.Mine(eth.Transaction{From: counterparty, To: address, Value: "0x1"})
+	hashes := []string{first.Transactions[0].Hash}
+
+	ctx := context.Background()
+	storage := eth.NewMemStorage()
+	require.NoError(t, storage.Subscribe(ctx, eth.Subscription{Address: address}))
+
+	deadLetters := eth.NewMemDeadLetterStorage()
+	sink := &recordingSink{}
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, sink)
+	digester := eth.NewDigester(notifier)
+
+	parser, err := eth.NewParserService(eth.ChainConfig{
+		Name:         "simulated",
+		ChainID:      1,
+		PollInterval: eth.Duration(time.Second),
+		PollMode:     eth.PollModeFilter,
+		StartBlock:   1,
+		Pipeline:     eth.PipelineConfig{QueueSize: 2, FetchWorkers: 4, DecodeWorkers: 2, MatchWorkers: 3, NotifyWorkers: 1},
+	}, &storage, chain.Client(), notifier, &digester, nil, nil, nil, nil)
+	require.NoError(t, err)
+	defer parser.Close(ctx)
+
+	// Installs the filter, the blocks before it are fetched by number
+	require.NoError(t, parser.Sync(ctx))
+
+	// The blocks reported by the filter are handed out to the fetch workers all at once
+	for i := 0; i < 20; i++ {
+		block := chain.Mine(eth.Transaction{From: counterparty, To: address, Value: "0x1"})
+		hashes = append(hashes, block.Transactions[0].Hash)
+	}
+	require.NoError(t, parser.Sync(ctx))
+
+	cursor, err := storage.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(21), cursor)
+
+	require.Len(t, sink.events, 21)
+	for i, event := range sink.events {
+		assert.Equal(t, hashes[i], event.Transaction.Hash)
+	}
+}
+
+func TestParserService_SyncWallet(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+
+	ctx := context.Background()
+	storage := eth.NewMemStorage()
+	service := eth.NewService(&storage, nil, nil, eth.Notifier{}, nil, nil, nil)
+
+	// Only the first address is subscribed, every one receiving funds derives the next
+	wallet, err := service.SubscribeWallet(ctx, walletXPub, "", 1, eth.SubscriptionOptions{})
+	require.NoError(t, err)
+	require.Len(t, wallet.Addresses, 1)
+
+	var hashes []string
+	for _, to := range []string{
+		"0x91860ef4fc12f4dca2564a3f7fccea9325831ac6",
+		"0x29379f45f515c494483298225d1b347f73d1babf",
+		"0xfa89adcae8548001f951a4df9bc236e629c5aef4",
+	} {
+		block := chain.Mine(eth.Transaction{From: counterparty, To: to, Value: "0x1"})
+		hashes = append(hashes, block.Transactions[0].Hash)
+	}
+
+	deadLetters := eth.NewMemDeadLetterStorage()
+	sink := &recordingSink{}
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, sink)
+	digester := eth.NewDigester(notifier)
+
+	parser, err := eth.NewParserService(eth.ChainConfig{
+		Name:         "simulated",
+		ChainID:      1,
+		PollInterval: eth.Duration(time.Second),
+		PollMode:     eth.PollModeNumber,
+		StartBlock:   1,
+		Pipeline:     eth.PipelineConfig{QueueSize: 8, FetchWorkers: 4, DecodeWorkers: 2, MatchWorkers: 4, NotifyWorkers: 1},
+	}, &storage, chain.Client(), notifier, &digester, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	// The blocks are matched before the addresses they pay to get derived, persisting them matches them again
+	require.NoError(t, parser.Sync(ctx))
+
+	for _, hash := range hashes {
+		transaction, err := storage.GetTransactionByHash(ctx, 1, hash)
+		require.NoError(t, err)
+		assert.Equal(t, hash, transaction.Hash)
+	}
+	require.Len(t, sink.events, 3)
+	for i, event := range sink.events {
+		assert.Equal(t, hashes[i], event.Transaction.Hash)
+		assert.Equal(t, wallet.ID, event.Wallet)
+	}
+}
+
+func TestParserService_SyncBalances(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+	chain.SetBalance(address, "0xde0b6b3a7640000")
+	chain.Mine(eth.Transaction{From: counterparty, To: address, Value: "0x1"})
+
+	ctx := context.Background()
+	storage := eth.NewMemStorage()
+	require.NoError(t, storage.Subscribe(ctx, eth.Subscription{Address: address}))
+
+	deadLetters := eth.NewMemDeadLetterStorage()
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, &recordingSink{})
+	digester := eth.NewDigester(notifier)
+	balances := eth.NewBalanceTracker(eth.BalanceConfig{Enabled: true, ReconcileInterval: time.Hour}, 1, &storage, chain.Client())
+
+	parser, err := eth.NewParserService(eth.ChainConfig{
+		Name:         "simulated",
+		ChainID:      1,
+		PollInterval: eth.Duration(time.Second),
+		PollMode:     eth.PollModeNumber,
+		StartBlock:   1,
+	}, &storage, chain.Client(), notifier, &digester, nil, nil, &balances, nil)
+	require.NoError(t, err)
+
+	// The transaction gets stored but reading the balance fails, the next sync tracks it all the same
+	chain.Fail("eth_getBalance", 1, eth.RPCError{Code: -32000, Message: "request timed out"})
+	assert.Error(t, parser.Sync(ctx))
+	require.NoError(t, parser.Sync(ctx))
+
+	tracked, err := storage.GetBalances(ctx, 1, address)
+	require.NoError(t, err)
+	require.Len(t, tracked, 1)
+	assert.Equal(t, "0xde0b6b3a7640000", tracked[0].Balance)
+}
+
+func TestParserService_SyncReorg(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+	chain.Mine()
+
+	ctx := context.Background()
+	storage := eth.NewMemStorage()
+	require.NoError(t, storage.Subscribe(ctx, eth.Subscription{Address: address}))
+
+	deadLetters := eth.NewMemDeadLetterStorage()
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, &recordingSink{})
+	digester := eth.NewDigester(notifier)
+
+	parser, err := eth.NewParserService(eth.ChainConfig{
+		Name:         "simulated",
+		ChainID:      1,
+		PollInterval: eth.Duration(time.Second),
+		PollMode:     eth.PollModeFilter,
+		StartBlock:   1,
+	}, &storage, chain.Client(), notifier, &digester, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	// Installs the block filter
+	require.NoError(t, parser.Sync(ctx))
+
+	// The filter reports both blocks at height 2, only the one still canonical is parsed
+	orphaned := chain.Mine(eth.Transaction{From: counterparty, To: address, Value: "0x1"})
+	chain.Reorg(1)
+	canonical := chain.Mine(eth.Transaction{From: counterparty, To: address, Value: "0x2"})
+	require.NotEqual(t, orphaned.Hash, canonical.Hash)
+
+	require.NoError(t, parser.Sync(ctx))
+
+	transaction, err := storage.GetTransactionByHash(ctx, 1, orphaned.Transactions[0].Hash)
+	require.NoError(t, err)
+	assert.Empty(t, transaction.Hash)
+
+	transaction, err = storage.GetTransactionByHash(ctx, 1, canonical.Transactions[0].Hash)
+	require.NoError(t, err)
+	assert.Equal(t, "0x2", transaction.Value)
+
+	// A restarted node forgets the filter, the parser installs another and carries on by number
+	chain.ForgetFilters()
+	restarted := chain.Mine(eth.Transaction{From: counterparty, To: address, Value: "0x3"})
+	require.NoError(t, parser.Sync(ctx))
+
+	transaction, err = storage.GetTransactionByHash(ctx, 1, restarted.Transactions[0].Hash)
+	require.NoError(t, err)
+	assert.Equal(t, "0x3", transaction.Value)
+	assert.Equal(t, 2, chain.Requests("eth_newBlockFilter"))
+}
+
+func TestParserService_SyncParent(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+	chain.SetVerifiable()
+	chain.Mine()
+
+	ctx := context.Background()
+	storage := eth.NewMemStorage()
+	deadLetters := eth.NewMemDeadLetterStorage()
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, &recordingSink{})
+	digester := eth.NewDigester(notifier)
+
+	config := eth.ChainConfig{
+		Name:         "simulated",
+		ChainID:      1,
+		PollInterval: eth.Duration(time.Second),
+		PollMode:     eth.PollModeNumber,
+		StartBlock:   1,
+		VerifyBlocks: true,
+	}
+	parser, err := eth.NewParserService(config, &storage, chain.Client(), notifier, &digester, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, parser.Sync(ctx))
+	cursor, err := storage.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cursor)
+
+	// The block parsed gets reorged away, the first block of the next sync does not build on it
+	chain.Reorg(1)
+	chain.Mine()
+	chain.Mine()
+
+	require.NoError(t, parser.Sync(ctx))
+	cursor, err = storage.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cursor, "refused")
+
+	// After a restart the block before the cursor is taken from the node
+	restarted, err := eth.NewParserService(config, &storage, chain.Client(), notifier, &digester, nil, nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, restarted.Sync(ctx))
+	cursor, err = storage.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cursor)
+}
+
+func TestParserService_NextPoll(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+	chain.Mine()
+
+	ctx := context.Background()
+	storage := eth.NewMemStorage()
+	deadLetters := eth.NewMemDeadLetterStorage()
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, &recordingSink{})
+	digester := eth.NewDigester(notifier)
+
+	parser, err := eth.NewParserService(eth.ChainConfig{
+		Name:            "simulated",
+		ChainID:         1,
+		PollInterval:    eth.Duration(time.Second),
+		MinPollInterval: eth.Duration(10 * time.Millisecond),
+		MaxPollInterval: eth.Duration(400 * time.Millisecond),
+		PollMode:        eth.PollModeNumber,
+	}, &storage, chain.Client(), notifier, &digester, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	// Nothing to go by before the head moved once
+	require.NoError(t, parser.Sync(ctx))
+	assert.Equal(t, time.Second, parser.NextPoll())
+
+	time.Sleep(200 * time.Millisecond)
+	chain.Mine()
+	require.NoError(t, parser.Sync(ctx))
+
+	// Right after a block the next one is a block time away
+	due := parser.NextPoll()
+	assert.Greater(t, due, 100*time.Millisecond)
+	assert.LessOrEqual(t, due, 400*time.Millisecond)
+
+	// Once it is overdue the node is polled faster, backing off while nothing changes
+	require.NoError(t, parser.Sync(ctx))
+	overdue := parser.NextPoll()
+	assert.Less(t, overdue, due)
+	assert.GreaterOrEqual(t, overdue, 10*time.Millisecond)
+
+	require.NoError(t, parser.Sync(ctx))
+	assert.Equal(t, 2*overdue, parser.NextPoll())
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, parser.Sync(ctx))
+	}
+	assert.Equal(t, 400*time.Millisecond, parser.NextPoll())
+
+	_, err = eth.NewParserService(eth.ChainConfig{
+		Name:            "simulated",
+		ChainID:         1,
+		PollInterval:    eth.Duration(time.Second),
+		MinPollInterval: eth.Duration(time.Minute),
+		MaxPollInterval: eth.Duration(time.Second),
+		PollMode:        eth.PollModeNumber,
+	}, &storage, chain.Client(), notifier, &digester, nil, nil, nil, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,309 @@
+package ethereum_parser
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+type PendingConfig struct {
+	Enabled      bool          `env:"PENDING_ENABLED" envDefault:"false"`
+	PollInterval time.Duration `env:"PENDING_POLL_INTERVAL" envDefault:"2s"`
+	// CheckInterval how often tracked transactions are looked up again to notice them being dropped
+	CheckInterval time.Duration `env:"PENDING_CHECK_INTERVAL" envDefault:"30s"`
+	// ForgetAfter transactions pending for longer than this are no longer tracked
+	ForgetAfter time.Duration `env:"PENDING_FORGET_AFTER" envDefault:"1h"`
+}
+
+// PendingWatcher detects mempool transactions of subscribers and follows them until they are mined, dropped or replaced
+type PendingWatcher struct {
+	mux sync.Mutex
+
+	chainID  int64
+	storage  Repository
+	client   ethereumClient
+	notifier Notifier
+	config   PendingConfig
+	tokens   TokenResolver
+
+	filterID string
+	// pending tracked transactions by hash
+	pending map[string]*pendingTransaction
+	// byNonce hash of the tracked transaction for every sender and nonce, replacements reuse the nonce
+	byNonce map[string]string
+}
+
+type pendingTransaction struct {
+	transaction   Transaction
+	subscriptions []Subscription
+	seenAt        time.Time
+	checkedAt     time.Time
+}
+
+// Poll picks up the transactions that entered the mempool since the last poll and checks on the tracked ones
+func (w *PendingWatcher) Poll(ctx context.Context) error {
+	hashes, err := w.filterChanges(ctx)
+	if err != nil {
+		return err
+	}
+
+	subs, err := w.storage.GetSubscribers(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		if w.tracked(hash) {
+			continue
+		}
+
+		trans, err := w.client.GetTransactionByHash(ctx, hash)
+		if err != nil {
+			return err
+		}
+
+		// Already gone from the mempool, or mined before we got to it in which case the parser takes over
+		if trans.Hash == "" || trans.BlockNumber != "" {
+			continue
+		}
+
+		trans.ChainID = quantity(w.chainID)
+		trans.TokenTransfers = pendingTokenTransfers(trans)
+		if err := w.track(ctx, subs, trans); err != nil {
+			return err
+		}
+	}
+
+	return w.check(ctx)
+}
+
+// Mined correlates a mined transaction with the tracked ones, notifying about the pending transaction being mined
+// or replaced by another one with the same nonce
+func (w *PendingWatcher) Mined(ctx context.Context, transaction Transaction) error {
+	w.mux.Lock()
+	var events []Event
+	if tracked, ok := w.pending[transaction.Hash]; ok {
+		events = tracked.events(w.chainID, EventTypeMined, transaction, "")
+		w.untrack(tracked)
+		w.mux.Unlock()
+		return w.notify(ctx, events)
+	}
+	w.mux.Unlock()
+
+	return w.replaced(ctx, transaction)
+}
+
+// replaced notifies about the tracked transaction with the same sender and nonce being replaced by the given one
+func (w *PendingWatcher) replaced(ctx context.Context, transaction Transaction) error {
+	w.mux.Lock()
+	var events []Event
+	if hash, ok := w.byNonce[nonceKey(transaction)]; ok && hash != transaction.Hash {
+		if tracked, ok := w.pending[hash]; ok {
+			events = tracked.events(w.chainID, EventTypeReplaced, tracked.transaction, transaction.Hash)
+			w.untrack(tracked)
+		}
+	}
+	w.mux.Unlock()
+
+	return w.notify(ctx, events)
+}
+
+// filterChanges polls the pending transaction filter, recreating it when the node has forgotten it
+func (w *PendingWatcher) filterChanges(ctx context.Context) ([]string, error) {
+	if w.filterID == "" {
+		filterID, err := w.client.NewPendingTransactionFilter(ctx)
+		if err != nil {
+			return nil, err
+		}
+		w.filterID = filterID
+	}
+
+	hashes, err := w.client.GetFilterChanges(ctx, w.filterID)
+	if isFilterNotFound(err) {
+		log.Printf("Pending transaction filter %v expired, creating a new one", w.filterID)
+		w.filterID = ""
+		return nil, nil
+	}
+
+	return hashes, err
+}
+
+func (w *PendingWatcher) track(ctx context.Context, subs []Subscription, trans Transaction) error {
+	// A new transaction reusing the nonce of a tracked one replaces it, whether or not the new one concerns a subscriber
+	if err := w.replaced(ctx, trans); err != nil {
+		return err
+	}
+
+	var matched []Subscription
+	for _, sub := range subs {
+		// Digest subscriptions are about volume, following every pending transaction would defeat the purpose
+		if sub.Options.Delivery == DeliveryDigest {
+			continue
+		}
+
+		if sub.Involves(trans) && sub.Matches(trans) {
+			matched = append(matched, sub)
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil
+	}
+
+	trans.TokenTransfers = w.tokens.Annotate(ctx, trans.TokenTransfers)
+
+	now := time.Now().UTC()
+	tracked := &pendingTransaction{transaction: trans, subscriptions: matched, seenAt: now, checkedAt: now}
+
+	w.mux.Lock()
+	w.pending[trans.Hash] = tracked
+	w.byNonce[nonceKey(trans)] = trans.Hash
+	w.mux.Unlock()
+
+	return w.notify(ctx, tracked.events(w.chainID, EventTypePending, trans, ""))
+}
+
+// check looks up the tracked transactions once in a while, the ones the node no longer knows have been dropped
+func (w *PendingWatcher) check(ctx context.Context) error {
+	now := time.Now().UTC()
+
+	w.mux.Lock()
+	var due []*pendingTransaction
+	for _, tracked := range w.pending {
+		if now.Sub(tracked.seenAt) >= w.config.ForgetAfter {
+			log.Printf("Transaction %v has been pending since %v, no longer tracking it", tracked.transaction.Hash, tracked.seenAt)
+			w.untrack(tracked)
+			continue
+		}
+
+		if now.Sub(tracked.checkedAt) >= w.config.CheckInterval {
+			due = append(due, tracked)
+		}
+	}
+	w.mux.Unlock()
+
+	for _, tracked := range due {
+		trans, err := w.client.GetTransactionByHash(ctx, tracked.transaction.Hash)
+		if err != nil {
+			return err
+		}
+
+		w.mux.Lock()
+		tracked.checkedAt = now
+		var events []Event
+		if _, ok := w.pending[tracked.transaction.Hash]; ok && trans.Hash == "" {
+			events = tracked.events(w.chainID, EventTypeDropped, tracked.transaction, "")
+			w.untrack(tracked)
+		}
+		w.mux.Unlock()
+
+		if err := w.notify(ctx, events); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *PendingWatcher) tracked(hash string) bool {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	_, ok := w.pending[hash]
+	return ok
+}
+
+// untrack expects the lock to be held
+func (w *PendingWatcher) untrack(tracked *pendingTransaction) {
+	delete(w.pending, tracked.transaction.Hash)
+	if w.byNonce[nonceKey(tracked.transaction)] == tracked.transaction.Hash {
+		delete(w.byNonce, nonceKey(tracked.transaction))
+	}
+}
+
+func (w *PendingWatcher) notify(ctx context.Context, events []Event) error {
+	for _, event := range events {
+		if err := w.notifier.Notify(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close uninstalls the pending transaction filter, the watcher is polled by its supervisor until then
+func (w *PendingWatcher) Close(ctx context.Context) {
+	if w.filterID == "" {
+		return
+	}
+
+	if _, err := w.client.UninstallFilter(ctx, w.filterID); err != nil {
+		log.Printf("There was an issue trying to uninstall filter %v: %v", w.filterID, err)
+	}
+}
+
+func (t *pendingTransaction) events(chainID int64, eventType string, transaction Transaction, replacedBy string) []Event {
+	events := make([]Event, 0, len(t.subscriptions))
+	for _, sub := range t.subscriptions {
+		events = append(events, Event{
+			ID:          newID(),
+			Type:        eventType,
+			ChainID:     chainID,
+			Address:     sub.Address,
+			Wallet:      sub.Wallet,
+			Transaction: transaction,
+			ReplacedBy:  replacedBy,
+			CreatedAt:   time.Now().UTC(),
+		})
+	}
+
+	return events
+}
+
+// pendingTokenTransfers pending transactions have no logs yet, so direct ERC-20 transfer calls are decoded from the input
+func pendingTokenTransfers(trans Transaction) []TokenTransfer {
+	input := strings.ToLower(strings.TrimPrefix(trans.Input, "0x"))
+
+	var from, to, value string
+	switch {
+	case strings.HasPrefix(input, transferSelector) && len(input) >= 8+2*64:
+		from, to, value = trans.From, "0x"+input[8+24:8+64], "0x"+input[8+64:8+128]
+	case strings.HasPrefix(input, transferFromSelector) && len(input) >= 8+3*64:
+		from, to, value = "0x"+input[8+24:8+64], "0x"+input[8+64+24:8+128], "0x"+input[8+128:8+192]
+	default:
+		return nil
+	}
+
+	amount, err := quantityToBig(value)
+	if err != nil {
+		return nil
+	}
+
+	return []TokenTransfer{{Token: strings.ToLower(trans.To), From: strings.ToLower(from), To: to, Value: bigToQuantity(amount)}}
+}
+
+func nonceKey(trans Transaction) string {
+	return strings.ToLower(trans.From) + ":" + trans.Nonce
+}
+
+func NewPendingWatcher(config PendingConfig, chainID int64, storage Repository, client ethereumClient, notifier Notifier) PendingWatcher {
+	return PendingWatcher{
+		chainID:  chainID,
+		storage:  storage,
+		client:   client,
+		notifier: notifier,
+		config:   config,
+		pending:  make(map[string]*pendingTransaction),
+		byNonce:  make(map[string]string),
+		tokens:   NewTokenResolver(chainID, storage, client),
+	}
+}
+
+const (
+	// transferSelector first 4 bytes of keccak256("transfer(address,uint256)")
+	transferSelector = "a9059cbb"
+	// transferFromSelector first 4 bytes of keccak256("transferFrom(address,address,uint256)")
+	transferFromSelector = "23b872dd"
+)
@@ -0,0 +1,133 @@
+package ethereum_parser_test
+
+import (
+	"context"
+	eth "ethereum_parser"
+	"ethereum_parser/chaintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPendingWatcher_Mined(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+
+	ctx := context.Background()
+	watcher, parser, sink := newPendingWatcher(t, chain)
+
+	// Picked up on the first poll, the filter only reports what came in after it was created
+	require.NoError(t, watcher.Poll(ctx))
+	pending := chain.AddPending(eth.Transaction{From: address, To: counterparty, Value: "0x1", Nonce: "0x5"})
+	require.NoError(t, watcher.Poll(ctx))
+
+	require.Len(t, sink.events, 1)
+	assert.Equal(t, eth.EventTypePending, sink.events[0].Type)
+	assert.Equal(t, pending.Hash, sink.events[0].Transaction.Hash)
+
+	chain.Mine(pending)
+	require.NoError(t, parser.Sync(ctx))
+
+	types := make([]string, 0, len(sink.events))
+	for _, event := range sink.events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{eth.EventTypePending, eth.EventTypeMined, eth.EventTypeTransaction}, types)
+	assert.Equal(t, pending.Hash, sink.events[1].Transaction.Hash)
+	assert.NotEmpty(t, sink.events[1].Transaction.BlockNumber, "the mined transaction rather than the pending one")
+}
+
+func TestPendingWatcher_Replaced(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+
+	ctx := context.Background()
+	watcher, parser, sink := newPendingWatcher(t, chain)
+
+	require.NoError(t, watcher.Poll(ctx))
+	pending := chain.AddPending(eth.Transaction{From: address, To: counterparty, Value: "0x1", Nonce: "0x5"})
+	require.NoError(t, watcher.Poll(ctx))
+	require.Len(t, sink.events, 1)
+
+	// Sped up with a higher gas price, the same nonce makes it into a block under another hash
+	block := chain.Mine(eth.Transaction{From: address, To: counterparty, Value: "0x1", Nonce: "0x5", GasPrice: "0x77359400"})
+	require.NoError(t, parser.Sync(ctx))
+
+	require.Len(t, sink.events, 3)
+	replaced := sink.events[1]
+	assert.Equal(t, eth.EventTypeReplaced, replaced.Type)
+	assert.Equal(t, pending.Hash, replaced.Transaction.Hash)
+	assert.Equal(t, block.Transactions[0].Hash, replaced.ReplacedBy)
+	assert.Equal(t, address, replaced.Address)
+}
+
+func TestPendingWatcher_Dropped(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+
+	ctx := context.Background()
+	watcher, _, sink := newPendingWatcher(t, chain)
+
+	require.NoError(t, watcher.Poll(ctx))
+	// A direct ERC-20 transfer, decoded from its input as there are no logs yet
+	pending := chain.AddPending(eth.Transaction{
+		From:  address,
+		To:    token,
+		Value: "0x0",
+		Nonce: "0x5",
+		Input: "0xa9059cbb" +
+			"000000000000000000000000" + counterparty[2:] +
+			"0000000000000000000000000000000000000000000000000000000002625a00",
+	})
+	require.NoError(t, watcher.Poll(ctx))
+
+	require.Len(t, sink.events, 1)
+	assert.Equal(t, eth.EventTypePending, sink.events[0].Type)
+	require.Len(t, sink.events[0].Transaction.TokenTransfers, 1)
+	transfer := sink.events[0].Transaction.TokenTransfers[0]
+	assert.Equal(t, token, transfer.Token)
+	assert.Equal(t, address, transfer.From)
+	assert.Equal(t, counterparty, transfer.To)
+	assert.Equal(t, "0x2625a00", transfer.Value)
+
+	// Still in the mempool, nothing to report
+	require.NoError(t, watcher.Poll(ctx))
+	assert.Len(t, sink.events, 1)
+
+	chain.Drop(pending.Hash)
+	require.NoError(t, watcher.Poll(ctx))
+
+	require.Len(t, sink.events, 2)
+	assert.Equal(t, eth.EventTypeDropped, sink.events[1].Type)
+	assert.Equal(t, pending.Hash, sink.events[1].Transaction.Hash)
+
+	// No longer tracked, so not dropped twice
+	require.NoError(t, watcher.Poll(ctx))
+	assert.Len(t, sink.events, 2)
+}
+
+// newPendingWatcher a watcher of the transactions of the address checking on them every poll, together with the parser
+// telling it about mined ones
+func newPendingWatcher(t *testing.T, chain *chaintest.Chain) (*eth.PendingWatcher, eth.ParserService, *recordingSink) {
+	storage := eth.NewMemStorage()
+	require.NoError(t, storage.Subscribe(context.Background(), eth.Subscription{Address: address}))
+
+	deadLetters := eth.NewMemDeadLetterStorage()
+	sink := &recordingSink{}
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, sink)
+	digester := eth.NewDigester(notifier)
+
+	watcher := eth.NewPendingWatcher(eth.PendingConfig{PollInterval: time.Second, ForgetAfter: time.Hour}, 1, &storage, chain.Client(), notifier)
+
+	parser, err := eth.NewParserService(eth.ChainConfig{
+		Name:         "simulated",
+		ChainID:      1,
+		PollInterval: eth.Duration(time.Second),
+		PollMode:     eth.PollModeNumber,
+		StartBlock:   1,
+	}, &storage, chain.Client(), notifier, &digester, &watcher, nil, nil, nil)
+	require.NoError(t, err)
+
+	return &watcher, parser, sink
+}
@@ -0,0 +1,419 @@
+package ethereum_parser
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PipelineConfig how many blocks wait between the stages of the pipeline and how many each stage works on at once
+type PipelineConfig struct {
+	// QueueSize blocks waiting in front of a stage, a full queue holds the stages before it back
+	QueueSize     int `env:"PIPELINE_QUEUE_SIZE" envDefault:"8" json:"queueSize"`
+	FetchWorkers  int `env:"PIPELINE_FETCH_WORKERS" envDefault:"4" json:"fetchWorkers"`
+	DecodeWorkers int `env:"PIPELINE_DECODE_WORKERS" envDefault:"2" json:"decodeWorkers"`
+	MatchWorkers  int `env:"PIPELINE_MATCH_WORKERS" envDefault:"4" json:"matchWorkers"`
+	// NotifyWorkers more than one lets the events of a block go out before those of the blocks preceding it
+	NotifyWorkers int `env:"PIPELINE_NOTIFY_WORKERS" envDefault:"1" json:"notifyWorkers"`
+}
+
+// withDefaults fills in what the chain leaves out from the parser configuration
+func (c PipelineConfig) withDefaults(defaults PipelineConfig) PipelineConfig {
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaults.QueueSize
+	}
+	if c.FetchWorkers <= 0 {
+		c.FetchWorkers = defaults.FetchWorkers
+	}
+	if c.DecodeWorkers <= 0 {
+		c.DecodeWorkers = defaults.DecodeWorkers
+	}
+	if c.MatchWorkers <= 0 {
+		c.MatchWorkers = defaults.MatchWorkers
+	}
+	if c.NotifyWorkers <= 0 {
+		c.NotifyWorkers = defaults.NotifyWorkers
+	}
+
+	return c
+}
+
+// StageMetrics what a stage of the pipeline has been up to since start up
+type StageMetrics struct {
+	Stage   string `json:"stage"`
+	Workers int    `json:"workers"`
+	// Queued blocks waiting for the stage, the ordered ones count those held back for an earlier block too
+	Queued int `json:"queued"`
+	// Busy workers working on a block right now
+	Busy      int64  `json:"busy"`
+	Processed uint64 `json:"processed"`
+	Failed    uint64 `json:"failed"`
+	// Time spent on blocks, divided by Processed it gives how long a block takes
+	Time Duration `json:"time"`
+}
+
+// stage counters of a pipeline stage, shared by every sync of the parser
+type stage struct {
+	name    string
+	workers int
+
+	mux sync.Mutex
+	// queue in front of the stage during a sync
+	queue <-chan *batch
+	// held blocks that overtook an earlier one, waiting for it
+	held atomic.Int64
+
+	busy      atomic.Int64
+	processed atomic.Uint64
+	failed    atomic.Uint64
+	nanos     atomic.Int64
+}
+
+// do runs the stage on a block, keeping count
+func (s *stage) do(ctx context.Context, b *batch, work func(ctx context.Context, b *batch) error) error {
+	s.busy.Add(1)
+	defer s.busy.Add(-1)
+
+	start := time.Now()
+	err := work(ctx, b)
+	s.nanos.Add(int64(time.Since(start)))
+
+	if err != nil {
+		// Work cut short by another stage failing is not a failure of its own
+		if ctx.Err() == nil {
+			s.failed.Add(1)
+		}
+		return err
+	}
+
+	s.processed.Add(1)
+	return nil
+}
+
+// run starts the workers of the stage on the blocks queued, handing them over to the queue returned once done. The
+// queue is closed once every worker is done, a failing worker reports it and stops.
+func (s *stage) run(ctx context.Context, wg *sync.WaitGroup, queue <-chan *batch, size int, work func(ctx context.Context, b *batch) error, fail func(err error)) <-chan *batch {
+	s.watch(queue)
+	out := make(chan *batch, size)
+
+	var workers sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				var b *batch
+				var ok bool
+				select {
+				case b, ok = <-queue:
+				case <-ctx.Done():
+					return
+				}
+				if !ok {
+					return
+				}
+
+				if err := s.do(ctx, b, work); err != nil {
+					fail(err)
+					return
+				}
+
+				select {
+				case out <- b:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		workers.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// inOrder hands the queued blocks over one after the other starting at from, holding back those that overtook an
+// earlier one. It stops at the first gap once the queue is closed.
+func (s *stage) inOrder(ctx context.Context, wg *sync.WaitGroup, from int64, queue <-chan *batch) <-chan *batch {
+	s.watch(queue)
+	out := make(chan *batch)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(out)
+		defer s.held.Store(0)
+
+		held := make(map[int64]*batch)
+		next := from
+		for b := range queue {
+			held[b.number] = b
+			s.held.Add(1)
+
+			for ready, ok := held[next]; ok; ready, ok = held[next] {
+				delete(held, next)
+				s.held.Add(-1)
+				select {
+				case out <- ready:
+				case <-ctx.Done():
+					return
+				}
+				next++
+			}
+		}
+	}()
+
+	return out
+}
+
+// watch the queue the stage takes its blocks from for the metrics
+func (s *stage) watch(queue <-chan *batch) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.queue = queue
+}
+
+func (s *stage) metrics() StageMetrics {
+	s.mux.Lock()
+	queued := len(s.queue)
+	s.mux.Unlock()
+
+	return StageMetrics{
+		Stage:     s.name,
+		Workers:   s.workers,
+		Queued:    queued + int(s.held.Load()),
+		Busy:      s.busy.Load(),
+		Processed: s.processed.Load(),
+		Failed:    s.failed.Load(),
+		Time:      Duration(s.nanos.Load()),
+	}
+}
+
+// pipeline the stages a block goes through, in order. Fetch, decode, match and notify take several blocks at once,
+// persist and commit take them one at a time in block order.
+type pipeline struct {
+	config PipelineConfig
+
+	fetch   *stage
+	decode  *stage
+	match   *stage
+	persist *stage
+	notify  *stage
+	commit  *stage
+
+	// derived counts the times addresses got derived for a wallet, the blocks matched before are matched again
+	derived atomic.Uint64
+
+	mux sync.Mutex
+	// committed number and hash of the block the cursor last moved past, the next sync has to build on it
+	committed     int64
+	committedHash string
+}
+
+// batch a block on its way through the pipeline, every stage fills in its part
+type batch struct {
+	number int64
+	block  Block
+
+	tokenTransfers map[string][]TokenTransfer
+	internal       map[string][]InternalTransfer
+
+	// refused why the block failed verification, it is not parsed and the sync ends before it
+	refused error
+	// transactions every transaction of the block
+	transactions []Transaction
+
+	// derived how many times addresses had been derived for wallets when the block got matched
+	derived uint64
+	// matched the transactions and withdrawals involving subscribers
+	matched     []matchedTransaction
+	withdrawals []matchedWithdrawal
+	// events to dispatch once persisted
+	events []queuedEvent
+}
+
+type matchedTransaction struct {
+	transaction Transaction
+	involved    []Subscription
+}
+
+type matchedWithdrawal struct {
+	withdrawal Withdrawal
+	involved   []Subscription
+}
+
+type queuedEvent struct {
+	subscription Subscription
+	event        Event
+}
+
+// run takes the blocks from..to through the stages of the parser. The cursor only ever moves forward one block at a
+// time, once a block went through every stage. A failing stage stops feeding the pipeline new blocks, those already
+// in it go on through the stages up to the gap the failing one leaves, so the next sync starts right where this one
+// failed. Only a failing persist, notify or commit drops what is left.
+func (p ParserService) run(parent context.Context, from int64, to int64) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	// intake stops feeding block numbers on the first failure, or refused block
+	intake, stopIntake := context.WithCancel(ctx)
+	defer stopIntake()
+
+	var once sync.Once
+	var failure error
+	stop := func(err error) {
+		once.Do(func() {
+			failure = err
+		})
+		stopIntake()
+	}
+	abort := func(err error) {
+		stop(err)
+		cancel()
+	}
+
+	config := p.pipeline.config
+
+	// previous hash of the block before, each block has to build on it
+	previous, err := p.parentHash(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	// window bounds the blocks in flight, the ordered stages never hold more than that back waiting for an earlier one
+	window := make(chan struct{}, config.QueueSize*4)
+
+	numbers := make(chan *batch, config.QueueSize)
+	go func() {
+		defer close(numbers)
+		for number := from; number <= to; number++ {
+			select {
+			case window <- struct{}{}:
+			case <-intake.Done():
+				return
+			}
+
+			select {
+			case numbers <- &batch{number: number}:
+			case <-intake.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	fetched := p.pipeline.fetch.run(ctx, &wg, numbers, config.QueueSize, p.fetchBlock, stop)
+	decoded := p.pipeline.decode.run(ctx, &wg, fetched, config.QueueSize, p.decodeBlock, stop)
+	matched := p.pipeline.match.run(ctx, &wg, decoded, config.QueueSize, p.matchBlock, stop)
+
+	ordered := p.pipeline.persist.inOrder(ctx, &wg, from, matched)
+	persisted := make(chan *batch, config.QueueSize)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(persisted)
+
+		for b := range ordered {
+			if b.refused == nil && p.chain.VerifyBlocks && previous != "" {
+				b.refused = p.followsParent(b.block, previous)
+			}
+			previous = b.block.Hash
+
+			if b.refused != nil {
+				// The cursor stays put, the block is fetched again on the next tick in case the node recovers
+				log.Printf("Refusing block %d of %v: %v", b.number, p.chain.Name, b.refused)
+				stopIntake()
+				return
+			}
+
+			if err := p.pipeline.persist.do(ctx, b, p.persistBlock); err != nil {
+				abort(err)
+				return
+			}
+
+			select {
+			case persisted <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	notified := p.pipeline.notify.run(ctx, &wg, persisted, config.QueueSize, p.notifyBlock, abort)
+
+	for b := range p.pipeline.commit.inOrder(ctx, &wg, from, notified) {
+		if err := p.pipeline.commit.do(ctx, b, p.commitBlock); err != nil {
+			abort(err)
+			break
+		}
+		<-window
+	}
+
+	cancel()
+	wg.Wait()
+
+	if failure == nil {
+		// Shutting down part way through
+		return parent.Err()
+	}
+
+	return failure
+}
+
+// parentHash the hash of the block before from, the one the cursor last moved past or what the node has at its height
+// after a restart. Empty when blocks are not verified.
+func (p ParserService) parentHash(ctx context.Context, from int64) (string, error) {
+	if !p.chain.VerifyBlocks || from <= 0 {
+		return "", nil
+	}
+
+	p.pipeline.mux.Lock()
+	committed, hash := p.pipeline.committed, p.pipeline.committedHash
+	p.pipeline.mux.Unlock()
+
+	if committed == from-1 && hash != "" {
+		return hash, nil
+	}
+
+	parent, err := p.client.GetBlockByNumber(ctx, from-1)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve block %d of %v: %w", from-1, p.chain.Name, err)
+	}
+
+	return parent.Hash, nil
+}
+
+// Metrics what each stage of the pipeline has been up to since start up, in the order blocks go through them
+func (p ParserService) Metrics() []StageMetrics {
+	return []StageMetrics{
+		p.pipeline.fetch.metrics(),
+		p.pipeline.decode.metrics(),
+		p.pipeline.match.metrics(),
+		p.pipeline.persist.metrics(),
+		p.pipeline.notify.metrics(),
+		p.pipeline.commit.metrics(),
+	}
+}
+
+func newPipeline(config PipelineConfig) *pipeline {
+	config = config.withDefaults(PipelineConfig{QueueSize: 1, FetchWorkers: 1, DecodeWorkers: 1, MatchWorkers: 1, NotifyWorkers: 1})
+
+	return &pipeline{
+		config:  config,
+		fetch:   &stage{name: "fetch", workers: config.FetchWorkers},
+		decode:  &stage{name: "decode", workers: config.DecodeWorkers},
+		match:   &stage{name: "match", workers: config.MatchWorkers},
+		persist: &stage{name: "persist", workers: 1},
+		notify:  &stage{name: "notify", workers: config.NotifyWorkers},
+		commit:  &stage{name: "commit", workers: 1},
+	}
+}
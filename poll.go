@@ -0,0 +1,87 @@
+package ethereum_parser
+
+import (
+	"sync"
+	"time"
+)
+
+// pollSchedule tunes how often a chain is polled to the time between its blocks. Right after a new block the parser
+// waits until the next one is due, polling faster once it is and backing off again while the node reports no change.
+// Without both bounds the poll interval stays fixed.
+type pollSchedule struct {
+	mux sync.Mutex
+
+	interval time.Duration
+	min      time.Duration
+	max      time.Duration
+
+	// blockTime moving average of the time between blocks, zero until the head moved once
+	blockTime time.Duration
+	head      int64
+	// seen when the head was first reported
+	seen time.Time
+	// misses polls in a row the head did not move
+	misses int
+}
+
+// observe the head reported by the node
+func (s *pollSchedule) observe(head int64, now time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	switch {
+	case s.seen.IsZero():
+		s.head, s.seen = head, now
+	case head <= s.head:
+		// A node behind a load balancer may well report an older head, that is no news either
+		s.misses++
+	default:
+		sample := now.Sub(s.seen) / time.Duration(head-s.head)
+		if s.blockTime == 0 {
+			s.blockTime = sample
+		} else {
+			s.blockTime = (3*s.blockTime + sample) / 4
+		}
+		s.head, s.seen, s.misses = head, now, 0
+	}
+}
+
+// next how long to wait before polling again
+func (s *pollSchedule) next(now time.Time) time.Duration {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.min <= 0 || s.max <= 0 || s.blockTime == 0 {
+		return s.interval
+	}
+
+	var wait time.Duration
+	if s.misses == 0 {
+		// Until the next block is due
+		wait = s.seen.Add(s.blockTime).Sub(now)
+	} else {
+		// Overdue, a few polls per block time doubling with every one that finds nothing new
+		wait = s.blockTime / 4
+		for i := 1; i < s.misses && wait < s.max; i++ {
+			wait *= 2
+		}
+	}
+
+	if wait < s.min {
+		return s.min
+	}
+
+	if wait > s.max {
+		return s.max
+	}
+
+	return wait
+}
+
+func newPollSchedule(chain ChainConfig) *pollSchedule {
+	return &pollSchedule{
+		interval: time.Duration(chain.PollInterval),
+		min:      time.Duration(chain.MinPollInterval),
+		max:      time.Duration(chain.MaxPollInterval),
+	}
+}
@@ -2,8 +2,14 @@ package ethereum_parser
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type InMemStorage struct {
@@ -11,109 +17,558 @@ type InMemStorage struct {
 
 	transactions      map[string][]Transaction
 	TransactionByHash map[string]Transaction
-	subscribers       map[string]bool
+	subscribers       map[string]Subscription
 
-	currentBlock int64
+	withdrawals       map[string][]Withdrawal
+	withdrawalByIndex map[string]Withdrawal
+	tokens            map[string]TokenMetadata
+	// balances by chain, address and asset
+	balances map[string]Balance
+	wallets  map[string]Wallet
+
+	// currentBlocks cursor of every chain
+	currentBlocks map[int64]int64
+}
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// TransactionQuery narrows down the transactions of an address
+type TransactionQuery struct {
+	Address string
+	// ChainID only transactions of this chain, zero means every chain
+	ChainID int64
+	// From and To inclusive range of block timestamps, zero leaves that side open
+	From time.Time
+	To   time.Time
+	// FromBlock and ToBlock inclusive range of block numbers, zero leaves that side open
+	FromBlock int64
+	ToBlock   int64
+	// Kinds only transactions classified as any of these, empty means every kind
+	Kinds []TransactionKind
+}
+
+// Validate makes sure the ranges are not upside down
+func (q TransactionQuery) Validate() error {
+	if !q.From.IsZero() && !q.To.IsZero() && q.From.After(q.To) {
+		return fmt.Errorf("%w: from has to be before to", ErrInvalidQuery)
+	}
+
+	if q.FromBlock < 0 || q.ToBlock < 0 {
+		return fmt.Errorf("%w: block numbers cannot be negative", ErrInvalidQuery)
+	}
+
+	if q.FromBlock != 0 && q.ToBlock != 0 && q.FromBlock > q.ToBlock {
+		return fmt.Errorf("%w: fromBlock has to be before toBlock", ErrInvalidQuery)
+	}
+
+	for _, kind := range q.Kinds {
+		switch kind {
+		case TransactionKindTransfer, TransactionKindContractCall, TransactionKindContractDeployment, TransactionKindTokenTransfer:
+		default:
+			return fmt.Errorf("%w: unknown kind %v", ErrInvalidQuery, kind)
+		}
+	}
+
+	return nil
+}
+
+// Matches whether a transaction of the address satisfies the rest of the query
+func (q TransactionQuery) Matches(transaction Transaction) bool {
+	if len(q.Kinds) > 0 && !q.matchesKind(transaction.Kind) {
+		return false
+	}
+
+	return q.matches(transaction.ChainID, transaction.BlockNumber, transaction.Time())
+}
+
+func (q TransactionQuery) matchesKind(kind TransactionKind) bool {
+	for _, candidate := range q.Kinds {
+		if candidate == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchesWithdrawal whether a withdrawal of the address satisfies the rest of the query
+func (q TransactionQuery) MatchesWithdrawal(withdrawal Withdrawal) bool {
+	return q.matches(withdrawal.ChainID, withdrawal.BlockNumber, withdrawal.Time())
+}
+
+// matches anything stored without a block number or time falls outside of any range asking for one
+func (q TransactionQuery) matches(chainID string, blockNumber string, timestamp time.Time) bool {
+	if q.ChainID != 0 && chainID != quantity(q.ChainID) {
+		return false
+	}
+
+	if q.FromBlock != 0 || q.ToBlock != 0 {
+		if blockNumber == "" {
+			return false
+		}
+
+		number, err := hexDecoder(blockNumber)
+		if err != nil {
+			return false
+		}
+
+		if number < q.FromBlock || (q.ToBlock != 0 && number > q.ToBlock) {
+			return false
+		}
+	}
+
+	if !q.From.IsZero() || !q.To.IsZero() {
+		if timestamp.IsZero() {
+			return false
+		}
+
+		if timestamp.Before(q.From) || (!q.To.IsZero() && timestamp.After(q.To)) {
+			return false
+		}
+	}
+
+	return true
 }
 
-func (s *InMemStorage) GetCurrentBlock(_ context.Context) (int64, error) {
+func (s *InMemStorage) GetCurrentBlock(ctx context.Context, chainID int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	return s.currentBlock, nil
+	return s.currentBlocks[chainID], nil
 }
 
-func (s *InMemStorage) SetCurrentBlock(_ context.Context, currentBlock int64) error {
+func (s *InMemStorage) SetCurrentBlock(ctx context.Context, chainID int64, currentBlock int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	s.currentBlock = currentBlock
+	s.currentBlocks[chainID] = currentBlock
 
 	return nil
 }
 
-func (s *InMemStorage) GetTransactions(_ context.Context, address string) ([]Transaction, error) {
+func (s *InMemStorage) GetTransactions(ctx context.Context, query TransactionQuery) ([]Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	return s.transactions[address], nil
+	var transactions []Transaction
+	for _, transaction := range s.transactions[strings.ToLower(query.Address)] {
+		if query.Matches(transaction) {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return blockOrder(transactions[i].BlockNumber) < blockOrder(transactions[j].BlockNumber)
+	})
+
+	return transactions, nil
 }
 
-func (s *InMemStorage) GetTransactionByHash(_ context.Context, hash string) (Transaction, error) {
+func (s *InMemStorage) GetTransactionByHash(ctx context.Context, chainID int64, hash string) (Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return Transaction{}, err
+	}
+
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	if _, ok := s.TransactionByHash[hash]; ok {
-		return s.TransactionByHash[hash], nil
+	key := transactionKey(quantity(chainID), hash)
+	if _, ok := s.TransactionByHash[key]; ok {
+		return s.TransactionByHash[key], nil
 	}
 
 	return Transaction{}, nil
 }
 
-func (s *InMemStorage) AddTransaction(_ context.Context, transaction Transaction) error {
+func (s *InMemStorage) AddTransaction(ctx context.Context, transaction Transaction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	key := transactionKey(transaction.ChainID, transaction.Hash)
+	_, replacing := s.TransactionByHash[key]
+	s.TransactionByHash[key] = transaction
+
+	// Indexing under every address that took part, token recipients are not necessarily the To of the transaction
+	indexed := make(map[string]bool)
+	for _, transfer := range transaction.Transfers() {
+		for _, address := range []string{transfer.From, transfer.To} {
+			address = strings.ToLower(address)
+			if indexed[address] {
+				continue
+			}
+			indexed[address] = true
+
+			if replacing && s.replaceTransaction(address, transaction) {
+				continue
+			}
+			s.transactions[address] = append(s.transactions[address], transaction)
+		}
+	}
+
+	return nil
+}
+
+// replaceTransaction swaps the stored transaction of the address for its new version, false when the address does not have it
+func (s *InMemStorage) replaceTransaction(address string, transaction Transaction) bool {
+	key := transactionKey(transaction.ChainID, transaction.Hash)
+	for i, stored := range s.transactions[address] {
+		if transactionKey(stored.ChainID, stored.Hash) == key {
+			s.transactions[address][i] = transaction
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *InMemStorage) GetWithdrawals(ctx context.Context, query TransactionQuery) ([]Withdrawal, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var withdrawals []Withdrawal
+	for _, withdrawal := range s.withdrawals[strings.ToLower(query.Address)] {
+		if query.MatchesWithdrawal(withdrawal) {
+			withdrawals = append(withdrawals, withdrawal)
+		}
+	}
+
+	sort.SliceStable(withdrawals, func(i, j int) bool {
+		return blockOrder(withdrawals[i].BlockNumber) < blockOrder(withdrawals[j].BlockNumber)
+	})
+
+	return withdrawals, nil
+}
+
+func (s *InMemStorage) GetWithdrawal(ctx context.Context, chainID int64, index string) (Withdrawal, error) {
+	if err := ctx.Err(); err != nil {
+		return Withdrawal{}, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.withdrawalByIndex[transactionKey(quantity(chainID), index)], nil
+}
+
+func (s *InMemStorage) AddWithdrawal(ctx context.Context, withdrawal Withdrawal) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	s.TransactionByHash[transaction.Hash] = transaction
-	s.transactions[transaction.From] = append(s.transactions[transaction.From], transaction)
-	s.transactions[transaction.To] = append(s.transactions[transaction.To], transaction)
+	key := transactionKey(withdrawal.ChainID, withdrawal.Index)
+	if _, ok := s.withdrawalByIndex[key]; ok {
+		return nil
+	}
+
+	s.withdrawalByIndex[key] = withdrawal
+	address := strings.ToLower(withdrawal.Address)
+	s.withdrawals[address] = append(s.withdrawals[address], withdrawal)
 
 	return nil
 }
 
-func (s *InMemStorage) Subscribe(_ context.Context, address string) error {
+func (s *InMemStorage) GetTokenMetadata(ctx context.Context, chainID int64, token string) (TokenMetadata, error) {
+	if err := ctx.Err(); err != nil {
+		return TokenMetadata{}, err
+	}
+
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	if _, ok := s.subscribers[address]; !ok {
-		s.subscribers[address] = true
-	} else {
-		// Not really an error perhaps could log a message, or we might not even care and just say nothing
-		log.Printf("%v is already subscribed", address)
+	return s.tokens[transactionKey(quantity(chainID), strings.ToLower(token))], nil
+}
+
+func (s *InMemStorage) AddTokenMetadata(ctx context.Context, metadata TokenMetadata) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.tokens[transactionKey(metadata.ChainID, strings.ToLower(metadata.Token))] = metadata
+
 	return nil
 }
 
-func (s *InMemStorage) GetSubscribers(ctx context.Context) ([]string, error) {
+func (s *InMemStorage) GetBalances(ctx context.Context, chainID int64, address string) ([]Balance, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	var subscribers []string
-	for sub, _ := range s.subscribers {
+	var balances []Balance
+	for _, balance := range s.balances {
+		if chainID != 0 && balance.ChainID != quantity(chainID) {
+			continue
+		}
+
+		if address != "" && !strings.EqualFold(balance.Address, address) {
+			continue
+		}
+
+		balances = append(balances, balance)
+	}
+
+	// Map order is random, keeping the response stable
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].ChainID != balances[j].ChainID {
+			return balances[i].ChainID < balances[j].ChainID
+		}
+		if balances[i].Address != balances[j].Address {
+			return balances[i].Address < balances[j].Address
+		}
+		return balances[i].Asset < balances[j].Asset
+	})
+
+	return balances, nil
+}
+
+func (s *InMemStorage) GetBalance(ctx context.Context, chainID int64, address string, asset string) (Balance, error) {
+	if err := ctx.Err(); err != nil {
+		return Balance{}, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.balances[balanceKey(quantity(chainID), address, asset)], nil
+}
+
+func (s *InMemStorage) SetBalance(ctx context.Context, balance Balance) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.balances[balanceKey(balance.ChainID, balance.Address, balance.Asset)] = balance
+
+	return nil
+}
+
+func (s *InMemStorage) GetWallet(ctx context.Context, id string) (Wallet, error) {
+	if err := ctx.Err(); err != nil {
+		return Wallet{}, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.wallets[id], nil
+}
+
+func (s *InMemStorage) SetWallet(ctx context.Context, wallet Wallet) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.wallets[wallet.ID] = wallet
+
+	return nil
+}
+
+func (s *InMemStorage) Subscribe(ctx context.Context, subscription Subscription) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	address := strings.ToLower(subscription.Address)
+	if _, ok := s.subscribers[address]; ok {
+		// Not really an error, subscribing again simply replaces the options
+		log.Printf("%v is already subscribed, updating options", subscription.Address)
+	}
+
+	s.subscribers[address] = subscription
+
+	return nil
+}
+
+func (s *InMemStorage) Unsubscribe(ctx context.Context, address string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.subscribers, strings.ToLower(address))
+
+	return nil
+}
+
+func (s *InMemStorage) MoveSubscription(ctx context.Context, from string, subscription Subscription) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	from = strings.ToLower(from)
+	if stored, ok := s.subscribers[from]; !ok || stored.Name != subscription.Name {
+		// Unsubscribed or subscribed again in the meantime, the subscription is no longer the name's to move
+		return false, nil
+	}
+
+	to := strings.ToLower(subscription.Address)
+	if stored, ok := s.subscribers[to]; !ok || stored.Name == subscription.Name {
+		s.subscribers[to] = subscription
+	}
+	if to != from {
+		delete(s.subscribers, from)
+	}
+
+	return true, nil
+}
+
+func (s *InMemStorage) GetSubscribers(ctx context.Context) ([]Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var subscribers []Subscription
+	for _, sub := range s.subscribers {
 		subscribers = append(subscribers, sub)
 	}
 
+	// Map order is random, keeping the response stable
+	sort.Slice(subscribers, func(i, j int) bool {
+		return strings.ToLower(subscribers[i].Address) < strings.ToLower(subscribers[j].Address)
+	})
+
 	return subscribers, nil
 }
 
+// transactionKey the same hash can show up on several chains
+func transactionKey(chainID string, hash string) string {
+	return chainID + ":" + strings.ToLower(hash)
+}
+
+// blockOrder the number of a block to sort by, anything stored without one comes first
+func blockOrder(number string) int64 {
+	value, err := strconv.ParseInt(number, 0, 64)
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+func balanceKey(chainID string, address string, asset string) string {
+	return chainID + ":" + strings.ToLower(address) + ":" + asset
+}
+
 func NewMemStorage() InMemStorage {
 	return InMemStorage{
 		transactions:      make(map[string][]Transaction),
 		TransactionByHash: make(map[string]Transaction),
-		subscribers:       make(map[string]bool),
+		subscribers:       make(map[string]Subscription),
+		withdrawals:       make(map[string][]Withdrawal),
+		withdrawalByIndex: make(map[string]Withdrawal),
+		tokens:            make(map[string]TokenMetadata),
+		balances:          make(map[string]Balance),
+		wallets:           make(map[string]Wallet),
+		currentBlocks:     make(map[int64]int64),
 	}
 }
 
+// Repository stores what the parser found, every call fails with the error of the context once it is done.
+// repositorytest.Run checks an implementation lives up to the comments below.
 type Repository interface {
-	// GetCurrentBlock retrieving current block from locally, if it's missing it goes and fetches it from ethereum ethClient
-	GetCurrentBlock(ctx context.Context) (int64, error)
+	// GetCurrentBlock retrieving the cursor of a chain locally, zero when the chain has not been parsed yet
+	GetCurrentBlock(ctx context.Context, chainID int64) (int64, error)
+
+	// SetCurrentBlock responsible for setting the cursor of a chain locally
+	SetCurrentBlock(ctx context.Context, chainID int64, currentBlock int64) error
 
-	// SetCurrentBlock responsible for setting the current block locally
-	SetCurrentBlock(ctx context.Context, currentBlock int64) error
+	// Subscribe subscribes an address together with its notification options, subscribing again replaces the options.
+	// Addresses are case insensitive.
+	Subscribe(ctx context.Context, subscription Subscription) error
 
-	// Subscribe subscribes an address
-	Subscribe(ctx context.Context, address string) error
+	// Unsubscribe removes the subscription of an address, removing a missing one is a no-op
+	Unsubscribe(ctx context.Context, address string) error
 
-	// GetSubscribers retrieves all subscribed addressed
-	GetSubscribers(ctx context.Context) ([]string, error)
+	// MoveSubscription moves the subscription of an ens name from the address it resolved to before to the one in the
+	// subscription, in one go. Nothing moves unless the subscription at from still belongs to the name, a subscription
+	// of its own already at the new address is kept.
+	MoveSubscription(ctx context.Context, from string, subscription Subscription) (bool, error)
 
-	// GetTransactions retrieves all parsed transactions from repo
-	GetTransactions(ctx context.Context, address string) ([]Transaction, error)
+	// GetSubscribers retrieves all subscriptions ordered by address
+	GetSubscribers(ctx context.Context) ([]Subscription, error)
 
-	// AddTransaction responsible for inserting a single transaction in repo
+	// GetTransactions retrieves the parsed transactions of an address matching the query from repo, ordered by block and
+	// by the order they were added within a block
+	GetTransactions(ctx context.Context, query TransactionQuery) ([]Transaction, error)
+
+	// AddTransaction responsible for inserting a single transaction in repo, adding it again replaces it
 	AddTransaction(ctx context.Context, transaction Transaction) error
 
-	// GetTransactionByHash retrieves transaction data for given hash
-	GetTransactionByHash(_ context.Context, hash string) (Transaction, error)
+	// GetTransactionByHash retrieves transaction data for given hash on a chain, a missing one is returned empty
+	GetTransactionByHash(_ context.Context, chainID int64, hash string) (Transaction, error)
+
+	// GetWithdrawals retrieves the beacon chain withdrawals credited to an address matching the query, ordered by block
+	GetWithdrawals(ctx context.Context, query TransactionQuery) ([]Withdrawal, error)
+
+	// GetWithdrawal retrieves a withdrawal by its index on a chain, a missing one is returned empty
+	GetWithdrawal(ctx context.Context, chainID int64, index string) (Withdrawal, error)
+
+	// AddWithdrawal inserts a single withdrawal, adding the same withdrawal again is a no-op
+	AddWithdrawal(ctx context.Context, withdrawal Withdrawal) error
+
+	// GetTokenMetadata retrieves the metadata of a token on a chain, empty when the token has not been resolved yet
+	GetTokenMetadata(ctx context.Context, chainID int64, token string) (TokenMetadata, error)
+
+	// AddTokenMetadata stores the metadata of a token, replacing what was there
+	AddTokenMetadata(ctx context.Context, metadata TokenMetadata) error
+
+	// GetBalances retrieves the tracked balances, zero chain id and empty address mean every chain and address
+	GetBalances(ctx context.Context, chainID int64, address string) ([]Balance, error)
+
+	// GetBalance retrieves the balance of an asset held by an address, empty when it is not tracked
+	GetBalance(ctx context.Context, chainID int64, address string, asset string) (Balance, error)
+
+	// SetBalance stores a balance, replacing what was there
+	SetBalance(ctx context.Context, balance Balance) error
+
+	// GetWallet retrieves a wallet by its id, empty when there is none
+	GetWallet(ctx context.Context, id string) (Wallet, error)
+
+	// SetWallet stores a wallet together with its derived addresses, replacing what was there
+	SetWallet(ctx context.Context, wallet Wallet) error
 }
@@ -0,0 +1,72 @@
+package ethereum_parser_test
+
+import (
+	"context"
+	eth "ethereum_parser"
+	"ethereum_parser/repositorytest"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestInMemStorage_GetTransactionsInRange(t *testing.T) {
+	ctx := context.Background()
+	storage := eth.NewMemStorage()
+
+	// 0x65e12800 is 2024-03-01T00:00:00Z, every block is a day apart
+	kinds := []eth.TransactionKind{eth.TransactionKindTransfer, eth.TransactionKindContractCall, eth.TransactionKindTokenTransfer}
+	for i, hash := range []string{"0x01", "0x02", "0x03"} {
+		require.NoError(t, storage.AddTransaction(ctx, eth.Transaction{
+			BlockNumber: fmt.Sprintf("0x%x", 100+i),
+			Hash:        hash,
+			From:        address,
+			To:          "0x00000000219ab540356cbb839cbe05303d7705fa",
+			Value:       "0x1",
+			ChainID:     "0x1",
+			Kind:        kinds[i],
+			Block:       &eth.BlockHeader{Timestamp: fmt.Sprintf("0x%x", 0x65e12800+i*86400)},
+		}))
+	}
+
+	tt := []struct {
+		name     string
+		query    eth.TransactionQuery
+		expected []string
+	}{
+		{name: "everything", query: eth.TransactionQuery{}, expected: []string{"0x01", "0x02", "0x03"}},
+		{name: "from", query: eth.TransactionQuery{From: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)}, expected: []string{"0x02", "0x03"}},
+		{name: "to", query: eth.TransactionQuery{To: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}, expected: []string{"0x01"}},
+		{name: "blocks", query: eth.TransactionQuery{FromBlock: 101, ToBlock: 101}, expected: []string{"0x02"}},
+		{name: "kinds", query: eth.TransactionQuery{Kinds: []eth.TransactionKind{eth.TransactionKindContractCall, eth.TransactionKindTokenTransfer}}, expected: []string{"0x02", "0x03"}},
+		{name: "other chain", query: eth.TransactionQuery{ChainID: 137}, expected: nil},
+	}
+
+	for _, testCase := range tt {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.query.Address = address
+			transactions, err := storage.GetTransactions(ctx, testCase.query)
+			require.NoError(t, err)
+
+			var hashes []string
+			for _, transaction := range transactions {
+				hashes = append(hashes, transaction.Hash)
+			}
+			assert.Equal(t, testCase.expected, hashes)
+		})
+	}
+
+	err := eth.TransactionQuery{FromBlock: 2, ToBlock: 1}.Validate()
+	assert.ErrorIs(t, err, eth.ErrInvalidQuery)
+
+	err = eth.TransactionQuery{Kinds: []eth.TransactionKind{"swap"}}.Validate()
+	assert.ErrorIs(t, err, eth.ErrInvalidQuery)
+}
+
+func TestInMemStorage_Conformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) eth.Repository {
+		storage := eth.NewMemStorage()
+		return &storage
+	})
+}
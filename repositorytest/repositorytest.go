@@ -0,0 +1,441 @@
+// Package repositorytest checks a Repository implementation against the contract documented on the interface, so a new
+// storage backend only needs to be handed to Run from its own tests.
+package repositorytest
+
+import (
+	"context"
+	"ethereum_parser"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Run runs the conformance suite, every test gets a new empty repository from newRepository
+func Run(t *testing.T, newRepository func(t *testing.T) ethereum_parser.Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo ethereum_parser.Repository)
+	}{
+		{name: "cursor", test: testCursor},
+		{name: "subscribers", test: testSubscribers},
+		{name: "transaction by hash", test: testTransactionByHash},
+		{name: "transactions by address", test: testTransactionsByAddress},
+		{name: "transaction ordering", test: testTransactionOrdering},
+		{name: "withdrawals", test: testWithdrawals},
+		{name: "token metadata", test: testTokenMetadata},
+		{name: "balances", test: testBalances},
+		{name: "wallets", test: testWallets},
+		{name: "concurrent access", test: testConcurrentAccess},
+		{name: "context cancellation", test: testContextCancellation},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newRepository(t))
+		})
+	}
+}
+
+func testCursor(t *testing.T, repo ethereum_parser.Repository) {
+	ctx := context.Background()
+
+	cursor, err := repo.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), cursor, "a chain that has not been parsed yet")
+
+	require.NoError(t, repo.SetCurrentBlock(ctx, 1, 100))
+	require.NoError(t, repo.SetCurrentBlock(ctx, 137, 5))
+
+	cursor, err = repo.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), cursor)
+
+	cursor, err = repo.GetCurrentBlock(ctx, 137)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), cursor, "every chain has its own cursor")
+
+	// Rewinding is allowed, a reorg takes the cursor back
+	require.NoError(t, repo.SetCurrentBlock(ctx, 1, 98))
+	cursor, err = repo.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(98), cursor)
+}
+
+func testSubscribers(t *testing.T, repo ethereum_parser.Repository) {
+	ctx := context.Background()
+
+	subs, err := repo.GetSubscribers(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, subs)
+
+	require.NoError(t, repo.Subscribe(ctx, ethereum_parser.Subscription{Address: bob}))
+	require.NoError(t, repo.Subscribe(ctx, ethereum_parser.Subscription{Address: alice}))
+	require.NoError(t, repo.Subscribe(ctx, ethereum_parser.Subscription{
+		Address: alice,
+		Options: ethereum_parser.SubscriptionOptions{Direction: ethereum_parser.DirectionIncoming},
+	}))
+
+	subs, err = repo.GetSubscribers(ctx)
+	require.NoError(t, err)
+	require.Len(t, subs, 2, "subscribing again does not add a subscription")
+	assert.Equal(t, alice, subs[0].Address, "ordered by address")
+	assert.Equal(t, ethereum_parser.DirectionIncoming, subs[0].Options.Direction, "subscribing again replaces the options")
+	assert.Equal(t, bob, subs[1].Address)
+
+	require.NoError(t, repo.Unsubscribe(ctx, upper(bob)))
+	require.NoError(t, repo.Unsubscribe(ctx, carol), "unsubscribing a missing address is a no-op")
+
+	subs, err = repo.GetSubscribers(ctx)
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+	assert.Equal(t, alice, subs[0].Address)
+
+	// Moving the subscription of an ens name
+	require.NoError(t, repo.Subscribe(ctx, ethereum_parser.Subscription{Address: bob, Name: "bob.eth"}))
+	moved, err := repo.MoveSubscription(ctx, upper(bob), ethereum_parser.Subscription{Address: carol, Name: "bob.eth"})
+	require.NoError(t, err)
+	assert.True(t, moved)
+
+	moved, err = repo.MoveSubscription(ctx, alice, ethereum_parser.Subscription{Address: dave, Name: "alice.eth"})
+	require.NoError(t, err)
+	assert.False(t, moved, "a subscription not of the name stays put")
+
+	moved, err = repo.MoveSubscription(ctx, bob, ethereum_parser.Subscription{Address: dave, Name: "bob.eth"})
+	require.NoError(t, err)
+	assert.False(t, moved, "a subscription that already moved does not move again")
+
+	moved, err = repo.MoveSubscription(ctx, carol, ethereum_parser.Subscription{Address: alice, Name: "bob.eth"})
+	require.NoError(t, err)
+	assert.True(t, moved)
+
+	subs, err = repo.GetSubscribers(ctx)
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+	assert.Equal(t, alice, subs[0].Address)
+	assert.Empty(t, subs[0].Name, "a subscription already at the new address is kept")
+	assert.Equal(t, ethereum_parser.DirectionIncoming, subs[0].Options.Direction)
+}
+
+func testTransactionByHash(t *testing.T, repo ethereum_parser.Repository) {
+	ctx := context.Background()
+
+	transaction, err := repo.GetTransactionByHash(ctx, 1, hash(1))
+	require.NoError(t, err)
+	assert.Empty(t, transaction.Hash, "a missing transaction is returned empty")
+
+	require.NoError(t, repo.AddTransaction(ctx, newTransaction(1, 100, alice, bob)))
+
+	transaction, err = repo.GetTransactionByHash(ctx, 1, hash(1))
+	require.NoError(t, err)
+	assert.Equal(t, hash(1), transaction.Hash)
+	assert.Equal(t, alice, transaction.From)
+
+	transaction, err = repo.GetTransactionByHash(ctx, 1, upper(hash(1)))
+	require.NoError(t, err)
+	assert.Equal(t, hash(1), transaction.Hash, "hashes are case insensitive")
+
+	transaction, err = repo.GetTransactionByHash(ctx, 137, hash(1))
+	require.NoError(t, err)
+	assert.Empty(t, transaction.Hash, "a hash is only found on its own chain")
+
+	// Adding again replaces, such as a transaction found again with its receipt
+	updated := newTransaction(1, 100, alice, bob)
+	updated.Status = "0x0"
+	require.NoError(t, repo.AddTransaction(ctx, updated))
+
+	transaction, err = repo.GetTransactionByHash(ctx, 1, hash(1))
+	require.NoError(t, err)
+	assert.Equal(t, "0x0", transaction.Status)
+
+	transactions, err := repo.GetTransactions(ctx, ethereum_parser.TransactionQuery{Address: alice})
+	require.NoError(t, err)
+	require.Len(t, transactions, 1, "adding again does not list the transaction twice")
+	assert.Equal(t, "0x0", transactions[0].Status)
+}
+
+func testTransactionsByAddress(t *testing.T, repo ethereum_parser.Repository) {
+	ctx := context.Background()
+
+	sent := newTransaction(1, 100, alice, bob)
+	tokens := newTransaction(2, 101, alice, token)
+	tokens.TokenTransfers = []ethereum_parser.TokenTransfer{{Token: token, From: alice, To: carol, Value: "0x1"}}
+	self := newTransaction(3, 102, bob, bob)
+	polygon := newTransaction(4, 50, carol, alice)
+	polygon.ChainID = "0x89"
+
+	for _, transaction := range []ethereum_parser.Transaction{sent, tokens, self, polygon} {
+		require.NoError(t, repo.AddTransaction(ctx, transaction))
+	}
+
+	tt := []struct {
+		name     string
+		query    ethereum_parser.TransactionQuery
+		expected []string
+	}{
+		{name: "sender and recipient", query: ethereum_parser.TransactionQuery{Address: alice}, expected: []string{hash(4), hash(1), hash(2)}},
+		{name: "case insensitive", query: ethereum_parser.TransactionQuery{Address: upper(alice)}, expected: []string{hash(4), hash(1), hash(2)}},
+		{name: "token recipient", query: ethereum_parser.TransactionQuery{Address: carol}, expected: []string{hash(4), hash(2)}},
+		{name: "sent to itself once", query: ethereum_parser.TransactionQuery{Address: bob}, expected: []string{hash(1), hash(3)}},
+		{name: "single chain", query: ethereum_parser.TransactionQuery{Address: alice, ChainID: 1}, expected: []string{hash(1), hash(2)}},
+		{name: "block range", query: ethereum_parser.TransactionQuery{Address: alice, FromBlock: 100, ToBlock: 100}, expected: []string{hash(1)}},
+		{name: "unknown address", query: ethereum_parser.TransactionQuery{Address: dave}, expected: nil},
+	}
+
+	for _, testCase := range tt {
+		t.Run(testCase.name, func(t *testing.T) {
+			transactions, err := repo.GetTransactions(ctx, testCase.query)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, hashes(transactions))
+		})
+	}
+}
+
+func testTransactionOrdering(t *testing.T, repo ethereum_parser.Repository) {
+	ctx := context.Background()
+
+	// Added out of block order, as a wallet backfill or a replay might
+	for i, block := range []int64{0x66, 0x64, 0x65, 0x64, 0x1000} {
+		require.NoError(t, repo.AddTransaction(ctx, newTransaction(i+1, block, alice, bob)))
+	}
+
+	transactions, err := repo.GetTransactions(ctx, ethereum_parser.TransactionQuery{Address: alice})
+	require.NoError(t, err)
+	assert.Equal(t, []string{hash(2), hash(4), hash(3), hash(1), hash(5)}, hashes(transactions), "by block, then as added")
+}
+
+func testWithdrawals(t *testing.T, repo ethereum_parser.Repository) {
+	ctx := context.Background()
+
+	withdrawal, err := repo.GetWithdrawal(ctx, 1, "0x1")
+	require.NoError(t, err)
+	assert.Empty(t, withdrawal.Index, "a missing withdrawal is returned empty")
+
+	for i, block := range []int64{0x65, 0x64} {
+		require.NoError(t, repo.AddWithdrawal(ctx, ethereum_parser.Withdrawal{
+			Index:          fmt.Sprintf("0x%x", i+1),
+			ValidatorIndex: "0x10",
+			Address:        alice,
+			Amount:         "0x1",
+			BlockNumber:    fmt.Sprintf("0x%x", block),
+			ChainID:        "0x1",
+		}))
+	}
+
+	// Adding the same withdrawal again is a no-op
+	require.NoError(t, repo.AddWithdrawal(ctx, ethereum_parser.Withdrawal{Index: "0x1", Address: alice, Amount: "0x2", BlockNumber: "0x65", ChainID: "0x1"}))
+
+	withdrawal, err = repo.GetWithdrawal(ctx, 1, "0x1")
+	require.NoError(t, err)
+	assert.Equal(t, "0x1", withdrawal.Amount)
+
+	withdrawal, err = repo.GetWithdrawal(ctx, 137, "0x1")
+	require.NoError(t, err)
+	assert.Empty(t, withdrawal.Index, "an index is only found on its own chain")
+
+	withdrawals, err := repo.GetWithdrawals(ctx, ethereum_parser.TransactionQuery{Address: upper(alice)})
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 2)
+	assert.Equal(t, "0x2", withdrawals[0].Index, "ordered by block")
+	assert.Equal(t, "0x1", withdrawals[1].Index)
+}
+
+func testTokenMetadata(t *testing.T, repo ethereum_parser.Repository) {
+	ctx := context.Background()
+
+	metadata, err := repo.GetTokenMetadata(ctx, 1, token)
+	require.NoError(t, err)
+	assert.Empty(t, metadata.Token, "a token that has not been resolved yet")
+
+	require.NoError(t, repo.AddTokenMetadata(ctx, ethereum_parser.TokenMetadata{Token: token, ChainID: "0x1", Symbol: "USDT", Decimals: 6}))
+	require.NoError(t, repo.AddTokenMetadata(ctx, ethereum_parser.TokenMetadata{Token: token, ChainID: "0x1", Symbol: "USDT", Decimals: 18}))
+
+	metadata, err = repo.GetTokenMetadata(ctx, 1, upper(token))
+	require.NoError(t, err)
+	assert.Equal(t, 18, metadata.Decimals, "adding again replaces")
+
+	metadata, err = repo.GetTokenMetadata(ctx, 137, token)
+	require.NoError(t, err)
+	assert.Empty(t, metadata.Token, "metadata is per chain")
+}
+
+func testBalances(t *testing.T, repo ethereum_parser.Repository) {
+	ctx := context.Background()
+
+	balance, err := repo.GetBalance(ctx, 1, alice, ethereum_parser.AssetETH)
+	require.NoError(t, err)
+	assert.Empty(t, balance.Address, "a balance that is not tracked")
+
+	require.NoError(t, repo.SetBalance(ctx, ethereum_parser.Balance{Address: alice, ChainID: "0x1", Asset: ethereum_parser.AssetETH, Balance: "0x1"}))
+	require.NoError(t, repo.SetBalance(ctx, ethereum_parser.Balance{Address: alice, ChainID: "0x1", Asset: ethereum_parser.AssetETH, Balance: "0x2"}))
+	require.NoError(t, repo.SetBalance(ctx, ethereum_parser.Balance{Address: alice, ChainID: "0x1", Asset: token, Balance: "0x3"}))
+	require.NoError(t, repo.SetBalance(ctx, ethereum_parser.Balance{Address: bob, ChainID: "0x89", Asset: ethereum_parser.AssetETH, Balance: "0x4"}))
+
+	balance, err = repo.GetBalance(ctx, 1, upper(alice), ethereum_parser.AssetETH)
+	require.NoError(t, err)
+	assert.Equal(t, "0x2", balance.Balance, "setting again replaces")
+
+	balances, err := repo.GetBalances(ctx, 1, alice)
+	require.NoError(t, err)
+	assert.Len(t, balances, 2)
+
+	balances, err = repo.GetBalances(ctx, 0, "")
+	require.NoError(t, err)
+	assert.Len(t, balances, 3, "every chain and address")
+
+	balances, err = repo.GetBalances(ctx, 137, "")
+	require.NoError(t, err)
+	require.Len(t, balances, 1)
+	assert.Equal(t, bob, balances[0].Address)
+}
+
+func testWallets(t *testing.T, repo ethereum_parser.Repository) {
+	ctx := context.Background()
+
+	wallet, err := repo.GetWallet(ctx, "0102030405060708")
+	require.NoError(t, err)
+	assert.Empty(t, wallet.ID, "a missing wallet is returned empty")
+
+	require.NoError(t, repo.SetWallet(ctx, ethereum_parser.Wallet{ID: "0102030405060708", GapLimit: 1, Addresses: []ethereum_parser.WalletAddress{{Index: 0, Address: alice}}}))
+	require.NoError(t, repo.SetWallet(ctx, ethereum_parser.Wallet{ID: "0102030405060708", GapLimit: 1, Addresses: []ethereum_parser.WalletAddress{
+		{Index: 0, Address: alice, Used: true},
+		{Index: 1, Address: bob},
+	}}))
+
+	wallet, err = repo.GetWallet(ctx, "0102030405060708")
+	require.NoError(t, err)
+	require.Len(t, wallet.Addresses, 2, "setting again replaces")
+	assert.True(t, wallet.Addresses[0].Used)
+}
+
+// testConcurrentAccess parsers of several chains and the API share the repository, nothing may get lost in between
+func testConcurrentAccess(t *testing.T, repo ethereum_parser.Repository) {
+	ctx := context.Background()
+	const workers = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*5)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			errs <- repo.Subscribe(ctx, ethereum_parser.Subscription{Address: fmt.Sprintf("0x%040x", i)})
+			errs <- repo.AddTransaction(ctx, newTransaction(i+1, int64(i), alice, bob))
+			errs <- repo.SetCurrentBlock(ctx, int64(i%2+1), int64(i))
+			_, err := repo.GetTransactions(ctx, ethereum_parser.TransactionQuery{Address: alice})
+			errs <- err
+			_, err = repo.GetSubscribers(ctx)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	subs, err := repo.GetSubscribers(ctx)
+	require.NoError(t, err)
+	assert.Len(t, subs, workers)
+
+	transactions, err := repo.GetTransactions(ctx, ethereum_parser.TransactionQuery{Address: bob})
+	require.NoError(t, err)
+	assert.Len(t, transactions, workers)
+}
+
+func testContextCancellation(t *testing.T, repo ethereum_parser.Repository) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := map[string]func() error{
+		"GetCurrentBlock": func() error { _, err := repo.GetCurrentBlock(ctx, 1); return err },
+		"SetCurrentBlock": func() error { return repo.SetCurrentBlock(ctx, 1, 1) },
+		"Subscribe":       func() error { return repo.Subscribe(ctx, ethereum_parser.Subscription{Address: alice}) },
+		"Unsubscribe":     func() error { return repo.Unsubscribe(ctx, alice) },
+		"MoveSubscription": func() error {
+			_, err := repo.MoveSubscription(ctx, alice, ethereum_parser.Subscription{Address: bob})
+			return err
+		},
+		"GetSubscribers": func() error { _, err := repo.GetSubscribers(ctx); return err },
+		"GetTransactions": func() error {
+			_, err := repo.GetTransactions(ctx, ethereum_parser.TransactionQuery{Address: alice})
+			return err
+		},
+		"AddTransaction":       func() error { return repo.AddTransaction(ctx, newTransaction(1, 1, alice, bob)) },
+		"GetTransactionByHash": func() error { _, err := repo.GetTransactionByHash(ctx, 1, hash(1)); return err },
+		"GetWithdrawals": func() error {
+			_, err := repo.GetWithdrawals(ctx, ethereum_parser.TransactionQuery{Address: alice})
+			return err
+		},
+		"GetWithdrawal":    func() error { _, err := repo.GetWithdrawal(ctx, 1, "0x1"); return err },
+		"AddWithdrawal":    func() error { return repo.AddWithdrawal(ctx, ethereum_parser.Withdrawal{Index: "0x1", Address: alice}) },
+		"GetTokenMetadata": func() error { _, err := repo.GetTokenMetadata(ctx, 1, token); return err },
+		"AddTokenMetadata": func() error {
+			return repo.AddTokenMetadata(ctx, ethereum_parser.TokenMetadata{Token: token, ChainID: "0x1"})
+		},
+		"GetBalances": func() error { _, err := repo.GetBalances(ctx, 1, alice); return err },
+		"GetBalance":  func() error { _, err := repo.GetBalance(ctx, 1, alice, ethereum_parser.AssetETH); return err },
+		"SetBalance":  func() error { return repo.SetBalance(ctx, ethereum_parser.Balance{Address: alice, ChainID: "0x1"}) },
+		"GetWallet":   func() error { _, err := repo.GetWallet(ctx, "0102030405060708"); return err },
+		"SetWallet":   func() error { return repo.SetWallet(ctx, ethereum_parser.Wallet{ID: "0102030405060708"}) },
+	}
+
+	for name, call := range calls {
+		assert.ErrorIs(t, call(), context.Canceled, name)
+	}
+
+	// Nothing was written by the cancelled calls
+	background := context.Background()
+	subs, err := repo.GetSubscribers(background)
+	require.NoError(t, err)
+	assert.Empty(t, subs)
+
+	transaction, err := repo.GetTransactionByHash(background, 1, hash(1))
+	require.NoError(t, err)
+	assert.Empty(t, transaction.Hash)
+}
+
+// newTransaction a mainnet transfer of 1 wei, the hash follows from the number
+func newTransaction(number int, block int64, from string, to string) ethereum_parser.Transaction {
+	return ethereum_parser.Transaction{
+		Hash:        hash(number),
+		BlockNumber: fmt.Sprintf("0x%x", block),
+		From:        from,
+		To:          to,
+		Value:       "0x1",
+		ChainID:     "0x1",
+		Status:      "0x1",
+		Kind:        ethereum_parser.TransactionKindTransfer,
+	}
+}
+
+func hash(number int) string {
+	return fmt.Sprintf("0x%064x", number)
+}
+
+func hashes(transactions []ethereum_parser.Transaction) []string {
+	var hashes []string
+	for _, transaction := range transactions {
+		hashes = append(hashes, transaction.Hash)
+	}
+
+	return hashes
+}
+
+// upper the address or hash in uppercase, as a sloppy client might send it
+func upper(value string) string {
+	return "0x" + strings.ToUpper(value[2:])
+}
+
+const (
+	alice = "0xa11ce00000000000000000000000000000000000"
+	bob   = "0xb0b0000000000000000000000000000000000000"
+	carol = "0xca20100000000000000000000000000000000000"
+	dave  = "0xda7e000000000000000000000000000000000000"
+	token = "0xdac17f958d2ee523a2206206994597c13d831ec7"
+)
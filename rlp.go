@@ -0,0 +1,110 @@
+package ethereum_parser
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// rlpFields builds an RLP list item by item from the hex strings the node returns, keeping the first error so the
+// caller only checks once
+type rlpFields struct {
+	items [][]byte
+	err   error
+}
+
+// quantity a hex number, encoded big endian without leading zeros so zero is the empty string
+func (f *rlpFields) quantity(name string, value string) {
+	if f.err != nil {
+		return
+	}
+
+	number, err := quantityToBig(value)
+	if err != nil {
+		f.err = fmt.Errorf("invalid %v %v: %v", name, value, err)
+		return
+	}
+
+	f.items = append(f.items, rlpString(number.Bytes()))
+}
+
+// data hex bytes such as hashes and addresses, encoded as they are
+func (f *rlpFields) data(name string, value string) {
+	if f.err != nil {
+		return
+	}
+
+	decoded, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+	if err != nil {
+		f.err = fmt.Errorf("invalid %v %v: %v", name, value, err)
+		return
+	}
+
+	f.items = append(f.items, rlpString(decoded))
+}
+
+// raw an item that is already encoded, such as a nested list
+func (f *rlpFields) raw(item []byte) {
+	f.items = append(f.items, item)
+}
+
+// nested appends another list of fields, taking over its error
+func (f *rlpFields) nested(fields *rlpFields) {
+	if f.err != nil {
+		return
+	}
+
+	if fields.err != nil {
+		f.err = fields.err
+		return
+	}
+
+	f.items = append(f.items, fields.encode())
+}
+
+func (f *rlpFields) encode() []byte {
+	return rlpList(f.items...)
+}
+
+// rlpString a single byte below 0x80 is its own encoding, anything else is prefixed by its length
+func rlpString(data []byte) []byte {
+	if len(data) == 1 && data[0] < 0x80 {
+		return []byte{data[0]}
+	}
+
+	return append(rlpHeader(0x80, len(data)), data...)
+}
+
+// rlpList concatenates encoded items under a list header
+func rlpList(items ...[]byte) []byte {
+	var payload []byte
+	for _, item := range items {
+		payload = append(payload, item...)
+	}
+
+	return append(rlpHeader(0xc0, len(payload)), payload...)
+}
+
+// rlpHeader short payloads carry the length in the prefix, longer ones are followed by the big endian length
+func rlpHeader(offset byte, length int) []byte {
+	if length < 56 {
+		return []byte{offset + byte(length)}
+	}
+
+	var size []byte
+	for n := length; n > 0; n >>= 8 {
+		size = append([]byte{byte(n)}, size...)
+	}
+
+	return append([]byte{offset + 55 + byte(len(size))}, size...)
+}
+
+// rlpUint the encoding of a small number, used for trie keys
+func rlpUint(n uint64) []byte {
+	var data []byte
+	for ; n > 0; n >>= 8 {
+		data = append([]byte{byte(n)}, data...)
+	}
+
+	return rlpString(data)
+}
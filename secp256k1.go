@@ -0,0 +1,166 @@
+package ethereum_parser
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+)
+
+var errInvalidPoint = errors.New("not a point on secp256k1")
+
+// curvePoint affine point on secp256k1, the point at infinity has a nil x
+type curvePoint struct {
+	x, y *big.Int
+}
+
+func (p curvePoint) infinity() bool {
+	return p.x == nil
+}
+
+// add adds two affine points, both may be the point at infinity
+func (p curvePoint) add(q curvePoint) curvePoint {
+	switch {
+	case p.infinity():
+		return q
+	case q.infinity():
+		return p
+	case p.x.Cmp(q.x) == 0:
+		if p.y.Cmp(q.y) == 0 && p.y.Sign() != 0 {
+			return p.double()
+		}
+		// q is the negation of p
+		return curvePoint{}
+	}
+
+	// lambda = (qy - py) / (qx - px)
+	lambda := new(big.Int).Sub(q.y, p.y)
+	run := new(big.Int).Sub(q.x, p.x)
+	lambda.Mul(lambda, run.ModInverse(run.Mod(run, secp256k1P), secp256k1P))
+	lambda.Mod(lambda, secp256k1P)
+
+	return p.finish(q, lambda)
+}
+
+func (p curvePoint) double() curvePoint {
+	if p.infinity() || p.y.Sign() == 0 {
+		return curvePoint{}
+	}
+
+	// lambda = 3 px^2 / 2 py, the curve has no a term
+	lambda := new(big.Int).Mul(p.x, p.x)
+	lambda.Mul(lambda, big.NewInt(3))
+	lambda.Mul(lambda, new(big.Int).ModInverse(new(big.Int).Lsh(p.y, 1), secp256k1P))
+	lambda.Mod(lambda, secp256k1P)
+
+	return p.finish(p, lambda)
+}
+
+// finish the part of addition and doubling that only depends on lambda
+func (p curvePoint) finish(q curvePoint, lambda *big.Int) curvePoint {
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, p.x)
+	x.Sub(x, q.x)
+	x.Mod(x, secp256k1P)
+
+	y := new(big.Int).Sub(p.x, x)
+	y.Mul(y, lambda)
+	y.Sub(y, p.y)
+	y.Mod(y, secp256k1P)
+
+	return curvePoint{x: x, y: y}
+}
+
+// multiply scalar multiplication by double and add, only ever used with public data so timing does not matter
+func (p curvePoint) multiply(k *big.Int) curvePoint {
+	result := curvePoint{}
+	addend := p
+	for i := 0; i < k.BitLen(); i++ {
+		if k.Bit(i) == 1 {
+			result = result.add(addend)
+		}
+		addend = addend.double()
+	}
+
+	return result
+}
+
+// compressed the 33 byte SEC encoding, 02 or 03 depending on the parity of y followed by x
+func (p curvePoint) compressed() []byte {
+	encoded := make([]byte, 33)
+	encoded[0] = 0x02 + byte(p.y.Bit(0))
+	p.x.FillBytes(encoded[1:])
+
+	return encoded
+}
+
+// uncompressed x and y without the 04 prefix, which is what Ethereum addresses are hashed from
+func (p curvePoint) uncompressed() []byte {
+	encoded := make([]byte, 64)
+	p.x.FillBytes(encoded[:32])
+	p.y.FillBytes(encoded[32:])
+
+	return encoded
+}
+
+// decompressPoint recovers y from x and its parity
+func decompressPoint(encoded []byte) (curvePoint, error) {
+	if len(encoded) != 33 || (encoded[0] != 0x02 && encoded[0] != 0x03) {
+		return curvePoint{}, errInvalidPoint
+	}
+
+	x := new(big.Int).SetBytes(encoded[1:])
+	y, err := curveY(x, encoded[0] == 0x03)
+	if err != nil {
+		return curvePoint{}, err
+	}
+
+	return curvePoint{x: x, y: y}, nil
+}
+
+// curveY solves y^2 = x^3 + 7, p is 3 mod 4 so the square root is a single exponentiation
+func curveY(x *big.Int, odd bool) (*big.Int, error) {
+	if x.Cmp(secp256k1P) >= 0 {
+		return nil, errInvalidPoint
+	}
+
+	ySquared := new(big.Int).Exp(x, big.NewInt(3), secp256k1P)
+	ySquared.Add(ySquared, big.NewInt(7))
+	ySquared.Mod(ySquared, secp256k1P)
+
+	y := new(big.Int).Exp(ySquared, secp256k1SqrtExponent, secp256k1P)
+	if new(big.Int).Exp(y, big.NewInt(2), secp256k1P).Cmp(ySquared) != 0 {
+		return nil, errInvalidPoint
+	}
+
+	if (y.Bit(0) == 1) != odd {
+		y.Sub(secp256k1P, y)
+	}
+
+	return y, nil
+}
+
+// pubkeyToAddress last 20 bytes of the hash of the uncompressed public key
+func pubkeyToAddress(p curvePoint) string {
+	return "0x" + hex.EncodeToString(keccak256(p.uncompressed())[12:])
+}
+
+func mustHex(value string) *big.Int {
+	n, ok := new(big.Int).SetString(value, 16)
+	if !ok {
+		panic("invalid constant " + value)
+	}
+
+	return n
+}
+
+var (
+	secp256k1P = mustHex("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f")
+	secp256k1N = mustHex("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141")
+	secp256k1G = curvePoint{
+		x: mustHex("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+		y: mustHex("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"),
+	}
+
+	// secp256k1SqrtExponent (p + 1) / 4
+	secp256k1SqrtExponent = new(big.Int).Rsh(new(big.Int).Add(secp256k1P, big.NewInt(1)), 2)
+)
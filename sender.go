@@ -0,0 +1,149 @@
+package ethereum_parser
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+)
+
+var errInvalidSignature = errors.New("invalid signature")
+
+// SenderCheck outcome of recovering the sender of a transaction from its signature
+type SenderCheck struct {
+	Recovered string `json:"recovered,omitempty"`
+	// Mismatch the signature does not recover to the from reported by the node, or does not recover at all
+	Mismatch bool `json:"mismatch"`
+	// Error why the sender could not be recovered
+	Error string `json:"error,omitempty"`
+}
+
+// CheckSender compares the recovered sender with the reported one, nil for transaction types that cannot be recovered
+// such as L2 deposits, which are not signed
+func CheckSender(transaction Transaction) *SenderCheck {
+	recovered, err := recoverSender(transaction)
+	if errors.Is(err, errUnsupportedTransactionType) {
+		log.Printf("Cannot recover the sender of %v: %v", transaction.Hash, err)
+		return nil
+	}
+
+	if err != nil {
+		log.Printf("Sender of %v does not recover: %v", transaction.Hash, err)
+		return &SenderCheck{Mismatch: true, Error: err.Error()}
+	}
+
+	check := &SenderCheck{Recovered: recovered, Mismatch: !strings.EqualFold(recovered, transaction.From)}
+	if check.Mismatch {
+		log.Printf("Sender of %v is reported as %v but the signature recovers to %v", transaction.Hash, transaction.From, recovered)
+	}
+
+	return check
+}
+
+// recoverSender recovers the address that signed the transaction from its v, r and s
+func recoverSender(transaction Transaction) (string, error) {
+	hash, recovery, err := signingHash(transaction)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := quantityToBig(transaction.R)
+	if err != nil {
+		return "", fmt.Errorf("%w: r %v", errInvalidSignature, transaction.R)
+	}
+
+	s, err := quantityToBig(transaction.S)
+	if err != nil {
+		return "", fmt.Errorf("%w: s %v", errInvalidSignature, transaction.S)
+	}
+
+	key, err := recoverPublicKey(hash, r, s, recovery)
+	if err != nil {
+		return "", err
+	}
+
+	return pubkeyToAddress(key), nil
+}
+
+// signingHash the hash the sender signed together with the recovery id. Legacy transactions fold the chain id into v
+// since EIP-155, typed ones sign their type byte followed by the fields before the signature.
+func signingHash(transaction Transaction) ([]byte, uint, error) {
+	txType, fields, err := transactionPayload(transaction)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if txType != legacyTxType {
+		parity, err := hexDecoder(orZero(yParity(transaction)))
+		if err != nil || parity > 1 || parity < 0 {
+			return nil, 0, fmt.Errorf("%w: y parity %v", errInvalidSignature, yParity(transaction))
+		}
+
+		if fields.err != nil {
+			return nil, 0, fields.err
+		}
+
+		return keccak256([]byte{txType}, fields.encode()), uint(parity), nil
+	}
+
+	v, err := quantityToBig(transaction.V)
+	if err != nil || !v.IsInt64() {
+		return nil, 0, fmt.Errorf("%w: v %v", errInvalidSignature, transaction.V)
+	}
+
+	var recovery int64
+	switch value := v.Int64(); {
+	case value == 27 || value == 28:
+		recovery = value - 27
+	case value >= 35:
+		chainID := (value - 35) / 2
+		recovery = value - 35 - 2*chainID
+		fields.raw(rlpUint(uint64(chainID)))
+		fields.raw(rlpString(nil))
+		fields.raw(rlpString(nil))
+	default:
+		return nil, 0, fmt.Errorf("%w: v %v", errInvalidSignature, transaction.V)
+	}
+
+	if fields.err != nil {
+		return nil, 0, fields.err
+	}
+
+	return keccak256(fields.encode()), uint(recovery), nil
+}
+
+// recoverPublicKey the key whose signature of the hash is r and s, Q = r⁻¹(sR - eG) where R is the point with x r
+func recoverPublicKey(hash []byte, r *big.Int, s *big.Int, recovery uint) (curvePoint, error) {
+	if r.Sign() <= 0 || r.Cmp(secp256k1N) >= 0 || s.Sign() <= 0 || s.Cmp(secp256k1N) >= 0 {
+		return curvePoint{}, fmt.Errorf("%w: r or s out of range", errInvalidSignature)
+	}
+
+	// The x of R only exceeds n in about one in 2^128 signatures, that is what the second bit of the id is for
+	x := new(big.Int).Set(r)
+	if recovery >= 2 {
+		x.Add(x, secp256k1N)
+	}
+
+	y, err := curveY(x, recovery&1 == 1)
+	if err != nil {
+		return curvePoint{}, fmt.Errorf("%w: %v", errInvalidSignature, err)
+	}
+	point := curvePoint{x: x, y: y}
+
+	e := new(big.Int).SetBytes(hash)
+	e.Mod(e, secp256k1N)
+
+	rInverse := new(big.Int).ModInverse(r, secp256k1N)
+	u1 := new(big.Int).Mul(e, rInverse)
+	u1.Neg(u1).Mod(u1, secp256k1N)
+	u2 := new(big.Int).Mul(s, rInverse)
+	u2.Mod(u2, secp256k1N)
+
+	key := secp256k1G.multiply(u1).add(point.multiply(u2))
+	if key.infinity() {
+		return curvePoint{}, fmt.Errorf("%w: recovers to infinity", errInvalidSignature)
+	}
+
+	return key, nil
+}
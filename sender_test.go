@@ -0,0 +1,103 @@
+package ethereum_parser_test
+
+import (
+	eth "ethereum_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCheckSender(t *testing.T) {
+	for name, test := range map[string]struct {
+		transaction eth.Transaction
+		sender      string
+	}{
+		// The first transaction of block 46147, signed before EIP-155
+		"homestead": {
+			transaction: eth.Transaction{
+				Nonce:    "0x0",
+				GasPrice: "0x2d79883d2000",
+				Gas:      "0x5208",
+				To:       "0x5df9b87991262f6ba471f09758cde1c0fc1de734",
+				Value:    "0x7a69",
+				Input:    "0x",
+				V:        "0x1c",
+				R:        "0x88ff6cf0fefd94db46111149ae4bfc179e9b94721fffd821d38d16464b3f71d0",
+				S:        "0x45e0aff800961cfce805daef7016b9b675c137a6a41a548f7b60a3484c06a33a",
+			},
+			sender: "0xa1e4380a3b1f749673e270229993ee55f35663b4",
+		},
+		// The example of EIP-155, signed by the key 0x4646...46
+		"eip-155": {
+			transaction: eth.Transaction{
+				Nonce:    "0x9",
+				GasPrice: "0x4a817c800",
+				Gas:      "0x5208",
+				To:       "0x3535353535353535353535353535353535353535",
+				Value:    "0xde0b6b3a7640000",
+				Input:    "0x",
+				V:        "0x25",
+				R:        "0x28ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276",
+				S:        "0x67cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83",
+			},
+			sender: "0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f",
+		},
+		// Signed by the private key 1
+		"eip-1559": {
+			transaction: eth.Transaction{
+				Type:                 "0x2",
+				ChainID:              "0x1",
+				Nonce:                "0x7",
+				MaxPriorityFeePerGas: "0x3b9aca00",
+				MaxFeePerGas:         "0x6fc23ac00",
+				Gas:                  "0x5208",
+				To:                   address,
+				Value:                "0xde0b6b3a7640000",
+				Input:                "0x",
+				AccessList: []eth.AccessTuple{{
+					Address:     token,
+					StorageKeys: []string{"0x0000000000000000000000000000000000000000000000000000000000000001"},
+				}},
+				V:       "0x1",
+				YParity: "0x1",
+				R:       "0x8f4f37e2d8f74e18c1b8fde2374d5f28402fb8ab7fd1cc5b786aa40851a70cb",
+				S:       "0x634750c8f1fce330038c43880d3a2183fc06189d868856c8894ca266a600de3f",
+			},
+			sender: "0x7e5f4552091a69125d5dfcb7b8c2659029395bdf",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			transaction := test.transaction
+			transaction.From = test.sender
+
+			check := eth.CheckSender(transaction)
+			require.NotNil(t, check)
+			assert.Equal(t, test.sender, check.Recovered)
+			assert.False(t, check.Mismatch)
+
+			// A node claiming somebody else sent it
+			transaction.From = counterparty
+			check = eth.CheckSender(transaction)
+			require.NotNil(t, check)
+			assert.True(t, check.Mismatch)
+
+			// Or tampering with what was signed
+			transaction.From = test.sender
+			transaction.Value = "0x1"
+			check = eth.CheckSender(transaction)
+			require.NotNil(t, check)
+			assert.True(t, check.Mismatch)
+		})
+	}
+
+	t.Run("unsigned deposit", func(t *testing.T) {
+		assert.Nil(t, eth.CheckSender(eth.Transaction{Type: "0x7e", From: address}))
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		check := eth.CheckSender(eth.Transaction{Nonce: "0x0", V: "0x1b", R: "0x0", S: "0x1", From: address})
+		require.NotNil(t, check)
+		assert.True(t, check.Mismatch)
+		assert.NotEmpty(t, check.Error)
+	})
+}
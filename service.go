@@ -2,83 +2,466 @@ package ethereum_parser
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
 )
 
 // Ensuring that we are implementing the service interface
 var _ Service = &service{}
 
 type service struct {
-	repo         Repository
-	ethClient    EthereumClient
-	newSubSignal chan bool
+	repo        Repository
+	deadLetters DeadLetterRepository
+	// chains the first one is used whenever a chain is not specified
+	chains   []Chain
+	notifier Notifier
+	// bus optional, told about subscriptions
+	bus *EventBus
+	// ens optional, resolves names on subscribe and reverse resolves counterparties
+	ens *ENSResolver
+	// supervisors report how the parser, and pending watcher, of each chain is doing
+	supervisors []*Supervisor
 }
 
-func (s *service) GetCurrentBlock(ctx context.Context) (int64, error) {
-	currentBlock, err := s.repo.GetCurrentBlock(ctx)
+func (s *service) GetCurrentBlock(ctx context.Context, chainID int64) (int64, error) {
+	chain, err := s.chain(chainID)
+	if err != nil {
+		return 0, err
+	}
+
+	currentBlock, err := s.repo.GetCurrentBlock(ctx, chain.Config.ChainID)
 	if err != nil {
 		log.Println("There was an error trying to retrieve the current block from local repo")
 		return 0, err
 	}
 
 	if currentBlock == 0 {
-		block, err := s.ethClient.GetCurrentBlock(ctx)
+		block, err := chain.Client.GetCurrentBlock(ctx)
 		if err != nil {
 			return 0, err
 		}
 
-		err = s.repo.SetCurrentBlock(ctx, block)
+		err = s.repo.SetCurrentBlock(ctx, chain.Config.ChainID, block)
 		if err != nil {
 			return 0, err
 		}
 		currentBlock = block
 	}
 
-	log.Printf("Retrieved current block %d", currentBlock)
+	log.Printf("Retrieved current block %d of %v", currentBlock, chain.Config.Name)
 
 	return currentBlock, err
 }
 
-func (s *service) Subscribe(ctx context.Context, address string) (bool, error) {
-	if err := s.repo.Subscribe(ctx, address); err != nil {
+func (s *service) GetChains(ctx context.Context) ([]ChainStatus, error) {
+	chains := make([]ChainStatus, 0, len(s.chains))
+	for _, chain := range s.chains {
+		currentBlock, err := s.repo.GetCurrentBlock(ctx, chain.Config.ChainID)
+		if err != nil {
+			return nil, err
+		}
+
+		status := ChainStatus{Name: chain.Config.Name, ChainID: chain.Config.ChainID, CurrentBlock: currentBlock}
+		for _, supervisor := range s.supervisors {
+			if supervisor.ChainID() != chain.Config.ChainID {
+				continue
+			}
+
+			state := supervisor.State()
+			if supervisor.parser == nil {
+				status.Pending = &state
+				continue
+			}
+			status.Parser = &state
+			status.Pipeline = supervisor.Metrics()
+		}
+
+		chains = append(chains, status)
+	}
+
+	return chains, nil
+}
+
+// chain looks up a configured chain, zero picks the first one
+func (s *service) chain(chainID int64) (Chain, error) {
+	if len(s.chains) == 0 {
+		return Chain{}, fmt.Errorf("%w: no chains configured", ErrUnknownChain)
+	}
+
+	if chainID == 0 {
+		return s.chains[0], nil
+	}
+
+	for _, chain := range s.chains {
+		if chain.Config.ChainID == chainID {
+			return chain, nil
+		}
+	}
+
+	return Chain{}, fmt.Errorf("%w: %d", ErrUnknownChain, chainID)
+}
+
+func (s *service) Subscribe(ctx context.Context, address string, options SubscriptionOptions) (bool, error) {
+	options, err := options.Validate()
+	if err != nil {
+		return false, err
+	}
+
+	var name string
+	if s.ens != nil && isENSName(address) {
+		name = strings.ToLower(address)
+		if address, err = s.ens.Resolve(ctx, name); errors.Is(err, ErrNameNotFound) {
+			return false, fmt.Errorf("%w: %v does not resolve to an address", ErrInvalidSubscription, name)
+		} else if err != nil {
+			return false, err
+		}
+		log.Printf("%v resolves to %v", name, address)
+	}
+
+	if !isAddress(address) {
+		return false, fmt.Errorf("%w: %v is not an address", ErrInvalidSubscription, address)
+	}
+
+	address = strings.ToLower(address)
+	if err := s.repo.Subscribe(ctx, Subscription{Address: address, Name: name, Options: options}); err != nil {
 		log.Printf("There was an issue trying to subscribe for %v", address)
 		return false, err
 	}
 
-	s.newSubSignal <- true
+	if s.bus != nil {
+		s.bus.Publish(BusEvent{Topic: TopicSubscribed, Address: address})
+	}
 
 	log.Printf("Subscribed for %v", address)
 
 	return true, nil
 }
 
-func (s *service) GetTransactions(ctx context.Context, address string) ([]Transaction, error) {
-	log.Printf("Retrieving transactions for %v", address)
+func (s *service) SubscribeWallet(ctx context.Context, xpub string, path string, gapLimit int, options SubscriptionOptions) (Wallet, error) {
+	options, err := options.Validate()
+	if err != nil {
+		return Wallet{}, err
+	}
+
+	wallet, err := NewWallet(xpub, path, gapLimit, options)
+	if err != nil {
+		return Wallet{}, err
+	}
+
+	// Subscribing again keeps what is known about used addresses, only the gap limit and options change
+	existing, err := s.repo.GetWallet(ctx, wallet.ID)
+	if err != nil {
+		return Wallet{}, err
+	}
+
+	if existing.ID != "" {
+		log.Printf("Wallet %v is already subscribed, updating options", wallet.ID)
+		existing.GapLimit, existing.Options = wallet.GapLimit, wallet.Options
+		if _, err := existing.extend(); err != nil {
+			return Wallet{}, err
+		}
+		wallet = existing
+	}
+
+	if err := s.repo.SetWallet(ctx, wallet); err != nil {
+		log.Printf("There was an issue trying to store wallet %v", wallet.ID)
+		return Wallet{}, err
+	}
+
+	for _, sub := range wallet.Subscriptions() {
+		if err := s.repo.Subscribe(ctx, sub); err != nil {
+			log.Printf("There was an issue trying to subscribe for %v of wallet %v", sub.Address, wallet.ID)
+			return Wallet{}, err
+		}
+
+		if s.bus != nil {
+			s.bus.Publish(BusEvent{Topic: TopicSubscribed, Address: sub.Address})
+		}
+	}
+
+	log.Printf("Subscribed wallet %v with %d addresses", wallet.ID, len(wallet.Addresses))
+
+	return wallet, nil
+}
+
+func (s *service) GetWallet(ctx context.Context, id string) (Wallet, error) {
+	wallet, err := s.repo.GetWallet(ctx, id)
+	if err != nil {
+		log.Printf("There was an issue trying to retrieve wallet %v", id)
+		return Wallet{}, err
+	}
+
+	if wallet.ID == "" {
+		return Wallet{}, fmt.Errorf("%w: %v", ErrWalletNotFound, id)
+	}
+
+	return wallet, nil
+}
+
+func (s *service) GetWalletTransactions(ctx context.Context, id string, query TransactionQuery) ([]Transaction, error) {
+	log.Printf("Retrieving transactions for wallet %v", id)
+
+	wallet, err := s.GetWallet(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Transfers between two addresses of the wallet are indexed under both, listing them once
+	seen := make(map[string]bool)
+	var transactions []Transaction
+	for _, derived := range wallet.Addresses {
+		query.Address = derived.Address
+		found, err := s.GetTransactions(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, transaction := range found {
+			key := transactionKey(transaction.ChainID, transaction.Hash)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		first, _ := hexDecoder(transactions[i].BlockNumber)
+		second, _ := hexDecoder(transactions[j].BlockNumber)
+		return first < second
+	})
+
+	return transactions, nil
+}
+
+func (s *service) GetTransactions(ctx context.Context, query TransactionQuery) ([]Transaction, error) {
+	log.Printf("Retrieving transactions for %v", query.Address)
+
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	if query.ChainID != 0 {
+		if _, err := s.chain(query.ChainID); err != nil {
+			return nil, err
+		}
+	}
 
-	transactions, err := s.repo.GetTransactions(ctx, address)
+	transactions, err := s.repo.GetTransactions(ctx, query)
 	if err != nil {
-		log.Printf("There was an issue trying to retrieve the transactions for %v", address)
+		log.Printf("There was an issue trying to retrieve the transactions for %v", query.Address)
 		return nil, err
 	}
 
+	if s.ens != nil {
+		s.addNames(ctx, transactions)
+	}
+
 	return transactions, err
 }
 
-func NewService(repo Repository, client EthereumClient, newSub chan bool) service {
+func (s *service) GetWithdrawals(ctx context.Context, query TransactionQuery) ([]Withdrawal, error) {
+	log.Printf("Retrieving withdrawals for %v", query.Address)
+
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	if query.ChainID != 0 {
+		if _, err := s.chain(query.ChainID); err != nil {
+			return nil, err
+		}
+	}
+
+	withdrawals, err := s.repo.GetWithdrawals(ctx, query)
+	if err != nil {
+		log.Printf("There was an issue trying to retrieve the withdrawals for %v", query.Address)
+		return nil, err
+	}
+
+	return withdrawals, nil
+}
+
+func (s *service) GetBalances(ctx context.Context, address string, chainID int64) ([]Balance, error) {
+	log.Printf("Retrieving balances for %v", address)
+
+	if !isAddress(address) {
+		return nil, fmt.Errorf("%w: %v is not an address", ErrInvalidQuery, address)
+	}
+
+	if chainID != 0 {
+		if _, err := s.chain(chainID); err != nil {
+			return nil, err
+		}
+	}
+
+	balances, err := s.repo.GetBalances(ctx, chainID, address)
+	if err != nil {
+		log.Printf("There was an issue trying to retrieve the balances for %v", address)
+		return nil, err
+	}
+
+	for i, balance := range balances {
+		balances[i].Symbol, balances[i].Amount = s.formatBalance(ctx, balance)
+	}
+
+	return balances, nil
+}
+
+// formatBalance symbol and scaled amount of the balance, tokens that have not been resolved are left raw
+func (s *service) formatBalance(ctx context.Context, balance Balance) (string, string) {
+	if balance.Asset == AssetETH {
+		return AssetETH, formatUnits(balance.Balance, etherDecimals)
+	}
+
+	chainID, err := hexDecoder(balance.ChainID)
+	if err != nil {
+		return "", ""
+	}
+
+	metadata, err := s.repo.GetTokenMetadata(ctx, chainID, balance.Asset)
+	if err != nil || metadata.Token == "" {
+		return "", ""
+	}
+
+	return metadata.Symbol, formatUnits(balance.Balance, metadata.Decimals)
+}
+
+// addNames reverse resolves every address taking part in the transactions, a failing lookup only leaves the name out
+func (s *service) addNames(ctx context.Context, transactions []Transaction) {
+	for i, transaction := range transactions {
+		for _, transfer := range transaction.Transfers() {
+			for _, address := range []string{transfer.From, transfer.To} {
+				if address == "" {
+					continue
+				}
+
+				name, err := s.ens.Reverse(ctx, address)
+				if err != nil {
+					log.Printf("Could not reverse resolve %v: %v", address, err)
+					continue
+				}
+
+				if name == "" {
+					continue
+				}
+
+				if transactions[i].Names == nil {
+					transactions[i].Names = make(map[string]string)
+				}
+				transactions[i].Names[strings.ToLower(address)] = name
+			}
+		}
+	}
+}
+
+func (s *service) GetDeadLetters(ctx context.Context, sink string) ([]DeadLetter, error) {
+	deadLetters, err := s.deadLetters.GetDeadLetters(ctx, sink)
+	if err != nil {
+		log.Println("There was an issue trying to retrieve the dead letters")
+		return nil, err
+	}
+
+	return deadLetters, nil
+}
+
+func (s *service) GetDeadLetter(ctx context.Context, id string) (DeadLetter, error) {
+	deadLetter, err := s.deadLetters.GetDeadLetter(ctx, id)
+	if err != nil {
+		log.Printf("There was an issue trying to retrieve dead letter %v", id)
+		return DeadLetter{}, err
+	}
+
+	if deadLetter.ID == "" {
+		return DeadLetter{}, ErrDeadLetterNotFound
+	}
+
+	return deadLetter, nil
+}
+
+func (s *service) ReplayDeadLetter(ctx context.Context, id string) error {
+	if err := s.notifier.Replay(ctx, id); err != nil {
+		log.Printf("There was an issue trying to replay dead letter %v: %v", id, err)
+		return err
+	}
+
+	log.Printf("Replayed dead letter %v", id)
+
+	return nil
+}
+
+func (s *service) DiscardDeadLetter(ctx context.Context, id string) error {
+	if err := s.notifier.Discard(ctx, id); err != nil {
+		log.Printf("There was an issue trying to discard dead letter %v: %v", id, err)
+		return err
+	}
+
+	log.Printf("Discarded dead letter %v", id)
+
+	return nil
+}
+
+func (s *service) GetDeadLetterStats(ctx context.Context) ([]DeadLetterStats, error) {
+	return s.deadLetters.GetDeadLetterStats(ctx)
+}
+
+func NewService(repo Repository, deadLetters DeadLetterRepository, chains []Chain, notifier Notifier, bus *EventBus, ens *ENSResolver, supervisors []*Supervisor) service {
 	return service{
-		repo:         repo,
-		ethClient:    client,
-		newSubSignal: newSub,
+		repo:        repo,
+		deadLetters: deadLetters,
+		chains:      chains,
+		notifier:    notifier,
+		bus:         bus,
+		ens:         ens,
+		supervisors: supervisors,
 	}
 }
 
 type Service interface {
-	// GetCurrentBlock last parsed block
-	GetCurrentBlock(ctx context.Context) (int64, error)
+	// GetCurrentBlock last parsed block of a chain, zero picks the first configured chain
+	GetCurrentBlock(ctx context.Context, chainID int64) (int64, error)
+
+	// GetChains the configured chains together with their cursor
+	GetChains(ctx context.Context) ([]ChainStatus, error)
+
+	// Subscribe add address to observer, the options decide which of its transactions fire events
+	Subscribe(ctx context.Context, address string, options SubscriptionOptions) (bool, error)
+
+	// SubscribeWallet derives addresses from an extended public key and subscribes them as one wallet, zero gap limit
+	// picks the default
+	SubscribeWallet(ctx context.Context, xpub string, path string, gapLimit int, options SubscriptionOptions) (Wallet, error)
+
+	// GetWallet a subscribed wallet together with its derived addresses
+	GetWallet(ctx context.Context, id string) (Wallet, error)
+
+	// GetWalletTransactions transactions of every address of a wallet, the address of the query is ignored
+	GetWalletTransactions(ctx context.Context, id string, query TransactionQuery) ([]Transaction, error)
+
+	// GetTransactions list of inbound or outbound transactions for an address, optionally narrowed down by the query
+	GetTransactions(ctx context.Context, query TransactionQuery) ([]Transaction, error)
+
+	// GetWithdrawals list of beacon chain withdrawals credited to an address, optionally narrowed down by the query
+	GetWithdrawals(ctx context.Context, query TransactionQuery) ([]Withdrawal, error)
+
+	// GetBalances the tracked balances of an address, optionally of a single chain
+	GetBalances(ctx context.Context, address string, chainID int64) ([]Balance, error)
+
+	// GetDeadLetters lists events that failed delivery, optionally only for a single sink
+	GetDeadLetters(ctx context.Context, sink string) ([]DeadLetter, error)
+
+	// GetDeadLetter inspects a single dead-lettered event
+	GetDeadLetter(ctx context.Context, id string) (DeadLetter, error)
+
+	// ReplayDeadLetter redelivers a dead-lettered event to its sink
+	ReplayDeadLetter(ctx context.Context, id string) error
 
-	// Subscribe add address to observer
-	Subscribe(ctx context.Context, address string) (bool, error)
+	// DiscardDeadLetter drops a dead-lettered event
+	DiscardDeadLetter(ctx context.Context, id string) error
 
-	// GetTransactions list of inbound or outbound transactions for an address
-	GetTransactions(ctx context.Context, address string) ([]Transaction, error)
+	// GetDeadLetterStats counters of dead-lettered events per sink
+	GetDeadLetterStats(ctx context.Context) ([]DeadLetterStats, error)
 }
@@ -0,0 +1,228 @@
+package ethereum_parser
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSubscription = errors.New("invalid subscription")
+
+type Direction string
+
+type Delivery string
+
+// Subscription an address together with the options deciding which of its transfers are worth an event
+type Subscription struct {
+	Address string `json:"address"`
+	// Name ENS name the subscription was made with, the address follows it as it changes
+	Name string `json:"name,omitempty"`
+	// Wallet id of the wallet the address was derived for
+	Wallet  string              `json:"wallet,omitempty"`
+	Options SubscriptionOptions `json:"options"`
+}
+
+type SubscriptionOptions struct {
+	// Direction of the transfers relative to the subscribed address, empty means both
+	Direction Direction `json:"direction,omitempty"`
+
+	// MinValue smallest transfer value in base units of the asset (wei for ETH), decimal or hex
+	MinValue string `json:"minValue,omitempty"`
+
+	// Assets either AssetETH or token contract addresses, empty means every asset
+	Assets []string `json:"assets,omitempty"`
+
+	// IncludeFailed whether reverted transactions still fire events
+	IncludeFailed bool `json:"includeFailed"`
+
+	// Delivery immediate sends an event per transaction, digest aggregates them into a single event
+	Delivery Delivery `json:"delivery,omitempty"`
+
+	// DigestWindow longest time events are held back before the digest is sent
+	DigestWindow time.Duration `json:"digestWindow,omitempty"`
+
+	// DigestSize number of held back events that sends the digest before the window elapses, zero means no limit
+	DigestSize int `json:"digestSize,omitempty"`
+}
+
+// Validate checks the options and brings them to the form they are stored in
+func (o SubscriptionOptions) Validate() (SubscriptionOptions, error) {
+	switch o.Direction {
+	case "":
+		o.Direction = DirectionBoth
+	case DirectionIncoming, DirectionOutgoing, DirectionBoth:
+	default:
+		return o, fmt.Errorf("%w: unknown direction %v", ErrInvalidSubscription, o.Direction)
+	}
+
+	if o.MinValue != "" {
+		if _, err := quantityToBig(o.MinValue); err != nil {
+			return o, fmt.Errorf("%w: min value %v is not a decimal or 0x prefixed hex amount", ErrInvalidSubscription, o.MinValue)
+		}
+	}
+
+	assets := make([]string, 0, len(o.Assets))
+	for _, asset := range o.Assets {
+		switch {
+		case strings.EqualFold(asset, AssetETH):
+			assets = append(assets, AssetETH)
+		case isAddress(asset):
+			assets = append(assets, strings.ToLower(asset))
+		default:
+			return o, fmt.Errorf("%w: asset %v is neither ETH nor a token contract", ErrInvalidSubscription, asset)
+		}
+	}
+	o.Assets = assets
+
+	switch o.Delivery {
+	case "":
+		o.Delivery = DeliveryImmediate
+	case DeliveryImmediate:
+	case DeliveryDigest:
+		if o.DigestWindow < 0 || o.DigestSize < 0 {
+			return o, fmt.Errorf("%w: digest window and size can not be negative", ErrInvalidSubscription)
+		}
+
+		if o.DigestWindow == 0 {
+			o.DigestWindow = defaultDigestWindow
+		}
+	default:
+		return o, fmt.Errorf("%w: unknown delivery %v", ErrInvalidSubscription, o.Delivery)
+	}
+
+	return o, nil
+}
+
+// Involves whether the address takes part in the transaction at all, regardless of the options
+func (s Subscription) Involves(transaction Transaction) bool {
+	for _, transfer := range transaction.Transfers() {
+		if strings.EqualFold(transfer.From, s.Address) || strings.EqualFold(transfer.To, s.Address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Matches evaluates the subscription options against every transfer of the transaction
+func (s Subscription) Matches(transaction Transaction) bool {
+	if transaction.Failed() && !s.Options.IncludeFailed {
+		return false
+	}
+
+	for _, transfer := range transaction.Transfers() {
+		if s.MatchesTransfer(transfer) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchesTransfer evaluates the direction, asset and minimum value options against a single transfer
+func (s Subscription) MatchesTransfer(transfer Transfer) bool {
+	incoming := strings.EqualFold(transfer.To, s.Address)
+	outgoing := strings.EqualFold(transfer.From, s.Address)
+
+	switch s.Options.Direction {
+	case DirectionIncoming:
+		if !incoming {
+			return false
+		}
+	case DirectionOutgoing:
+		if !outgoing {
+			return false
+		}
+	default:
+		if !incoming && !outgoing {
+			return false
+		}
+	}
+
+	if len(s.Options.Assets) > 0 {
+		var allowed bool
+		for _, asset := range s.Options.Assets {
+			if strings.EqualFold(asset, transfer.Asset) {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return false
+		}
+	}
+
+	if s.Options.MinValue != "" {
+		minValue, err := quantityToBig(s.Options.MinValue)
+		if err != nil {
+			return false
+		}
+
+		value, err := quantityToBig(transfer.Value)
+		if err != nil || value.Cmp(minValue) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// quantityToBig parses hex quantities returned by the node as well as decimal values provided by users
+// quantityToBig hex quantities as the node returns them or decimal ones as users write them. Signs, underscores and the
+// other prefixes big.Int understands are refused, a quantity is never negative.
+func quantityToBig(quantity string) (*big.Int, error) {
+	if quantity == "" || quantity == "0x" {
+		return new(big.Int), nil
+	}
+
+	digits, base, valid := quantity, 10, decimalDigits
+	if strings.HasPrefix(quantity, "0x") || strings.HasPrefix(quantity, "0X") {
+		digits, base, valid = quantity[2:], 16, hexDigits
+	}
+
+	if digits == "" || strings.Trim(digits, valid) != "" {
+		return nil, fmt.Errorf("invalid quantity %v", quantity)
+	}
+
+	value, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		return nil, fmt.Errorf("invalid quantity %v", quantity)
+	}
+
+	return value, nil
+}
+
+func isAddress(address string) bool {
+	if len(address) != 42 || !strings.HasPrefix(address, "0x") {
+		return false
+	}
+
+	for _, c := range address[2:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+const (
+	DirectionIncoming Direction = "incoming"
+	DirectionOutgoing Direction = "outgoing"
+	DirectionBoth     Direction = "both"
+
+	// AssetETH the native asset of the chain
+	AssetETH = "ETH"
+
+	DeliveryImmediate Delivery = "immediate"
+	DeliveryDigest    Delivery = "digest"
+
+	defaultDigestWindow = time.Minute
+
+	// decimalDigits and hexDigits what a quantity is made of after its prefix
+	decimalDigits = "0123456789"
+	hexDigits     = "0123456789abcdefABCDEF"
+)
@@ -0,0 +1,94 @@
+package ethereum_parser_test
+
+import (
+	eth "ethereum_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSubscription_Matches(t *testing.T) {
+	counterparty := "0x28c6c06298d514db089934071355e5743bf21d60"
+
+	transfer := eth.Transaction{Hash: "0x01", From: counterparty, To: address, Value: "0x3e8", Status: "0x1"}
+	failed := eth.Transaction{Hash: "0x02", From: counterparty, To: address, Value: "0x3e8", Status: "0x0"}
+	tokenTransfer := eth.Transaction{Hash: "0x03", From: counterparty, To: token, Value: "0x0", Status: "0x1",
+		TokenTransfers: []eth.TokenTransfer{{Token: token, From: counterparty, To: address, Value: "0x64"}}}
+
+	tt := []struct {
+		name        string
+		options     eth.SubscriptionOptions
+		transaction eth.Transaction
+		expected    bool
+	}{
+		{name: "no options", transaction: transfer, expected: true},
+		{name: "incoming", options: eth.SubscriptionOptions{Direction: eth.DirectionIncoming}, transaction: transfer, expected: true},
+		{name: "outgoing only", options: eth.SubscriptionOptions{Direction: eth.DirectionOutgoing}, transaction: transfer, expected: false},
+		{name: "above min value", options: eth.SubscriptionOptions{MinValue: "1000"}, transaction: transfer, expected: true},
+		{name: "below min value", options: eth.SubscriptionOptions{MinValue: "1001"}, transaction: transfer, expected: false},
+		{name: "leading zeros are decimal", options: eth.SubscriptionOptions{MinValue: "01001"}, transaction: transfer, expected: false},
+		{name: "failed excluded", transaction: failed, expected: false},
+		{name: "failed included", options: eth.SubscriptionOptions{IncludeFailed: true}, transaction: failed, expected: true},
+		{name: "token leg", options: eth.SubscriptionOptions{Direction: eth.DirectionIncoming}, transaction: tokenTransfer, expected: true},
+		{name: "token asset", options: eth.SubscriptionOptions{Assets: []string{token}}, transaction: tokenTransfer, expected: true},
+		{name: "eth only ignores token", options: eth.SubscriptionOptions{Assets: []string{eth.AssetETH}}, transaction: tokenTransfer, expected: false},
+		{name: "token min value", options: eth.SubscriptionOptions{Assets: []string{token}, MinValue: "0x65"}, transaction: tokenTransfer, expected: false},
+	}
+
+	for _, testCase := range tt {
+		t.Run(testCase.name, func(t *testing.T) {
+			options, err := testCase.options.Validate()
+			require.NoError(t, err)
+
+			sub := eth.Subscription{Address: address, Options: options}
+			assert.True(t, sub.Involves(testCase.transaction))
+			assert.Equal(t, testCase.expected, sub.Matches(testCase.transaction))
+		})
+	}
+}
+
+func TestSubscriptionOptions_Validate(t *testing.T) {
+	_, err := eth.SubscriptionOptions{Direction: "sideways"}.Validate()
+	assert.ErrorIs(t, err, eth.ErrInvalidSubscription)
+
+	for _, minValue := range []string{"lots", "-1", "-0x1", "0x-1", "+1", "1_000", "0b101", "0o17", "0xg", " 1"} {
+		_, err = eth.SubscriptionOptions{MinValue: minValue}.Validate()
+		assert.ErrorIs(t, err, eth.ErrInvalidSubscription, minValue)
+	}
+
+	_, err = eth.SubscriptionOptions{Assets: []string{"DOGE"}}.Validate()
+	assert.ErrorIs(t, err, eth.ErrInvalidSubscription)
+
+	options, err := eth.SubscriptionOptions{Assets: []string{"eth", "0xDAC17F958D2EE523A2206206994597C13D831EC7"}}.Validate()
+	require.NoError(t, err)
+	assert.Equal(t, eth.DirectionBoth, options.Direction)
+	assert.Equal(t, []string{eth.AssetETH, token}, options.Assets)
+}
+
+func TestSubscription_MatchesWithdrawal(t *testing.T) {
+	// 0x3b9aca00 gwei is 1 ETH
+	withdrawal := eth.Withdrawal{Index: "0x1", ValidatorIndex: "0x2a", Address: address, Amount: "0x3b9aca00"}
+	assert.Equal(t, "0xde0b6b3a7640000", withdrawal.Value())
+
+	tt := []struct {
+		name     string
+		options  eth.SubscriptionOptions
+		expected bool
+	}{
+		{name: "defaults", expected: true},
+		{name: "incoming", options: eth.SubscriptionOptions{Direction: eth.DirectionIncoming}, expected: true},
+		{name: "outgoing", options: eth.SubscriptionOptions{Direction: eth.DirectionOutgoing}, expected: false},
+		{name: "min value in wei", options: eth.SubscriptionOptions{MinValue: "0xde0b6b3a7640001"}, expected: false},
+		{name: "token only", options: eth.SubscriptionOptions{Assets: []string{token}}, expected: false},
+	}
+
+	for _, testCase := range tt {
+		t.Run(testCase.name, func(t *testing.T) {
+			options, err := testCase.options.Validate()
+			require.NoError(t, err)
+
+			sub := eth.Subscription{Address: address, Options: options}
+			assert.Equal(t, testCase.expected, sub.MatchesTransfer(withdrawal.Transfer()))
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package ethereum_parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type SupervisorConfig struct {
+	// Backoff wait after the first transient error, doubled on every consecutive one up to MaxBackoff
+	Backoff    time.Duration `env:"SUPERVISOR_BACKOFF" envDefault:"1s"`
+	MaxBackoff time.Duration `env:"SUPERVISOR_MAX_BACKOFF" envDefault:"1m"`
+	// BreakerThreshold consecutive node failures that open the circuit breaker
+	BreakerThreshold int `env:"SUPERVISOR_BREAKER_THRESHOLD" envDefault:"5"`
+	// BreakerCooldown how long the breaker stays open before a single sync is let through to probe the node
+	BreakerCooldown time.Duration `env:"SUPERVISOR_BREAKER_COOLDOWN" envDefault:"30s"`
+}
+
+// ParserState how a supervised parser is doing
+type ParserState string
+
+const (
+	// ParserStateRunning the last sync went through
+	ParserStateRunning ParserState = "running"
+	// ParserStateDegraded the node is failing, syncs are retried with backoff
+	ParserStateDegraded ParserState = "degraded"
+	// ParserStateOpen the circuit breaker is open, the node is left alone until the cooldown elapses
+	ParserStateOpen ParserState = "open"
+	// ParserStateStopped a fatal error stopped the parser, it needs fixing and a restart
+	ParserStateStopped ParserState = "stopped"
+)
+
+// SupervisorState reported by the /chains and /health endpoints
+type SupervisorState struct {
+	State ParserState `json:"state"`
+	// Failures consecutive failed syncs
+	Failures  int    `json:"failures"`
+	LastError string `json:"lastError,omitempty"`
+	// LastSync when a sync last went through
+	LastSync time.Time `json:"lastSync"`
+	// NextAttempt when the next sync is due while degraded or open
+	NextAttempt time.Time `json:"nextAttempt"`
+	// PollInterval wait after the last sync that went through, tuned to the block times when the chain has bounds
+	PollInterval Duration `json:"pollInterval"`
+}
+
+// Supervisor keeps the parser, or the pending watcher, of a chain going through node outages. Transient errors are
+// retried with exponential backoff, once they keep coming the circuit breaker opens and the node is only probed every
+// cooldown. Fatal errors stop the parser but not the process, the API stays up and reports the state.
+type Supervisor struct {
+	mux sync.Mutex
+
+	config SupervisorConfig
+	chain  ChainConfig
+	// name of what is supervised in the logs
+	name string
+	// parser supervised, nil when supervising the pending watcher
+	parser Parser
+	// interval wait between rounds until the first one went through
+	interval time.Duration
+	// work one round, a sync of the parser or a poll of the mempool
+	work func(ctx context.Context) error
+	// next wait after a round that went through
+	next  func() time.Duration
+	close func(ctx context.Context)
+	// bus optional, tells the parser about new subscriptions
+	bus   *EventBus
+	state SupervisorState
+}
+
+func (s *Supervisor) Run(ctx context.Context, wg *sync.WaitGroup) error {
+	defer wg.Done()
+
+	timer := time.NewTimer(s.interval)
+	defer timer.Stop()
+
+	// Never receives without a bus
+	var subscribed <-chan BusEvent
+	if s.bus != nil {
+		consumer := s.bus.Subscribe(subscribedBuffer, TopicSubscribed)
+		defer consumer.Close()
+		subscribed = consumer.C
+	}
+
+	var fatal error
+	for {
+		select {
+		case event := <-subscribed:
+			s.subscribed(event)
+		case <-timer.C:
+			wait, err := s.step(ctx)
+			if err != nil {
+				log.Printf("Stopped %v: %v", s.name, err)
+				fatal = err
+				continue
+			}
+			timer.Reset(wait)
+		case <-ctx.Done():
+			s.close(context.Background())
+			return fatal
+		}
+	}
+}
+
+// step works one round and decides how long to wait for the next one, an error is fatal
+func (s *Supervisor) step(ctx context.Context) (time.Duration, error) {
+	err := s.sync(ctx)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		if s.state.State != ParserStateRunning {
+			log.Printf("Running %v again after %d failures", s.name, s.state.Failures)
+		}
+		s.state.State = ParserStateRunning
+		s.state.Failures = 0
+		s.state.LastSync = now
+		s.state.NextAttempt = time.Time{}
+		s.state.PollInterval = Duration(s.next())
+		return time.Duration(s.state.PollInterval), nil
+	case ctx.Err() != nil:
+		// Shutting down, not the node's fault
+		return s.interval, nil
+	case !isTransient(err):
+		s.state.State = ParserStateStopped
+		s.state.LastError = err.Error()
+		s.state.NextAttempt = time.Time{}
+		return 0, err
+	}
+
+	s.state.Failures++
+	s.state.LastError = err.Error()
+
+	wait := s.backoff(s.state.Failures)
+	if s.config.BreakerThreshold > 0 && s.state.Failures >= s.config.BreakerThreshold {
+		if s.state.State != ParserStateOpen {
+			log.Printf("Opening the circuit breaker of %v after %d failures", s.name, s.state.Failures)
+		}
+		wait = s.config.BreakerCooldown
+		s.state.State = ParserStateOpen
+	} else {
+		s.state.State = ParserStateDegraded
+	}
+	s.state.NextAttempt = now.Add(wait)
+
+	log.Printf("Running %v failed, retrying in %v: %v", s.name, wait, err)
+	return wait, nil
+}
+
+// subscribed logs whether the transactions of a new subscription are being retrieved or wait for the node to recover
+func (s *Supervisor) subscribed(event BusEvent) {
+	state := s.State()
+	if state.State == ParserStateRunning {
+		log.Printf("New Sub %v, retrieving its transactions on %v", event.Address, s.chain.Name)
+		return
+	}
+
+	log.Printf("New Sub %v, its transactions on %v wait until the parser is running again, it is %v", event.Address, s.chain.Name, state.State)
+}
+
+// sync a panicking parser is stopped like one returning a fatal error rather than taking the API down with it
+func (s *Supervisor) sync(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v panicked: %v", s.name, r)
+		}
+	}()
+
+	return s.work(ctx)
+}
+
+// backoff doubles the wait with every consecutive failure, never waiting longer than the max nor less than a poll
+func (s *Supervisor) backoff(failures int) time.Duration {
+	wait := s.config.Backoff
+	for i := 1; i < failures && wait < s.config.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	if s.config.MaxBackoff > 0 && wait > s.config.MaxBackoff {
+		wait = s.config.MaxBackoff
+	}
+
+	if wait <= 0 {
+		wait = s.interval
+	}
+
+	return wait
+}
+
+// State a snapshot of how the parser is doing
+func (s *Supervisor) State() SupervisorState {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.state
+}
+
+// Metrics what each stage of the pipeline of the parser has been up to, nil for the pending watcher
+func (s *Supervisor) Metrics() []StageMetrics {
+	if s.parser == nil {
+		return nil
+	}
+
+	return s.parser.Metrics()
+}
+
+// ChainID of the supervised parser
+func (s *Supervisor) ChainID() int64 {
+	return s.chain.ChainID
+}
+
+// isTransient errors of the node or the network that may well go away on their own, anything else is fatal
+func isTransient(err error) bool {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		// A missing method or rejected params are not going to fix themselves
+		return rpcErr.Code != -32601 && rpcErr.Code != -32602
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode == http.StatusRequestTimeout ||
+			httpErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	// Gateways answering with an error page or a body cut short come and go like 5xx do
+	var malformedErr *MalformedResponseError
+	if errors.As(err, &malformedErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrBlockNotAvailable)
+}
+
+func NewSupervisor(config SupervisorConfig, chain ChainConfig, parser Parser, bus *EventBus) *Supervisor {
+	return &Supervisor{
+		config:   config,
+		chain:    chain,
+		name:     fmt.Sprintf("parsing %v", chain.Name),
+		parser:   parser,
+		interval: time.Duration(chain.PollInterval),
+		work: func(ctx context.Context) error {
+			log.Printf("Retrieving Transactions for %v", chain.Name)
+			return parser.Sync(ctx)
+		},
+		next:  parser.NextPoll,
+		close: parser.Close,
+		bus:   bus,
+		state: SupervisorState{State: ParserStateRunning},
+	}
+}
+
+// NewPendingSupervisor keeps the pending watcher of a chain polling the mempool through node outages
+func NewPendingSupervisor(config SupervisorConfig, chain ChainConfig, watcher *PendingWatcher) *Supervisor {
+	interval := watcher.config.PollInterval
+	return &Supervisor{
+		config:   config,
+		chain:    chain,
+		name:     fmt.Sprintf("watching the mempool of %v", chain.Name),
+		interval: interval,
+		work:     watcher.Poll,
+		next: func() time.Duration {
+			return interval
+		},
+		close: watcher.Close,
+		state: SupervisorState{State: ParserStateRunning},
+	}
+}
+
+// subscribedBuffer subscriptions only get logged, missing a few in a burst does no harm
+const subscribedBuffer = 16
@@ -0,0 +1,285 @@
+package ethereum_parser_test
+
+import (
+	"context"
+	eth "ethereum_parser"
+	"ethereum_parser/chaintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSupervisor(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+	chain.Mine()
+
+	storage := eth.NewMemStorage()
+	deadLetters := eth.NewMemDeadLetterStorage()
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, &recordingSink{})
+	digester := eth.NewDigester(notifier)
+	bus := eth.NewEventBus()
+
+	config := eth.ChainConfig{
+		Name:         "simulated",
+		ChainID:      1,
+		PollInterval: eth.Duration(10 * time.Millisecond),
+		PollMode:     eth.PollModeNumber,
+		StartBlock:   1,
+	}
+	parser, err := eth.NewParserService(config, &storage, chain.Client(), notifier, &digester, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	supervisor := eth.NewSupervisor(eth.SupervisorConfig{
+		Backoff:          10 * time.Millisecond,
+		MaxBackoff:       20 * time.Millisecond,
+		BreakerThreshold: 3,
+		BreakerCooldown:  200 * time.Millisecond,
+	}, config, parser, bus)
+
+	// The node fails often enough to open the breaker, rate limiting counts as much as errors
+	chain.Fail("eth_blockNumber", 2, eth.RPCError{Code: -32000, Message: "header not found"})
+	chain.Throttle(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- supervisor.Run(ctx, wg)
+	}()
+
+	require.Eventually(t, func() bool {
+		return supervisor.State().State == eth.ParserStateOpen
+	}, time.Second, 5*time.Millisecond)
+
+	state := supervisor.State()
+	assert.Equal(t, 3, state.Failures)
+	assert.Contains(t, state.LastError, "header not found")
+	assert.True(t, state.NextAttempt.After(time.Now()))
+
+	// The API reports the chain as degraded in the meantime
+	service := eth.NewService(&storage, &deadLetters, []eth.Chain{{Config: config}}, notifier, bus, nil, []*eth.Supervisor{supervisor})
+	chains, err := service.GetChains(ctx)
+	require.NoError(t, err)
+	require.Len(t, chains, 1)
+	require.NotNil(t, chains[0].Parser)
+	assert.Equal(t, eth.ParserStateOpen, chains[0].Parser.State)
+
+	// Once the cooldown elapses the probe goes through and parsing carries on
+	require.Eventually(t, func() bool {
+		return supervisor.State().State == eth.ParserStateRunning
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 0, supervisor.State().Failures)
+
+	cursor, err := storage.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cursor)
+
+	// A node without the method is not going to recover, the parser stops without taking anything else down
+	chain.Fail("eth_blockNumber", 1, eth.RPCError{Code: -32601, Message: "the method eth_blockNumber does not exist"})
+	require.Eventually(t, func() bool {
+		return supervisor.State().State == eth.ParserStateStopped
+	}, time.Second, 5*time.Millisecond)
+
+	// Subscriptions are still taken while stopped, the supervisor hears about them over the bus
+	logs := &lockedBuffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	subscribed, err := service.Subscribe(ctx, address, eth.SubscriptionOptions{})
+	require.NoError(t, err)
+	assert.True(t, subscribed)
+	assert.Eventually(t, func() bool {
+		return strings.Contains(logs.String(), "wait until the parser is running again, it is stopped")
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	err = <-stopped
+	var rpcErr *eth.RPCError
+	require.ErrorAs(t, err, &rpcErr)
+	assert.Equal(t, -32601, rpcErr.Code)
+}
+
+func TestSupervisor_ChainID(t *testing.T) {
+	node := chaintest.NewChain(1)
+	defer node.Close()
+	node.Mine()
+
+	// The node is down on start up, the chain is still built with the chain id configured
+	node.Fail("eth_chainId", 2, eth.RPCError{Code: -32000, Message: "upstream unavailable"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	storage := eth.NewMemStorage()
+	deadLetters := eth.NewMemDeadLetterStorage()
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, &recordingSink{})
+	digester := eth.NewDigester(notifier)
+	supervisorConfig := eth.SupervisorConfig{Backoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond, BreakerThreshold: 5, BreakerCooldown: time.Second}
+
+	supervise := func(chainID int64) *eth.Supervisor {
+		chain, err := eth.NewChain(ctx, eth.ChainConfig{
+			Name:         "simulated",
+			RPCURL:       node.URL(),
+			ChainID:      chainID,
+			PollInterval: eth.Duration(10 * time.Millisecond),
+			PollMode:     eth.PollModeNumber,
+			StartBlock:   1,
+		}, "2.0")
+		require.NoError(t, err)
+
+		parser, err := eth.NewParserService(chain.Config, &storage, chain.Client, notifier, &digester, nil, nil, nil, nil)
+		require.NoError(t, err)
+
+		supervisor := eth.NewSupervisor(supervisorConfig, chain.Config, parser, nil)
+		wg := new(sync.WaitGroup)
+		wg.Add(1)
+		go func() {
+			_ = supervisor.Run(ctx, wg)
+		}()
+
+		return supervisor
+	}
+
+	// Degraded until the node answers, then parsing starts
+	supervisor := supervise(1)
+	require.Eventually(t, func() bool {
+		return supervisor.State().State == eth.ParserStateDegraded
+	}, time.Second, 5*time.Millisecond)
+	assert.Contains(t, supervisor.State().LastError, "upstream unavailable")
+
+	require.Eventually(t, func() bool {
+		return supervisor.State().State == eth.ParserStateRunning && !supervisor.State().LastSync.IsZero()
+	}, time.Second, 5*time.Millisecond)
+
+	// A node serving another chain is not going to fix itself
+	supervisor = supervise(5)
+	require.Eventually(t, func() bool {
+		return supervisor.State().State == eth.ParserStateStopped
+	}, time.Second, 5*time.Millisecond)
+	assert.Contains(t, supervisor.State().LastError, "configured with id 5")
+}
+
+func TestSupervisor_MalformedResponse(t *testing.T) {
+	// A gateway in front of the node answering 200 with an error page
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html><body>502 Bad Gateway</body></html>"))
+	}))
+	defer gateway.Close()
+
+	storage := eth.NewMemStorage()
+	deadLetters := eth.NewMemDeadLetterStorage()
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, &recordingSink{})
+	digester := eth.NewDigester(notifier)
+
+	config := eth.ChainConfig{Name: "simulated", ChainID: 1, PollInterval: eth.Duration(10 * time.Millisecond), PollMode: eth.PollModeNumber}
+	client := eth.NewEthereumClient(eth.EthereumClientConfig{Addr: gateway.URL, JsonRPC: ver})
+	parser, err := eth.NewParserService(config, &storage, client, notifier, &digester, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	supervisor := eth.NewSupervisor(eth.SupervisorConfig{Backoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond, BreakerThreshold: 3, BreakerCooldown: time.Second}, config, parser, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		_ = supervisor.Run(ctx, wg)
+	}()
+
+	// Retried like any other outage rather than stopping the parser
+	require.Eventually(t, func() bool {
+		return supervisor.State().State == eth.ParserStateOpen
+	}, time.Second, 5*time.Millisecond)
+	assert.Contains(t, supervisor.State().LastError, "failed to unmarshal the response body")
+
+	cancel()
+	wg.Wait()
+}
+
+// lockedBuffer collects the logs of the goroutines of a test
+type lockedBuffer struct {
+	mux sync.Mutex
+	buf strings.Builder
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	return b.buf.String()
+}
+
+func TestSupervisor_Pending(t *testing.T) {
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+
+	storage := eth.NewMemStorage()
+	deadLetters := eth.NewMemDeadLetterStorage()
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, &recordingSink{})
+
+	config := eth.ChainConfig{Name: "simulated", ChainID: 1, PollInterval: eth.Duration(time.Hour)}
+	watcher := eth.NewPendingWatcher(eth.PendingConfig{PollInterval: 10 * time.Millisecond, CheckInterval: time.Hour, ForgetAfter: time.Hour}, 1, &storage, chain.Client(), notifier)
+
+	supervisor := eth.NewPendingSupervisor(eth.SupervisorConfig{
+		Backoff:          10 * time.Millisecond,
+		MaxBackoff:       20 * time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  100 * time.Millisecond,
+	}, config, &watcher)
+
+	// The node keeps failing to create the filter, the watcher is retried rather than exiting
+	chain.Fail("eth_newPendingTransactionFilter", 2, eth.RPCError{Code: -32000, Message: "filter not created"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- supervisor.Run(ctx, wg)
+	}()
+
+	require.Eventually(t, func() bool {
+		return supervisor.State().State == eth.ParserStateOpen
+	}, time.Second, 5*time.Millisecond)
+
+	// Reported next to the chain, not as its parser
+	service := eth.NewService(&storage, &deadLetters, []eth.Chain{{Config: config}}, notifier, eth.NewEventBus(), nil, []*eth.Supervisor{supervisor})
+	chains, err := service.GetChains(ctx)
+	require.NoError(t, err)
+	require.Len(t, chains, 1)
+	assert.Nil(t, chains[0].Parser)
+	assert.Empty(t, chains[0].Pipeline)
+	require.NotNil(t, chains[0].Pending)
+	assert.Equal(t, eth.ParserStateOpen, chains[0].Pending.State)
+	assert.Contains(t, chains[0].Pending.LastError, "filter not created")
+
+	require.Eventually(t, func() bool {
+		return supervisor.State().State == eth.ParserStateRunning
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 0, supervisor.State().Failures)
+
+	cancel()
+	assert.NoError(t, <-stopped)
+	assert.Equal(t, 1, chain.Requests("eth_uninstallFilter"), "the filter is uninstalled on the way out")
+}
@@ -0,0 +1,179 @@
+package ethereum_parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// TokenMetadata what a token says about itself, fields the token does not implement are left empty
+type TokenMetadata struct {
+	Token    string `json:"token"`
+	ChainID  string `json:"chainId"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+// TokenResolver looks up token metadata through eth_call, keeping what it finds in the repository so every token is
+// only queried once
+type TokenResolver struct {
+	chainID int64
+	storage Repository
+	client  ethereumClient
+}
+
+// Resolve returns the metadata of the token, querying the token the first time it is seen
+func (r TokenResolver) Resolve(ctx context.Context, token string) (TokenMetadata, error) {
+	token = strings.ToLower(token)
+
+	metadata, err := r.storage.GetTokenMetadata(ctx, r.chainID, token)
+	if err != nil || metadata.Token != "" {
+		return metadata, err
+	}
+
+	metadata = TokenMetadata{Token: token, ChainID: quantity(r.chainID)}
+	if metadata.Name, err = r.text(ctx, token, "name()"); err != nil {
+		return TokenMetadata{}, err
+	}
+
+	if metadata.Symbol, err = r.text(ctx, token, "symbol()"); err != nil {
+		return TokenMetadata{}, err
+	}
+
+	if metadata.Decimals, err = r.decimals(ctx, token); err != nil {
+		return TokenMetadata{}, err
+	}
+
+	return metadata, r.storage.AddTokenMetadata(ctx, metadata)
+}
+
+// Annotate fills in the symbol and formatted amount of the token transfers, a token that cannot be resolved is left as is
+func (r TokenResolver) Annotate(ctx context.Context, transfers []TokenTransfer) []TokenTransfer {
+	for i, transfer := range transfers {
+		metadata, err := r.Resolve(ctx, transfer.Token)
+		if err != nil {
+			// Worth retrying the next time the token shows up, nothing is stored
+			log.Printf("Could not resolve token %v: %v", transfer.Token, err)
+			continue
+		}
+
+		transfers[i].Symbol = metadata.Symbol
+		transfers[i].Amount = formatUnits(transfer.Value, metadata.Decimals)
+	}
+
+	return transfers
+}
+
+// text calls a function returning a string, legacy tokens such as MKR return bytes32 instead
+func (r TokenResolver) text(ctx context.Context, token string, signature string) (string, error) {
+	data, err := r.call(ctx, token, signature)
+	if err != nil || data == nil {
+		return "", err
+	}
+
+	if len(data) == abiWord {
+		return cleanText(bytes.TrimRight(data, "\x00")), nil
+	}
+
+	values, err := decodeABITuple([]abiType{{kind: abiString, canonical: "string"}}, data)
+	if err != nil {
+		// Whatever came back is not a name, treating it as missing
+		return "", nil
+	}
+
+	return cleanText([]byte(values[0].(string))), nil
+}
+
+func (r TokenResolver) decimals(ctx context.Context, token string) (int, error) {
+	data, err := r.call(ctx, token, "decimals()")
+	if err != nil || len(data) < abiWord {
+		return 0, err
+	}
+
+	decimals := new(big.Int).SetBytes(data[:abiWord])
+	if !decimals.IsInt64() || decimals.Int64() > maxTokenDecimals {
+		return 0, nil
+	}
+
+	return int(decimals.Int64()), nil
+}
+
+// call returns nil when the token does not implement the function, errors are left for the node being unavailable
+func (r TokenResolver) call(ctx context.Context, token string, signature string) ([]byte, error) {
+	input, err := encodeABICall(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := r.client.Call(ctx, CallMsg{To: token, Data: "0x" + hex.EncodeToString(input)}, 0)
+	if isReverted(err) {
+		// The function is not there
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %v on %v: %w", signature, token, err)
+	}
+
+	data, err := hex.DecodeString(strings.TrimPrefix(result, "0x"))
+	if err != nil || len(data) == 0 {
+		return nil, nil
+	}
+
+	return data, nil
+}
+
+// cleanText tokens are free to return anything, only printable UTF-8 is kept
+func cleanText(raw []byte) string {
+	if !utf8.Valid(raw) {
+		return ""
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(string(raw)))
+}
+
+// formatUnits scales a base unit quantity down by the decimals, 0xf4240 with 6 decimals is 1
+func formatUnits(value string, decimals int) string {
+	amount, err := quantityToBig(value)
+	if err != nil {
+		return ""
+	}
+
+	digits := amount.String()
+	if decimals == 0 {
+		return digits
+	}
+
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+
+	whole, fraction := digits[:len(digits)-decimals], strings.TrimRight(digits[len(digits)-decimals:], "0")
+	if fraction == "" {
+		return whole
+	}
+
+	return whole + "." + fraction
+}
+
+func NewTokenResolver(chainID int64, storage Repository, client ethereumClient) TokenResolver {
+	return TokenResolver{
+		chainID: chainID,
+		storage: storage,
+		client:  client,
+	}
+}
+
+// maxTokenDecimals anything above is a broken token rather than a very divisible one
+const maxTokenDecimals = 77
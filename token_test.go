@@ -0,0 +1,107 @@
+package ethereum_parser_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	eth "ethereum_parser"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	legacyToken = "0x9f8f72aa9304c8b593d555f12ef6589cc3a579a2"
+	daiToken    = "0x6b175474e89094c44da98b954eedeac495271d0f"
+)
+
+func TestTokenResolver_Annotate(t *testing.T) {
+	// Responses by token and selector, a missing one reverts
+	responses := map[string]string{
+		// name() and symbol() of a regular token returning strings
+		token + "06fdde03": "0x" + abiString("Tether USD"),
+		token + "95d89b41": "0x" + abiString("USDT"),
+		token + "313ce567": "0x0000000000000000000000000000000000000000000000000000000000000006",
+		// MKR returns bytes32 and has no name
+		legacyToken + "95d89b41": "0x4d4b520000000000000000000000000000000000000000000000000000000000",
+		legacyToken + "313ce567": "0x0000000000000000000000000000000000000000000000000000000000000012",
+	}
+
+	var calls int
+	var limited bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		require.Equal(t, "eth_call", request.Method)
+
+		var msg eth.CallMsg
+		require.NoError(t, json.Unmarshal(request.Params[0], &msg))
+		calls++
+
+		if limited {
+			_, _ = w.Write([]byte(`{"jsonrpc": "2.0", "id": 1, "error": {"code": -32005, "message": "daily request count exceeded"}}`))
+			return
+		}
+
+		result, ok := responses[msg.To+strings.TrimPrefix(msg.Data, "0x")]
+		if !ok {
+			_, _ = w.Write([]byte(`{"jsonrpc": "2.0", "id": 1, "error": {"code": 3, "message": "execution reverted"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc": "2.0", "id": 1, "result": "` + result + `"}`))
+	}))
+	defer server.Close()
+
+	storage := eth.NewMemStorage()
+	client := eth.NewEthereumClient(eth.EthereumClientConfig{Addr: server.URL, JsonRPC: "2.0"})
+	resolver := eth.NewTokenResolver(1, &storage, client)
+
+	transfers := resolver.Annotate(context.Background(), []eth.TokenTransfer{
+		{Token: token, Value: "0x16e360"},
+		{Token: legacyToken, Value: "0xde0b6b3a7640000"},
+		{Token: token, Value: "0x1"},
+	})
+
+	assert.Equal(t, "USDT", transfers[0].Symbol)
+	assert.Equal(t, "1.5", transfers[0].Amount)
+	assert.Equal(t, "MKR", transfers[1].Symbol)
+	assert.Equal(t, "1", transfers[1].Amount)
+	assert.Equal(t, "0.000001", transfers[2].Amount)
+
+	// Three calls per token, the second transfer of the same token is served from storage
+	assert.Equal(t, 6, calls)
+
+	metadata, err := storage.GetTokenMetadata(context.Background(), 1, legacyToken)
+	require.NoError(t, err)
+	assert.Equal(t, eth.TokenMetadata{Token: legacyToken, ChainID: "0x1", Symbol: "MKR", Decimals: 18}, metadata)
+
+	// A node over its rate limit is no revert, nothing is stored so the token is queried again the next time
+	limited = true
+	transfers = resolver.Annotate(context.Background(), []eth.TokenTransfer{{Token: daiToken, Value: "0xde0b6b3a7640000"}})
+	assert.Empty(t, transfers[0].Symbol)
+	assert.Empty(t, transfers[0].Amount)
+
+	metadata, err = storage.GetTokenMetadata(context.Background(), 1, daiToken)
+	require.NoError(t, err)
+	assert.Empty(t, metadata.Token)
+
+	limited = false
+	responses[daiToken+"95d89b41"] = "0x" + abiString("DAI")
+	responses[daiToken+"313ce567"] = "0x0000000000000000000000000000000000000000000000000000000000000012"
+	transfers = resolver.Annotate(context.Background(), []eth.TokenTransfer{{Token: daiToken, Value: "0xde0b6b3a7640000"}})
+	assert.Equal(t, "DAI", transfers[0].Symbol)
+	assert.Equal(t, "1", transfers[0].Amount)
+}
+
+// abiString encodes a string return value, offset, length and the padded content
+func abiString(value string) string {
+	content := hex.EncodeToString([]byte(value))
+	return fmt.Sprintf("%064x%064x", 32, len(value)) + content + strings.Repeat("0", 64-len(content)%64)
+}
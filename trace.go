@@ -0,0 +1,231 @@
+package ethereum_parser
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// InternalTransfer value moved by a call made from inside a contract, linked to the transaction that triggered it
+type InternalTransfer struct {
+	// Type of the call, CALL, CREATE, CREATE2 or SELFDESTRUCT
+	Type  string `json:"type"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"value"`
+	// TraceAddress position of the call in the call tree of the parent transaction
+	TraceAddress []int `json:"traceAddress"`
+}
+
+// CallFrame a single call as reported by the geth callTracer
+type CallFrame struct {
+	Type    string      `json:"type"`
+	From    string      `json:"from"`
+	To      string      `json:"to"`
+	Value   string      `json:"value"`
+	Input   string      `json:"input"`
+	Error   string      `json:"error"`
+	Calls   []CallFrame `json:"calls"`
+	GasUsed string      `json:"gasUsed"`
+}
+
+// TransactionTrace the call tree of a single transaction as returned by debug_traceBlockByNumber
+type TransactionTrace struct {
+	TxHash string    `json:"txHash"`
+	Result CallFrame `json:"result"`
+	Error  string    `json:"error"`
+}
+
+// ParityTrace a single call as returned by trace_block on nodes implementing the parity trace module
+type ParityTrace struct {
+	Type   string            `json:"type"`
+	Action ParityTraceAction `json:"action"`
+	Result *struct {
+		Address string `json:"address"`
+	} `json:"result"`
+	Error           string `json:"error"`
+	TraceAddress    []int  `json:"traceAddress"`
+	TransactionHash string `json:"transactionHash"`
+}
+
+type ParityTraceAction struct {
+	CallType      string `json:"callType"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Value         string `json:"value"`
+	Address       string `json:"address"`
+	RefundAddress string `json:"refundAddress"`
+	Balance       string `json:"balance"`
+}
+
+// internalTransfers traces the block with the configured tracer and returns the value-bearing internal calls by transaction hash
+func internalTransfers(ctx context.Context, client ethereumClient, tracer string, block Block) (map[string][]InternalTransfer, error) {
+	number, err := hexDecoder(block.Number)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block number %v: %v", block.Number, err)
+	}
+
+	switch tracer {
+	case TracerDebug:
+		traces, err := client.TraceBlockByNumber(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+
+		return callTracerTransfers(block, traces), nil
+	case TracerParity:
+		traces, err := client.TraceBlock(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+
+		return parityTransfers(traces), nil
+	default:
+		return nil, fmt.Errorf("unknown tracer %v", tracer)
+	}
+}
+
+// callTracerTransfers older geth versions leave out the hash, the traces are in transaction order either way
+func callTracerTransfers(block Block, traces []TransactionTrace) map[string][]InternalTransfer {
+	transfers := make(map[string][]InternalTransfer)
+	for i, trace := range traces {
+		hash := trace.TxHash
+		if hash == "" && i < len(block.Transactions) {
+			hash = block.Transactions[i].Hash
+		}
+
+		if hash == "" || trace.Error != "" {
+			continue
+		}
+
+		// The top level frame is the transaction itself, only its children are internal
+		for j, call := range trace.Result.Calls {
+			transfers[hash] = appendFrameTransfers(transfers[hash], call, []int{j}, trace.Result.Error != "")
+		}
+	}
+
+	return transfers
+}
+
+// appendFrameTransfers walks the call tree, value moved by a reverted frame or any of its parents never happened
+func appendFrameTransfers(transfers []InternalTransfer, frame CallFrame, traceAddress []int, reverted bool) []InternalTransfer {
+	reverted = reverted || frame.Error != ""
+	callType := strings.ToUpper(frame.Type)
+
+	if !reverted && movesValue(callType, frame.Value) {
+		transfers = append(transfers, InternalTransfer{
+			Type:         callType,
+			From:         strings.ToLower(frame.From),
+			To:           strings.ToLower(frame.To),
+			Value:        normaliseQuantity(frame.Value),
+			TraceAddress: traceAddress,
+		})
+	}
+
+	for i, call := range frame.Calls {
+		child := append(append([]int{}, traceAddress...), i)
+		transfers = appendFrameTransfers(transfers, call, child, reverted)
+	}
+
+	return transfers
+}
+
+func parityTransfers(traces []ParityTrace) map[string][]InternalTransfer {
+	// Reverted calls undo everything below them, so they are collected first per transaction
+	reverted := make(map[string][][]int)
+	for _, trace := range traces {
+		if trace.Error != "" {
+			reverted[trace.TransactionHash] = append(reverted[trace.TransactionHash], trace.TraceAddress)
+		}
+	}
+
+	transfers := make(map[string][]InternalTransfer)
+	for _, trace := range traces {
+		// Block rewards have no transaction, the top level trace is the transaction itself
+		if trace.TransactionHash == "" || len(trace.TraceAddress) == 0 {
+			continue
+		}
+
+		if underReverted(trace.TraceAddress, reverted[trace.TransactionHash]) {
+			continue
+		}
+
+		var transfer InternalTransfer
+		switch trace.Type {
+		case "call":
+			transfer = InternalTransfer{Type: strings.ToUpper(trace.Action.CallType), From: trace.Action.From, To: trace.Action.To, Value: trace.Action.Value}
+		case "create":
+			transfer = InternalTransfer{Type: "CREATE", From: trace.Action.From, Value: trace.Action.Value}
+			if trace.Result != nil {
+				transfer.To = trace.Result.Address
+			}
+		case "suicide":
+			transfer = InternalTransfer{Type: "SELFDESTRUCT", From: trace.Action.Address, To: trace.Action.RefundAddress, Value: trace.Action.Balance}
+		default:
+			continue
+		}
+
+		if !movesValue(transfer.Type, transfer.Value) {
+			continue
+		}
+
+		transfer.From = strings.ToLower(transfer.From)
+		transfer.To = strings.ToLower(transfer.To)
+		transfer.Value = normaliseQuantity(transfer.Value)
+		transfer.TraceAddress = trace.TraceAddress
+		transfers[trace.TransactionHash] = append(transfers[trace.TransactionHash], transfer)
+	}
+
+	return transfers
+}
+
+// underReverted whether the trace itself or any of its ancestors reverted
+func underReverted(traceAddress []int, reverted [][]int) bool {
+	for _, candidate := range reverted {
+		if len(candidate) > len(traceAddress) {
+			continue
+		}
+
+		prefix := true
+		for i := range candidate {
+			if candidate[i] != traceAddress[i] {
+				prefix = false
+				break
+			}
+		}
+
+		if prefix {
+			return true
+		}
+	}
+
+	return false
+}
+
+// movesValue delegate and static calls run in someone else's context, they never transfer anything themselves
+func movesValue(callType string, value string) bool {
+	switch callType {
+	case "CALL", "CREATE", "CREATE2", "SELFDESTRUCT":
+	default:
+		return false
+	}
+
+	amount, err := quantityToBig(value)
+	return err == nil && amount.Sign() > 0
+}
+
+func normaliseQuantity(value string) string {
+	amount, err := quantityToBig(value)
+	if err != nil {
+		return value
+	}
+
+	return bigToQuantity(amount)
+}
+
+const (
+	// TracerDebug debug_traceBlockByNumber with the callTracer, geth and most of its forks
+	TracerDebug = "debug"
+	// TracerParity trace_block, erigon, nethermind and reth
+	TracerParity = "parity"
+)
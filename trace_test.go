@@ -0,0 +1,228 @@
+package ethereum_parser_test
+
+import (
+	"context"
+	eth "ethereum_parser"
+	"ethereum_parser/chaintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+const (
+	beneficiary = "0x4838b106fce9647bdf1e7877bf73ce8b0bad5f97"
+	deployed    = "0x5fbdb2315678afecb367f032d93f642f64180aa3"
+)
+
+func TestParserService_SyncCallTracer(t *testing.T) {
+	tt := []struct {
+		name     string
+		trace    eth.TransactionTrace
+		expected []eth.InternalTransfer
+	}{
+		{
+			name: "value moved by children",
+			trace: eth.TransactionTrace{Result: eth.CallFrame{Type: "CALL", From: address, To: counterparty, Calls: []eth.CallFrame{
+				{Type: "CALL", From: counterparty, To: "0x4838B106FCe9647Bdf1E7877BF73cE8B0BAD5f97", Value: "0x0010"},
+				{Type: "DELEGATECALL", From: counterparty, To: beneficiary, Value: "0x5"},
+				{Type: "STATICCALL", From: counterparty, To: beneficiary, Value: "0x0"},
+				{Type: "CREATE", From: counterparty, To: deployed, Value: "0x20", Calls: []eth.CallFrame{
+					{Type: "CALL", From: deployed, To: beneficiary, Value: "0x1"},
+					{Type: "CALL", From: deployed, To: beneficiary, Value: "0x0"},
+				}},
+			}}},
+			expected: []eth.InternalTransfer{
+				{Type: "CALL", From: counterparty, To: beneficiary, Value: "0x10", TraceAddress: []int{0}},
+				{Type: "CREATE", From: counterparty, To: deployed, Value: "0x20", TraceAddress: []int{3}},
+				{Type: "CALL", From: deployed, To: beneficiary, Value: "0x1", TraceAddress: []int{3, 0}},
+			},
+		},
+		{
+			name: "reverted parent whose child carries value",
+			trace: eth.TransactionTrace{Result: eth.CallFrame{Type: "CALL", From: address, To: counterparty, Calls: []eth.CallFrame{
+				{Type: "CALL", From: counterparty, To: deployed, Value: "0x1", Error: "execution reverted", Calls: []eth.CallFrame{
+					{Type: "CALL", From: deployed, To: beneficiary, Value: "0x2"},
+				}},
+				{Type: "CALL", From: counterparty, To: beneficiary, Value: "0x3"},
+			}}},
+			expected: []eth.InternalTransfer{
+				{Type: "CALL", From: counterparty, To: beneficiary, Value: "0x3", TraceAddress: []int{1}},
+			},
+		},
+		{
+			name: "top level revert",
+			trace: eth.TransactionTrace{Result: eth.CallFrame{Type: "CALL", From: address, To: counterparty, Error: "execution reverted", Calls: []eth.CallFrame{
+				{Type: "CALL", From: counterparty, To: beneficiary, Value: "0x1"},
+			}}},
+		},
+		{
+			name: "failed trace",
+			trace: eth.TransactionTrace{Error: "execution timeout", Result: eth.CallFrame{Type: "CALL", From: address, To: counterparty, Calls: []eth.CallFrame{
+				{Type: "CALL", From: counterparty, To: beneficiary, Value: "0x1"},
+			}}},
+		},
+	}
+
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+	chain.SetCode(counterparty, "0x6080")
+
+	hashes := make([]string, len(tt))
+	for i, testCase := range tt {
+		block := chain.Mine(eth.Transaction{From: address, To: counterparty, Value: "0x0"})
+		hashes[i] = block.Transactions[0].Hash
+
+		trace := testCase.trace
+		trace.TxHash = hashes[i]
+		chain.SetTraces(int64(i+1), []eth.TransactionTrace{trace})
+	}
+
+	// Older geth versions leave out the hash, the trace belongs to the transaction at the same position
+	block := chain.Mine(eth.Transaction{From: address, To: counterparty, Value: "0x0"})
+	chain.SetTraces(int64(len(tt)+1), []eth.TransactionTrace{{Result: eth.CallFrame{Type: "CALL", From: address, To: counterparty, Calls: []eth.CallFrame{
+		{Type: "CALL", From: counterparty, To: beneficiary, Value: "0x7"},
+	}}}})
+
+	storage := syncTraced(t, chain, eth.TracerDebug, int64(len(tt)+1))
+
+	for i, testCase := range tt {
+		t.Run(testCase.name, func(t *testing.T) {
+			transaction, err := storage.GetTransactionByHash(context.Background(), 1, hashes[i])
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, transaction.InternalTransfers)
+		})
+	}
+
+	t.Run("missing transaction hash", func(t *testing.T) {
+		transaction, err := storage.GetTransactionByHash(context.Background(), 1, block.Transactions[0].Hash)
+		require.NoError(t, err)
+		assert.Equal(t, []eth.InternalTransfer{
+			{Type: "CALL", From: counterparty, To: beneficiary, Value: "0x7", TraceAddress: []int{0}},
+		}, transaction.InternalTransfers)
+	})
+}
+
+func TestParserService_SyncParityTracer(t *testing.T) {
+	tt := []struct {
+		name     string
+		traces   []eth.ParityTrace
+		expected []eth.InternalTransfer
+	}{
+		{
+			name: "calls",
+			traces: []eth.ParityTrace{
+				{Type: "call", Action: eth.ParityTraceAction{CallType: "call", From: address, To: counterparty, Value: "0x9"}, TraceAddress: []int{}},
+				{Type: "call", Action: eth.ParityTraceAction{CallType: "call", From: counterparty, To: "0x4838B106FCe9647Bdf1E7877BF73cE8B0BAD5f97", Value: "0x0010"}, TraceAddress: []int{0}},
+				{Type: "call", Action: eth.ParityTraceAction{CallType: "delegatecall", From: counterparty, To: beneficiary, Value: "0x5"}, TraceAddress: []int{1}},
+				{Type: "call", Action: eth.ParityTraceAction{CallType: "staticcall", From: counterparty, To: beneficiary, Value: "0x0"}, TraceAddress: []int{2}},
+			},
+			expected: []eth.InternalTransfer{
+				{Type: "CALL", From: counterparty, To: beneficiary, Value: "0x10", TraceAddress: []int{0}},
+			},
+		},
+		{
+			name: "create",
+			traces: []eth.ParityTrace{
+				{Type: "call", Action: eth.ParityTraceAction{CallType: "call", From: address, To: counterparty}, TraceAddress: []int{}},
+				{
+					Type:   "create",
+					Action: eth.ParityTraceAction{From: counterparty, Value: "0x20"},
+					Result: &struct {
+						Address string `json:"address"`
+					}{Address: deployed},
+					TraceAddress: []int{0},
+				},
+			},
+			expected: []eth.InternalTransfer{
+				{Type: "CREATE", From: counterparty, To: deployed, Value: "0x20", TraceAddress: []int{0}},
+			},
+		},
+		{
+			name: "suicide",
+			traces: []eth.ParityTrace{
+				{Type: "call", Action: eth.ParityTraceAction{CallType: "call", From: address, To: counterparty}, TraceAddress: []int{}},
+				{Type: "suicide", Action: eth.ParityTraceAction{Address: counterparty, RefundAddress: beneficiary, Balance: "0x30"}, TraceAddress: []int{0}},
+			},
+			expected: []eth.InternalTransfer{
+				{Type: "SELFDESTRUCT", From: counterparty, To: beneficiary, Value: "0x30", TraceAddress: []int{0}},
+			},
+		},
+		{
+			name: "reverted parent whose child carries value",
+			traces: []eth.ParityTrace{
+				{Type: "call", Action: eth.ParityTraceAction{CallType: "call", From: address, To: counterparty}, TraceAddress: []int{}},
+				{Type: "call", Action: eth.ParityTraceAction{CallType: "call", From: counterparty, To: deployed, Value: "0x1"}, Error: "Reverted", TraceAddress: []int{0}},
+				{Type: "call", Action: eth.ParityTraceAction{CallType: "call", From: deployed, To: beneficiary, Value: "0x2"}, TraceAddress: []int{0, 0}},
+				{Type: "call", Action: eth.ParityTraceAction{CallType: "call", From: counterparty, To: beneficiary, Value: "0x3"}, TraceAddress: []int{1}},
+			},
+			expected: []eth.InternalTransfer{
+				{Type: "CALL", From: counterparty, To: beneficiary, Value: "0x3", TraceAddress: []int{1}},
+			},
+		},
+		{
+			name: "top level revert",
+			traces: []eth.ParityTrace{
+				{Type: "call", Action: eth.ParityTraceAction{CallType: "call", From: address, To: counterparty}, Error: "Reverted", TraceAddress: []int{}},
+				{Type: "call", Action: eth.ParityTraceAction{CallType: "call", From: counterparty, To: beneficiary, Value: "0x1"}, TraceAddress: []int{0}},
+			},
+		},
+	}
+
+	chain := chaintest.NewChain(1)
+	defer chain.Close()
+	chain.SetCode(counterparty, "0x6080")
+
+	hashes := make([]string, len(tt))
+	for i, testCase := range tt {
+		block := chain.Mine(eth.Transaction{From: address, To: counterparty, Value: "0x0"})
+		hashes[i] = block.Transactions[0].Hash
+
+		traces := make([]eth.ParityTrace, 0, len(testCase.traces)+1)
+		for _, trace := range testCase.traces {
+			trace.TransactionHash = hashes[i]
+			traces = append(traces, trace)
+		}
+		// The block reward has no transaction
+		traces = append(traces, eth.ParityTrace{Type: "reward", Action: eth.ParityTraceAction{Value: "0x1bc16d674ec80000"}})
+		chain.SetParityTraces(int64(i+1), traces)
+	}
+
+	storage := syncTraced(t, chain, eth.TracerParity, int64(len(tt)))
+
+	for i, testCase := range tt {
+		t.Run(testCase.name, func(t *testing.T) {
+			transaction, err := storage.GetTransactionByHash(context.Background(), 1, hashes[i])
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, transaction.InternalTransfers)
+		})
+	}
+}
+
+// syncTraced parses the chain up to the block with the tracer, the transactions of the address are kept
+func syncTraced(t *testing.T, chain *chaintest.Chain, tracer string, to int64) *eth.InMemStorage {
+	ctx := context.Background()
+	storage := eth.NewMemStorage()
+	require.NoError(t, storage.Subscribe(ctx, eth.Subscription{Address: address}))
+
+	deadLetters := eth.NewMemDeadLetterStorage()
+	notifier := eth.NewNotifier(eth.NotifierConfig{MaxAttempts: 1}, &deadLetters, &recordingSink{})
+	digester := eth.NewDigester(notifier)
+
+	parser, err := eth.NewParserService(eth.ChainConfig{
+		Name:         "simulated",
+		ChainID:      1,
+		PollInterval: eth.Duration(time.Second),
+		PollMode:     eth.PollModeNumber,
+		StartBlock:   1,
+		Tracer:       tracer,
+	}, &storage, chain.Client(), notifier, &digester, nil, nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, parser.Sync(ctx))
+
+	cursor, err := storage.GetCurrentBlock(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, to, cursor)
+
+	return &storage
+}
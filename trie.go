@@ -0,0 +1,107 @@
+package ethereum_parser
+
+// trieEntry a key split into nibbles together with its value
+type trieEntry struct {
+	key   []byte
+	value []byte
+}
+
+// listRoot the root of the Merkle-Patricia trie blocks use for their transactions, receipts and withdrawals, every item
+// keyed by the RLP encoding of its index
+func listRoot(items [][]byte) []byte {
+	entries := make([]trieEntry, 0, len(items))
+	for i, item := range items {
+		entries = append(entries, trieEntry{key: nibbles(rlpUint(uint64(i))), value: item})
+	}
+
+	return keccak256(trieNode(entries, 0))
+}
+
+// trieNode the RLP encoding of the node holding the entries, which all share the first depth nibbles
+func trieNode(entries []trieEntry, depth int) []byte {
+	switch len(entries) {
+	case 0:
+		return rlpString(nil)
+	case 1:
+		return rlpList(rlpString(hexPrefix(entries[0].key[depth:], true)), rlpString(entries[0].value))
+	}
+
+	// Extension over the nibbles every key has in common
+	if shared := sharedPrefix(entries, depth); shared > 0 {
+		prefix := entries[0].key[depth : depth+shared]
+		return rlpList(rlpString(hexPrefix(prefix, false)), trieReference(trieNode(entries, depth+shared)))
+	}
+
+	var children [16][]trieEntry
+	var value []byte
+	for _, entry := range entries {
+		if len(entry.key) == depth {
+			value = entry.value
+			continue
+		}
+		children[entry.key[depth]] = append(children[entry.key[depth]], entry)
+	}
+
+	branch := make([][]byte, 0, 17)
+	for _, child := range children {
+		if len(child) == 0 {
+			branch = append(branch, rlpString(nil))
+			continue
+		}
+		branch = append(branch, trieReference(trieNode(child, depth+1)))
+	}
+
+	return rlpList(append(branch, rlpString(value))...)
+}
+
+// trieReference nodes shorter than a hash are embedded in their parent, the rest are referenced by hash
+func trieReference(node []byte) []byte {
+	if len(node) < 32 {
+		return node
+	}
+
+	return rlpString(keccak256(node))
+}
+
+func sharedPrefix(entries []trieEntry, depth int) int {
+	shared := 0
+	for {
+		position := depth + shared
+		for _, entry := range entries {
+			if position >= len(entry.key) || entry.key[position] != entries[0].key[position] {
+				return shared
+			}
+		}
+		shared++
+	}
+}
+
+// hexPrefix packs nibbles back into bytes, the first nibble flags leaves and odd lengths
+func hexPrefix(path []byte, leaf bool) []byte {
+	var flag byte
+	if leaf {
+		flag = 2
+	}
+
+	if len(path)%2 == 1 {
+		path = append([]byte{flag + 1}, path...)
+	} else {
+		path = append([]byte{flag, 0}, path...)
+	}
+
+	packed := make([]byte, len(path)/2)
+	for i := range packed {
+		packed[i] = path[2*i]<<4 | path[2*i+1]
+	}
+
+	return packed
+}
+
+func nibbles(key []byte) []byte {
+	split := make([]byte, 0, len(key)*2)
+	for _, b := range key {
+		split = append(split, b>>4, b&0x0f)
+	}
+
+	return split
+}
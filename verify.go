@@ -0,0 +1,280 @@
+package ethereum_parser
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrBlockVerification = errors.New("block does not match its hash")
+
+	errUnsupportedTransactionType = errors.New("unsupported transaction type")
+)
+
+// VerifyBlock recomputes the hash of the block from its header, the transactions root from the transactions and the
+// withdrawals root from the withdrawals, so a node cannot hand out transfers the block does not commit to. Only the
+// Ethereum transaction types are known, blocks with L2 specific ones such as deposits fail.
+func VerifyBlock(block Block) error {
+	hash, err := blockHash(block)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBlockVerification, err)
+	}
+
+	if !strings.EqualFold("0x"+hex.EncodeToString(hash), block.Hash) {
+		return fmt.Errorf("%w: header of %v hashes to 0x%x", ErrBlockVerification, block.Hash, hash)
+	}
+
+	encoded := make([][]byte, 0, len(block.Transactions))
+	for _, transaction := range block.Transactions {
+		data, err := encodeTransaction(transaction)
+		if err != nil {
+			return fmt.Errorf("%w: transaction %v: %v", ErrBlockVerification, transaction.Hash, err)
+		}
+
+		if computed := "0x" + hex.EncodeToString(keccak256(data)); !strings.EqualFold(computed, transaction.Hash) {
+			return fmt.Errorf("%w: transaction %v hashes to %v", ErrBlockVerification, transaction.Hash, computed)
+		}
+
+		encoded = append(encoded, data)
+	}
+
+	if err := verifyRoot("transactions", block.TransactionsRoot, listRoot(encoded)); err != nil {
+		return err
+	}
+
+	// Blocks before Shanghai have neither withdrawals nor their root
+	if block.WithdrawalsRoot == "" {
+		if len(block.Withdrawals) > 0 {
+			return fmt.Errorf("%w: withdrawals without a withdrawals root", ErrBlockVerification)
+		}
+		return nil
+	}
+
+	encoded = make([][]byte, 0, len(block.Withdrawals))
+	for _, withdrawal := range block.Withdrawals {
+		fields := &rlpFields{}
+		fields.quantity("index", withdrawal.Index)
+		fields.quantity("validator index", withdrawal.ValidatorIndex)
+		fields.data("address", withdrawal.Address)
+		fields.quantity("amount", withdrawal.Amount)
+		if fields.err != nil {
+			return fmt.Errorf("%w: withdrawal %v: %v", ErrBlockVerification, withdrawal.Index, fields.err)
+		}
+
+		encoded = append(encoded, fields.encode())
+	}
+
+	return verifyRoot("withdrawals", block.WithdrawalsRoot, listRoot(encoded))
+}
+
+// BlockHash recomputes the hash of the block from its RLP encoded header, the one VerifyBlock holds the block to
+func BlockHash(block Block) (string, error) {
+	hash, err := blockHash(block)
+	if err != nil {
+		return "", err
+	}
+
+	return "0x" + hex.EncodeToString(hash), nil
+}
+
+func verifyRoot(name string, expected string, computed []byte) error {
+	if !strings.EqualFold("0x"+hex.EncodeToString(computed), expected) {
+		return fmt.Errorf("%w: %v root is %v but the %v add up to 0x%x", ErrBlockVerification, name, expected, name, computed)
+	}
+
+	return nil
+}
+
+// blockHash hash of the RLP encoded header, the fields introduced by a fork are only part of it from that fork on
+func blockHash(block Block) ([]byte, error) {
+	fields := &rlpFields{}
+	fields.data("parent hash", block.ParentHash)
+	fields.data("uncles hash", block.Sha3Uncles)
+	fields.data("miner", block.Miner)
+	fields.data("state root", block.StateRoot)
+	fields.data("transactions root", block.TransactionsRoot)
+	fields.data("receipts root", block.ReceiptsRoot)
+	fields.data("logs bloom", block.LogsBloom)
+	fields.quantity("difficulty", block.Difficulty)
+	fields.quantity("number", block.Number)
+	fields.quantity("gas limit", block.GasLimit)
+	fields.quantity("gas used", block.GasUsed)
+	fields.quantity("timestamp", block.Timestamp)
+	fields.data("extra data", block.ExtraData)
+	fields.data("mix hash", block.MixHash)
+	fields.data("nonce", block.Nonce)
+
+	optional := []struct {
+		name     string
+		value    string
+		quantity bool
+	}{
+		{name: "base fee", value: block.BaseFeePerGas, quantity: true},
+		{name: "withdrawals root", value: block.WithdrawalsRoot},
+		{name: "blob gas used", value: block.BlobGasUsed, quantity: true},
+		{name: "excess blob gas", value: block.ExcessBlobGas, quantity: true},
+		{name: "parent beacon block root", value: block.ParentBeaconBlockRoot},
+		{name: "requests hash", value: block.RequestsHash},
+	}
+
+	// Forks only ever append, a field is missing only when every later one is as well
+	for i, field := range optional {
+		if field.value == "" {
+			for _, later := range optional[i+1:] {
+				if later.value != "" {
+					return nil, fmt.Errorf("%v is set without %v", later.name, field.name)
+				}
+			}
+			break
+		}
+
+		if field.quantity {
+			fields.quantity(field.name, field.value)
+		} else {
+			fields.data(field.name, field.value)
+		}
+	}
+
+	if fields.err != nil {
+		return nil, fields.err
+	}
+
+	return keccak256(fields.encode()), nil
+}
+
+// encodeTransaction the encoding the transaction hash and the transactions root are computed over, the RLP list for
+// legacy transactions and the type byte followed by the RLP list for typed ones
+func encodeTransaction(transaction Transaction) ([]byte, error) {
+	txType, fields, err := transactionPayload(transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	if txType == legacyTxType {
+		fields.quantity("v", transaction.V)
+	} else {
+		fields.quantity("y parity", yParity(transaction))
+	}
+	fields.quantity("r", transaction.R)
+	fields.quantity("s", transaction.S)
+
+	if fields.err != nil {
+		return nil, fields.err
+	}
+
+	if txType == legacyTxType {
+		return fields.encode(), nil
+	}
+
+	return append([]byte{txType}, fields.encode()...), nil
+}
+
+// transactionPayload the type and the fields of the transaction up to, not including, the signature
+func transactionPayload(transaction Transaction) (byte, *rlpFields, error) {
+	txType, err := hexDecoder(orZero(transaction.Type))
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid type %v", transaction.Type)
+	}
+
+	fields := &rlpFields{}
+	switch byte(txType) {
+	case legacyTxType:
+		fields.quantity("nonce", transaction.Nonce)
+		fields.quantity("gas price", transaction.GasPrice)
+		fields.quantity("gas", transaction.Gas)
+		fields.data("to", transaction.To)
+		fields.quantity("value", transaction.Value)
+		fields.data("input", transaction.Input)
+	case accessListTxType:
+		fields.quantity("chain id", transaction.ChainID)
+		fields.quantity("nonce", transaction.Nonce)
+		fields.quantity("gas price", transaction.GasPrice)
+		fields.quantity("gas", transaction.Gas)
+		fields.data("to", transaction.To)
+		fields.quantity("value", transaction.Value)
+		fields.data("input", transaction.Input)
+		fields.nested(accessList(transaction.AccessList))
+	case dynamicFeeTxType, blobTxType, setCodeTxType:
+		fields.quantity("chain id", transaction.ChainID)
+		fields.quantity("nonce", transaction.Nonce)
+		fields.quantity("max priority fee", transaction.MaxPriorityFeePerGas)
+		fields.quantity("max fee", transaction.MaxFeePerGas)
+		fields.quantity("gas", transaction.Gas)
+		fields.data("to", transaction.To)
+		fields.quantity("value", transaction.Value)
+		fields.data("input", transaction.Input)
+		fields.nested(accessList(transaction.AccessList))
+
+		switch byte(txType) {
+		case blobTxType:
+			fields.quantity("max fee per blob gas", transaction.MaxFeePerBlobGas)
+			hashes := &rlpFields{}
+			for _, hash := range transaction.BlobVersionedHashes {
+				hashes.data("blob versioned hash", hash)
+			}
+			fields.nested(hashes)
+		case setCodeTxType:
+			authorizations := &rlpFields{}
+			for _, authorization := range transaction.AuthorizationList {
+				tuple := &rlpFields{}
+				tuple.quantity("authorization chain id", authorization.ChainID)
+				tuple.data("authorization address", authorization.Address)
+				tuple.quantity("authorization nonce", authorization.Nonce)
+				tuple.quantity("authorization y parity", authorization.YParity)
+				tuple.quantity("authorization r", authorization.R)
+				tuple.quantity("authorization s", authorization.S)
+				authorizations.nested(tuple)
+			}
+			fields.nested(authorizations)
+		}
+	default:
+		return 0, nil, fmt.Errorf("%w %v", errUnsupportedTransactionType, transaction.Type)
+	}
+
+	return byte(txType), fields, nil
+}
+
+func accessList(tuples []AccessTuple) *rlpFields {
+	list := &rlpFields{}
+	for _, tuple := range tuples {
+		keys := &rlpFields{}
+		for _, key := range tuple.StorageKeys {
+			keys.data("storage key", key)
+		}
+
+		entry := &rlpFields{}
+		entry.data("access list address", tuple.Address)
+		entry.nested(keys)
+		list.nested(entry)
+	}
+
+	return list
+}
+
+// yParity typed transactions carry the parity in v as well, older nodes leave yParity out
+func yParity(transaction Transaction) string {
+	if transaction.YParity != "" {
+		return transaction.YParity
+	}
+
+	return transaction.V
+}
+
+// orZero missing quantities, such as the type of transactions from nodes predating typed transactions, count as zero
+func orZero(value string) string {
+	if value == "" {
+		return "0x0"
+	}
+
+	return value
+}
+
+const (
+	legacyTxType     = 0x00
+	accessListTxType = 0x01
+	dynamicFeeTxType = 0x02
+	blobTxType       = 0x03
+	setCodeTxType    = 0x04
+)
@@ -0,0 +1,77 @@
+package ethereum_parser_test
+
+import (
+	eth "ethereum_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+// genesisBlock the mainnet genesis block as eth_getBlockByNumber returns it
+func genesisBlock() eth.Block {
+	return eth.Block{
+		Hash:             "0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3",
+		Number:           "0x0",
+		Timestamp:        "0x0",
+		Miner:            "0x0000000000000000000000000000000000000000",
+		GasUsed:          "0x0",
+		ParentHash:       "0x" + strings.Repeat("0", 64),
+		Sha3Uncles:       "0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347",
+		StateRoot:        "0xd7f8974fb5ac78d9ac099b9ad5018bedc2ce0a72dad1827a1709da30580f0544",
+		TransactionsRoot: "0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421",
+		ReceiptsRoot:     "0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421",
+		LogsBloom:        "0x" + strings.Repeat("0", 512),
+		Difficulty:       "0x400000000",
+		GasLimit:         "0x1388",
+		ExtraData:        "0x11bbe8db4e347b4e8c937c1c8370e4b5ed33adb3db69cbdb7a38e1e50b1b82fa",
+		MixHash:          "0x" + strings.Repeat("0", 64),
+		Nonce:            "0x0000000000000042",
+	}
+}
+
+func TestVerifyBlock(t *testing.T) {
+	t.Run("genesis", func(t *testing.T) {
+		require.NoError(t, eth.VerifyBlock(genesisBlock()))
+	})
+
+	t.Run("tampered header", func(t *testing.T) {
+		block := genesisBlock()
+		block.Timestamp = "0x1"
+		assert.ErrorIs(t, eth.VerifyBlock(block), eth.ErrBlockVerification)
+	})
+
+	t.Run("injected transaction", func(t *testing.T) {
+		// A real transaction from block 46147, its own hash checks out but the block does not commit to it
+		block := genesisBlock()
+		block.Transactions = []eth.Transaction{{
+			Hash:     "0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060",
+			Nonce:    "0x0",
+			GasPrice: "0x2d79883d2000",
+			Gas:      "0x5208",
+			From:     "0xa1e4380a3b1f749673e270229993ee55f35663b4",
+			To:       "0x5df9b87991262f6ba471f09758cde1c0fc1de734",
+			Value:    "0x7a69",
+			Input:    "0x",
+			V:        "0x1c",
+			R:        "0x88ff6cf0fefd94db46111149ae4bfc179e9b94721fffd821d38d16464b3f71d0",
+			S:        "0x45e0aff800961cfce805daef7016b9b675c137a6a41a548f7b60a3484c06a33a",
+		}}
+
+		err := eth.VerifyBlock(block)
+		assert.ErrorIs(t, err, eth.ErrBlockVerification)
+		assert.Contains(t, err.Error(), "transactions root")
+
+		// Changing the value changes the hash of the transaction itself
+		block.Transactions[0].Value = "0xde0b6b3a7640000"
+		err = eth.VerifyBlock(block)
+		assert.ErrorIs(t, err, eth.ErrBlockVerification)
+		assert.Contains(t, err.Error(), "hashes to")
+	})
+
+	t.Run("withdrawals without a root", func(t *testing.T) {
+		block := genesisBlock()
+		block.Withdrawals = []eth.Withdrawal{{Index: "0x0", ValidatorIndex: "0x1", Address: address, Amount: "0x1"}}
+		assert.ErrorIs(t, eth.VerifyBlock(block), eth.ErrBlockVerification)
+	})
+}
@@ -0,0 +1,149 @@
+package ethereum_parser
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrWalletNotFound = errors.New("wallet not found")
+
+// Wallet group of addresses derived from one extended public key, kept subscribed up to GapLimit unused addresses past
+// the last one that received funds
+type Wallet struct {
+	ID   string `json:"id"`
+	XPub string `json:"xpub"`
+	// Path below the xpub the addresses are derived at, the address index is appended to it
+	Path      string              `json:"path"`
+	GapLimit  int                 `json:"gapLimit"`
+	Options   SubscriptionOptions `json:"options"`
+	Addresses []WalletAddress     `json:"addresses"`
+}
+
+type WalletAddress struct {
+	Index   uint32 `json:"index"`
+	Address string `json:"address"`
+	// Used the address has received funds
+	Used bool `json:"used"`
+}
+
+// Contains whether the address was derived for the wallet
+func (w Wallet) Contains(address string) bool {
+	for _, derived := range w.Addresses {
+		if strings.EqualFold(derived.Address, address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Use marks an address as having received funds and derives whatever is needed to keep GapLimit unused addresses after
+// it, returning the new addresses
+func (w *Wallet) Use(address string) ([]WalletAddress, error) {
+	for i, derived := range w.Addresses {
+		if strings.EqualFold(derived.Address, address) {
+			w.Addresses[i].Used = true
+		}
+	}
+
+	return w.extend()
+}
+
+// extend derives addresses until there are GapLimit unused ones after the last used one
+func (w *Wallet) extend() ([]WalletAddress, error) {
+	want := w.GapLimit
+	for i, derived := range w.Addresses {
+		if derived.Used {
+			want = i + 1 + w.GapLimit
+		}
+	}
+
+	if len(w.Addresses) >= want {
+		return nil, nil
+	}
+
+	key, err := parseExtendedKey(w.XPub)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := parseDerivationPath(w.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The branch is derived once, every address is a single step below it
+	branch, err := key.derive(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var added []WalletAddress
+	for index := uint32(len(w.Addresses)); int(index) < want; index++ {
+		child, err := branch.child(index)
+		if err != nil {
+			return nil, err
+		}
+
+		derived := WalletAddress{Index: index, Address: child.address()}
+		w.Addresses = append(w.Addresses, derived)
+		added = append(added, derived)
+	}
+
+	return added, nil
+}
+
+// Subscriptions one subscription per derived address, sharing the options of the wallet
+func (w Wallet) Subscriptions() []Subscription {
+	subs := make([]Subscription, 0, len(w.Addresses))
+	for _, derived := range w.Addresses {
+		subs = append(subs, Subscription{Address: derived.Address, Wallet: w.ID, Options: w.Options})
+	}
+
+	return subs
+}
+
+// NewWallet validates the xpub and path and derives the first GapLimit addresses, zero picks the default gap limit.
+// The id is derived from the xpub and path so subscribing the same wallet again finds it, however the path is written.
+func NewWallet(xpub string, path string, gapLimit int, options SubscriptionOptions) (Wallet, error) {
+	if gapLimit == 0 {
+		gapLimit = defaultGapLimit
+	}
+
+	if gapLimit < 0 || gapLimit > maxGapLimit {
+		return Wallet{}, fmt.Errorf("%w: gapLimit has to be between 1 and %d", ErrInvalidSubscription, maxGapLimit)
+	}
+
+	xpub = strings.TrimSpace(xpub)
+	if _, err := parseExtendedKey(xpub); err != nil {
+		return Wallet{}, fmt.Errorf("%w: %v", ErrInvalidSubscription, err)
+	}
+
+	indexes, err := parseDerivationPath(path)
+	if err != nil {
+		return Wallet{}, fmt.Errorf("%w: %v", ErrInvalidSubscription, err)
+	}
+
+	wallet := Wallet{
+		ID:       hex.EncodeToString(keccak256([]byte(xpub), []byte("/"+formatDerivationPath(indexes)))[:8]),
+		XPub:     xpub,
+		Path:     path,
+		GapLimit: gapLimit,
+		Options:  options,
+	}
+
+	if _, err := wallet.extend(); err != nil {
+		return Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+const (
+	// defaultGapLimit the gap limit most wallets stop looking after, from BIP-44
+	defaultGapLimit = 20
+	// maxGapLimit every derived address is a subscription, keeping a single wallet from flooding them
+	maxGapLimit = 1000
+)
@@ -0,0 +1,112 @@
+package ethereum_parser_test
+
+import (
+	"context"
+	eth "ethereum_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// BIP-32 test vector 1, the public keys of m/0H and m/0H/1
+const (
+	walletXPub      = "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"
+	walletChildXPub = "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"
+)
+
+func TestNewWallet(t *testing.T) {
+	t.Run("derives the gap", func(t *testing.T) {
+		wallet, err := eth.NewWallet(walletXPub, "", 3, eth.SubscriptionOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []eth.WalletAddress{
+			{Index: 0, Address: "0x91860ef4fc12f4dca2564a3f7fccea9325831ac6"},
+			{Index: 1, Address: "0x29379f45f515c494483298225d1b347f73d1babf"},
+			{Index: 2, Address: "0xfa89adcae8548001f951a4df9bc236e629c5aef4"},
+		}, wallet.Addresses)
+	})
+
+	t.Run("path below the xpub", func(t *testing.T) {
+		parent, err := eth.NewWallet(walletXPub, "m/1", 2, eth.SubscriptionOptions{})
+		require.NoError(t, err)
+
+		child, err := eth.NewWallet(walletChildXPub, "", 2, eth.SubscriptionOptions{})
+		require.NoError(t, err)
+
+		assert.Equal(t, child.Addresses, parent.Addresses)
+		assert.NotEqual(t, child.ID, parent.ID)
+	})
+
+	t.Run("same wallet however the path is written", func(t *testing.T) {
+		wallet, err := eth.NewWallet(walletXPub, "1/0", 2, eth.SubscriptionOptions{})
+		require.NoError(t, err)
+
+		for _, path := range []string{"m/1/0", " /1/0", "01/00"} {
+			again, err := eth.NewWallet(walletXPub, path, 2, eth.SubscriptionOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, wallet.ID, again.ID, path)
+		}
+	})
+
+	t.Run("extends past used addresses", func(t *testing.T) {
+		wallet, err := eth.NewWallet(walletXPub, "", 3, eth.SubscriptionOptions{})
+		require.NoError(t, err)
+
+		added, err := wallet.Use(wallet.Addresses[1].Address)
+		require.NoError(t, err)
+		assert.Len(t, added, 2)
+		assert.Len(t, wallet.Addresses, 5)
+		assert.True(t, wallet.Addresses[1].Used)
+
+		// Funds arriving at an older address leave the window alone
+		added, err = wallet.Use(wallet.Addresses[0].Address)
+		require.NoError(t, err)
+		assert.Empty(t, added)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for name, test := range map[string]struct {
+			xpub     string
+			path     string
+			gapLimit int
+		}{
+			"hardened path":   {xpub: walletXPub, path: "0'"},
+			"private key":     {xpub: "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"},
+			"checksum":        {xpub: walletXPub[:len(walletXPub)-1] + "x"},
+			"gap limit":       {xpub: walletXPub, gapLimit: 5000},
+			"not even base58": {xpub: "0x1234"},
+		} {
+			_, err := eth.NewWallet(test.xpub, test.path, test.gapLimit, eth.SubscriptionOptions{})
+			assert.ErrorIs(t, err, eth.ErrInvalidSubscription, name)
+		}
+	})
+}
+
+func TestService_GetWalletTransactions(t *testing.T) {
+	ctx := context.Background()
+	storage := eth.NewMemStorage()
+	service := eth.NewService(&storage, nil, nil, eth.Notifier{}, nil, nil, nil)
+
+	wallet, err := service.SubscribeWallet(ctx, walletXPub, "", 3, eth.SubscriptionOptions{})
+	require.NoError(t, err)
+
+	subs, err := storage.GetSubscribers(ctx)
+	require.NoError(t, err)
+	require.Len(t, subs, 3)
+	for _, sub := range subs {
+		assert.Equal(t, wallet.ID, sub.Wallet)
+	}
+
+	first, second := wallet.Addresses[0].Address, wallet.Addresses[1].Address
+	require.NoError(t, storage.AddTransaction(ctx, eth.Transaction{Hash: "0x02", ChainID: "0x1", BlockNumber: "0x65", From: first, To: second, Value: "0x1"}))
+	require.NoError(t, storage.AddTransaction(ctx, eth.Transaction{Hash: "0x01", ChainID: "0x1", BlockNumber: "0x64", From: counterparty, To: first, Value: "0x2"}))
+
+	// The transfer between two addresses of the wallet shows up once
+	transactions, err := service.GetWalletTransactions(ctx, wallet.ID, eth.TransactionQuery{})
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+	assert.Equal(t, "0x01", transactions[0].Hash)
+	assert.Equal(t, "0x02", transactions[1].Hash)
+
+	_, err = service.GetWalletTransactions(ctx, "missing", eth.TransactionQuery{})
+	assert.ErrorIs(t, err, eth.ErrWalletNotFound)
+}
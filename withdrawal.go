@@ -0,0 +1,52 @@
+package ethereum_parser
+
+import (
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Withdrawal beacon chain withdrawal crediting a validator's withdrawal address, part of every block since Shanghai
+type Withdrawal struct {
+	Index          string `json:"index"`
+	ValidatorIndex string `json:"validatorIndex"`
+	Address        string `json:"address"`
+	// Amount in gwei, as reported by the node
+	Amount string `json:"amount"`
+
+	// BlockNumber, ChainID and Block are filled in by the parser
+	BlockNumber string       `json:"blockNumber,omitempty"`
+	ChainID     string       `json:"chainId,omitempty"`
+	Block       *BlockHeader `json:"block,omitempty"`
+}
+
+// Time when the block of the withdrawal was produced, zero when the header is not attached
+func (w Withdrawal) Time() time.Time {
+	if w.Block == nil {
+		return time.Time{}
+	}
+
+	return w.Block.Time()
+}
+
+// Value amount of the withdrawal in wei, so it compares with every other transfer
+func (w Withdrawal) Value() string {
+	amount, err := quantityToBig(w.Amount)
+	if err != nil {
+		return "0x0"
+	}
+
+	return bigToQuantity(amount.Mul(amount, big.NewInt(gwei)))
+}
+
+// Transfer withdrawals are always incoming, nobody sends them
+func (w Withdrawal) Transfer() Transfer {
+	return Transfer{
+		Kind:  TransferKindWithdrawal,
+		Asset: AssetETH,
+		To:    strings.ToLower(w.Address),
+		Value: w.Value(),
+	}
+}
+
+const gwei = 1_000_000_000